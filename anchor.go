@@ -0,0 +1,52 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package edit
+
+// An Anchor is a position in the original data of a Buffer that tracks
+// through the buffer's edits, for tools that must report where text they
+// generated ended up in the edited data. Unlike a Mark (see Checkpoint),
+// an Anchor records a position, not a state of the queue; unlike a named
+// marker (see NewBufferStringMarkers), it is not part of the buffer.
+type Anchor struct {
+	b   *Buffer
+	pos int
+	g   Gravity
+}
+
+// A Gravity says which way an Anchor moves when text is inserted exactly at it.
+type Gravity int
+
+const (
+	// GravityRight places text inserted at an anchor before it,
+	// so the anchor follows the inserted text, as with Buffer.Offset.
+	GravityRight Gravity = iota
+
+	// GravityLeft places text inserted at an anchor after it,
+	// so the anchor stays before the inserted text.
+	GravityLeft
+)
+
+// Anchor returns an anchor at the original offset pos with gravity g.
+// It panics if pos is not in [0, len(original)].
+func (b *Buffer) Anchor(pos int, g Gravity) *Anchor {
+	if pos < 0 || pos > b.contentsLen() {
+		panic("invalid offset")
+	}
+	return &Anchor{b: b, pos: pos, g: g}
+}
+
+// Pos returns the anchor's offset in the original data.
+func (a *Anchor) Pos() int {
+	return a.pos
+}
+
+// Offset returns the anchor's offset in the edited data, accounting for all
+// edits queued in its buffer, including those queued after the anchor was
+// created. An anchor inside a replaced or deleted range, including at its
+// start, moves to the start of the replacement text, and to its end if the
+// range ends at the anchor. Offset panics if the queued edits overlap.
+func (a *Anchor) Offset() int {
+	return a.b.offset(a.pos, a.g)
+}
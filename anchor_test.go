@@ -0,0 +1,44 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package edit
+
+import "testing"
+
+func TestAnchor(t *testing.T) {
+	b := NewBufferString("0123456789")
+	right := b.Anchor(5, GravityRight)
+	left := b.Anchor(5, GravityLeft)
+	inside := b.Anchor(8, GravityRight)
+	b.Replace(1, 3, "abc")
+	b.Insert(5, "xy")
+	b.Replace(7, 9, "")
+	// The edited data is "0abc34xy569".
+	for _, tt := range []struct {
+		name string
+		m    *Anchor
+		want int
+	}{
+		{"right", right, 8},
+		{"left", left, 6},
+		{"inside", inside, 10},
+	} {
+		if got := tt.m.Offset(); got != tt.want {
+			t.Errorf("%s: Offset() = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+	if got := left.Pos(); got != 5 {
+		t.Errorf("Pos() = %d, want 5", got)
+	}
+
+	// Gravity does not affect an edit ending or starting at the anchor,
+	// which it follows or precedes.
+	b = NewBufferString("0123456789")
+	left = b.Anchor(5, GravityLeft)
+	b.Replace(3, 5, "L")
+	b.Replace(5, 6, "R")
+	if got, want := left.Offset(), 4; got != want {
+		t.Errorf("Offset() = %d, want %d", got, want)
+	}
+}
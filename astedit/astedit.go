@@ -0,0 +1,115 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package astedit queues edits to Go source in terms of go/ast nodes,
+// on top of edit.FileBuffer. It is separate so that package edit
+// does not depend on go/ast.
+package astedit
+
+import (
+	"go/ast"
+	"go/token"
+
+	"github.com/josharian/edit"
+)
+
+// A Buffer is an edit.FileBuffer with methods that edit whole go/ast nodes.
+type Buffer struct {
+	*edit.FileBuffer
+	src []byte
+}
+
+// NewBuffer returns a Buffer for src, the source of file.
+// It panics if the length of src is not the size of file.
+// As with edit.NewBuffer, the caller must not modify src while the buffer is in use.
+func NewBuffer(file *token.File, src []byte) *Buffer {
+	return &Buffer{FileBuffer: edit.NewFileBuffer(file, src), src: src}
+}
+
+// offset returns the offset in the source of pos, which must be in b's file.
+func (b *Buffer) offset(pos token.Pos) int {
+	off := int(pos) - b.File().Base()
+	if !pos.IsValid() || off < 0 || off > len(b.src) {
+		panic("invalid edit position")
+	}
+	return off
+}
+
+// ReplaceNode replaces the source of the node n with new.
+// The source of n is [n.Pos(), n.End()), so it excludes any doc comment.
+func (b *Buffer) ReplaceNode(n ast.Node, new string) {
+	b.ReplacePos(n.Pos(), n.End(), new)
+}
+
+// DeleteNode deletes the source of the node n along with what would be
+// left dangling without it, so that deleting an element of a list or
+// a whole statement or declaration leaves well-formed, tidy source:
+//
+//   - the doc comment of a declaration, spec, or field, and its line comment;
+//   - the comma or semicolon following n, or if there is none, the comma
+//     preceding n, as for the last argument in f(a, b), with the spaces
+//     between n and the separator;
+//   - and if that leaves the line or lines holding n empty,
+//     those whole lines, including the final newline.
+func (b *Buffer) DeleteNode(n ast.Node) {
+	start, end := b.offset(n.Pos()), b.offset(n.End())
+	var doc, comment *ast.CommentGroup
+	switch n := n.(type) {
+	case *ast.FuncDecl:
+		doc = n.Doc
+	case *ast.GenDecl:
+		doc = n.Doc
+	case *ast.Field:
+		doc, comment = n.Doc, n.Comment
+	case *ast.ValueSpec:
+		doc, comment = n.Doc, n.Comment
+	case *ast.TypeSpec:
+		doc, comment = n.Doc, n.Comment
+	case *ast.ImportSpec:
+		doc, comment = n.Doc, n.Comment
+	}
+	if doc != nil {
+		start = b.offset(doc.Pos())
+	}
+	if comment != nil {
+		end = b.offset(comment.End())
+	}
+
+	src := b.src
+	space := func(c byte) bool { return c == ' ' || c == '\t' }
+	after := end
+	for after < len(src) && space(src[after]) {
+		after++
+	}
+	if after < len(src) && (src[after] == ',' || src[after] == ';') {
+		end = after + 1
+		for end < len(src) && space(src[end]) {
+			end++
+		}
+	} else {
+		before := start
+		for before > 0 && space(src[before-1]) {
+			before--
+		}
+		if before > 0 && src[before-1] == ',' {
+			start = before - 1
+		}
+	}
+
+	// Delete whole lines if nothing else is left on them.
+	ls, le := start, end
+	for ls > 0 && space(src[ls-1]) {
+		ls--
+	}
+	for le < len(src) && space(src[le]) {
+		le++
+	}
+	if (ls == 0 || src[ls-1] == '\n') && (le == len(src) || src[le] == '\n') {
+		start, end = ls, le
+		if end < len(src) {
+			end++
+		}
+	}
+	b.Delete(start, end)
+}
@@ -0,0 +1,85 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package astedit
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"strings"
+	"testing"
+)
+
+func TestDeleteNode(t *testing.T) {
+	const src = `package p
+
+import (
+	"fmt"
+	"os" // for Exit
+)
+
+// T is a type.
+type T struct {
+	A int
+	// B is unused.
+	B string
+}
+
+func f() {
+	g(1, 2, 3)
+	x := []int{
+		4,
+		5,
+	}
+	fmt.Println(x); os.Exit(1)
+}
+`
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "p.go", src, parser.ParseComments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := NewBuffer(fset.File(f.Pos()), []byte(src))
+	imports := f.Decls[0].(*ast.GenDecl)
+	b.DeleteNode(imports.Specs[1])
+	typ := f.Decls[1].(*ast.GenDecl)
+	b.DeleteNode(typ.Specs[0].(*ast.TypeSpec).Type.(*ast.StructType).Fields.List[1])
+	body := f.Decls[2].(*ast.FuncDecl).Body.List
+	call := body[0].(*ast.ExprStmt).X.(*ast.CallExpr)
+	b.DeleteNode(call.Args[0])
+	b.DeleteNode(call.Args[2])
+	lit := body[1].(*ast.AssignStmt).Rhs[0].(*ast.CompositeLit)
+	b.DeleteNode(lit.Elts[1])
+	b.DeleteNode(body[2])
+	b.ReplaceNode(body[3], "return")
+	want := `package p
+
+import (
+	"fmt"
+)
+
+// T is a type.
+type T struct {
+	A int
+}
+
+func f() {
+	g(2)
+	x := []int{
+		4,
+	}
+	return
+}
+`
+	if got := b.String(); got != want {
+		t.Errorf("String() =\n%s\nwant:\n%s", got, want)
+	}
+
+	b = NewBuffer(fset.File(f.Pos()), []byte(src))
+	b.DeleteNode(typ)
+	if got := b.String(); strings.Contains(got, "T is a type") || strings.Contains(got, "struct") {
+		t.Errorf("after DeleteNode of a declaration, String() =\n%s", got)
+	}
+}
@@ -0,0 +1,43 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package edit
+
+// Batch calls fn, which typically queues many edits in b, with the usual
+// checking of edit positions by Insert, Delete, and Replace deferred until
+// fn returns. Batch then checks all the edits queued by fn at once.
+// If any is invalid, Batch removes all the edits queued by fn, leaving b as
+// it was before the call, and returns an error describing the first invalid edit.
+//
+// If fn panics, the panic is not recovered, but the edits queued by fn
+// are removed before it propagates. Calls to Batch within fn run fn directly,
+// leaving the checking to the outermost Batch. Since only the edits queued
+// by fn can be removed, Batch panics if fn rewrites the queue as a whole,
+// as Clear, Optimize, or Truncate do, or removes edits queued before the call.
+func (b *Buffer) Batch(fn func(b *Buffer)) (err error) {
+	if b.batching {
+		fn(b)
+		return nil
+	}
+	m := b.Checkpoint()
+	b.batching = true
+	done := false
+	defer func() {
+		b.batching = false
+		if !done && b.markValid(m) {
+			b.Rollback(m)
+		}
+	}()
+	fn(b)
+	if !b.markValid(m) {
+		panic("edit queue rewritten during Batch")
+	}
+	for _, e := range b.q[m.n:] {
+		if err := b.checkRange(e.start, e.end); err != nil {
+			return err
+		}
+	}
+	done = true
+	return nil
+}
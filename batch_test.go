@@ -0,0 +1,76 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package edit
+
+import "testing"
+
+func TestBatch(t *testing.T) {
+	b := NewBufferString("0123456789")
+	b.Insert(0, "<")
+	err := b.Batch(func(b *Buffer) {
+		for i := 1; i < 10; i += 2 {
+			b.Replace(i, i+1, "_")
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := b.String(), "<0_2_4_6_8_"; got != want {
+		t.Errorf("b.String() = %q, want %q", got, want)
+	}
+
+	// An invalid edit rolls back the whole batch.
+	err = b.Batch(func(b *Buffer) {
+		b.Insert(2, "x")
+		b.Delete(8, 12)
+		b.Insert(3, "y")
+	})
+	if err == nil {
+		t.Errorf("Batch with invalid edit succeeded")
+	}
+	if got, want := b.String(), "<0_2_4_6_8_"; got != want {
+		t.Errorf("after failed batch, b.String() = %q, want %q", got, want)
+	}
+
+	// A panic rolls back the batch and restores validation.
+	func() {
+		defer func() { recover() }()
+		b.Batch(func(b *Buffer) {
+			b.Insert(2, "x")
+			panic("boom")
+		})
+	}()
+	if len(b.q) != 6 {
+		t.Errorf("after panicking batch, %d edits queued, want 6", len(b.q))
+	}
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Insert outside a batch did not validate its position")
+		}
+	}()
+	b.Insert(11, "x")
+}
+
+func TestBatchRewrite(t *testing.T) {
+	for name, fn := range map[string]func(b *Buffer){
+		"Clear":    func(b *Buffer) { b.Clear() },
+		"Optimize": func(b *Buffer) { b.Insert(3, "y"); b.Optimize() },
+		"Undo":     func(b *Buffer) { b.Undo() },
+	} {
+		b := NewBufferString("0123456789")
+		b.Insert(1, "x")
+		func() {
+			defer func() {
+				if r := recover(); r != "edit queue rewritten during Batch" {
+					t.Errorf("%s in Batch: recovered %v, want rewrite panic", name, r)
+				}
+			}()
+			b.Batch(fn)
+		}()
+		if b.batching {
+			t.Errorf("%s in Batch: still batching after panic", name)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package edit
+
+import "strings"
+
+// A Builder collects edits to a Buffer through method chaining,
+// relative to a current position in the original data, as in
+//
+//	err := b.At(3).Insert("x").Then(10).Replace(12, "y").Err()
+//
+// Edit positions are not checked as edits are collected. Instead, Err checks
+// them all at once and reports every invalid one, so that a batch of
+// machine-generated edits gets one complete report rather than a panic
+// at the first bad offset.
+type Builder struct {
+	b   *Buffer
+	pos int
+	q   edits
+}
+
+// At returns a Builder that queues edits in b, starting at the original offset pos.
+func (b *Buffer) At(pos int) *Builder {
+	return &Builder{b: b, pos: pos}
+}
+
+// Then moves the current position to the original offset pos.
+func (c *Builder) Then(pos int) *Builder {
+	c.pos = pos
+	return c
+}
+
+// Insert collects an insertion of new at the current position.
+func (c *Builder) Insert(new string) *Builder {
+	c.q = append(c.q, edit{start: c.pos, end: c.pos, new: new})
+	return c
+}
+
+// Delete collects a deletion of the original data from the current position up to end.
+func (c *Builder) Delete(end int) *Builder {
+	return c.Replace(end, "")
+}
+
+// Replace collects a replacement of the original data from the current position up to end with new.
+func (c *Builder) Replace(end int, new string) *Builder {
+	c.q = append(c.q, edit{start: c.pos, end: end, new: new})
+	return c
+}
+
+// Err checks the collected edits and, if they are all valid, queues them
+// in the Buffer, in the order they were collected, as by Insert and Replace.
+// Otherwise Err queues none of them and returns a PositionErrors listing
+// each invalid edit. Either way, the Builder is left with no collected edits,
+// ready for reuse from its current position.
+func (c *Builder) Err() error {
+	q := c.q
+	c.q = nil
+	var errs PositionErrors
+	for _, e := range q {
+		if err := c.b.checkRange(e.start, e.end); err != nil {
+			errs = append(errs, err.(*PositionError))
+		}
+	}
+	if errs != nil {
+		return errs
+	}
+	for _, e := range q {
+		if e.start == e.end {
+			c.b.Insert(e.start, e.new)
+		} else {
+			c.b.Replace(e.start, e.end, e.new)
+		}
+	}
+	return nil
+}
+
+// PositionErrors is a list of invalid edits, as returned by Builder.Err.
+type PositionErrors []*PositionError
+
+func (errs PositionErrors) Error() string {
+	msgs := make([]string, len(errs))
+	for i, err := range errs {
+		msgs[i] = strings.TrimPrefix(err.Error(), "edit: ")
+	}
+	return "edit: " + strings.Join(msgs, "; ")
+}
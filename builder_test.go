@@ -0,0 +1,47 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package edit
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBuilder(t *testing.T) {
+	b := NewBufferString("0123456789")
+	if err := b.At(1).Insert("<").Replace(3, "x").Then(8).Delete(9).Then(10).Insert(">").Err(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := b.String(), "0<x345679>"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+
+	// Every invalid edit is reported, and none of the edits is queued.
+	c := b.At(-1).Insert("a").Then(5).Replace(4, "b").Then(6).Delete(7).Then(9).Replace(11, "c")
+	err := c.Err()
+	want := PositionErrors{
+		{Start: -1, End: -1, Len: 10},
+		{Start: 5, End: 4, Len: 10},
+		{Start: 9, End: 11, Len: 10},
+	}
+	if !reflect.DeepEqual(err, want) {
+		t.Errorf("Err() = %v, want %v", err, want)
+	}
+	const msg = "edit: invalid edit position [-1,-1) in data of length 10; invalid edit position [5,4) in data of length 10; invalid edit position [9,11) in data of length 10"
+	if err != nil && err.Error() != msg {
+		t.Errorf("Err().Error() = %q, want %q", err.Error(), msg)
+	}
+	if got, want := len(b.Edits()), 4; got != want {
+		t.Errorf("after failed Err, %d edits queued, want %d", got, want)
+	}
+
+	// The Builder is reusable from its current position.
+	if err := c.Delete(10).Err(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := b.String(), "0<x34567>"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,138 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package edit
+
+import (
+	"errors"
+	"strings"
+)
+
+// Compose returns a new buffer over a's original data whose edits have the
+// combined effect of a's edits followed by b's, where b is a buffer over
+// a's edited data, as for the second pass of a multi-pass rewrite.
+// The result's output is b's output, and its edits are in terms of offsets
+// in a's original data. Edits of a that b does not touch are kept as they are;
+// where edits of b touch or abut text replaced by a, they are combined into
+// a single edit. Compose returns an error if b's original data is not a's
+// edited data, or if the edits of a or b overlap.
+func Compose(a, b *Buffer) (*Buffer, error) {
+	mid, err := a.Apply()
+	if err != nil {
+		return nil, err
+	}
+	if !b.sameContents(&Buffer{old: mid}) {
+		return nil, errors.New("edit: second buffer's original data is not the first buffer's edited data")
+	}
+
+	// A piece is a range of a's edited data: unchanged data of a's original
+	// at [x, x+len) or a replacement of a's original [x, xEnd).
+	type piece struct {
+		y, yEnd int // range in a's edited data
+		x, xEnd int // range in a's original data
+		kept    bool
+	}
+	var pieces []piece
+	y := 0
+	a.walk(func(start, end int) error {
+		pieces = append(pieces, piece{y, y + end - start, start, end, true})
+		y += end - start
+		return nil
+	}, func(start, end int, new string) error {
+		pieces = append(pieces, piece{y, y + len(new), start, end, false})
+		y += len(new)
+		return nil
+	})
+	var bedits []Edit
+	if err := b.walkErr(nopSpan, func(start, end int, new string) error {
+		bedits = append(bedits, Edit{start, end, new})
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	// toX returns the offset in a's original data of the offset pos in a's
+	// edited data, which must be in unchanged data or at its boundary,
+	// choosing the lower offset if lower is set and there are two.
+	toX := func(pos int, lower bool) (int, bool) {
+		x, ok := 0, false
+		for _, p := range pieces {
+			if p.kept && p.y <= pos && pos <= p.yEnd {
+				xp := p.x + pos - p.y
+				if !ok || lower && xp < x || !lower && xp > x {
+					x, ok = xp, true
+				}
+			}
+		}
+		return x, ok
+	}
+
+	// c has the original data and settings of a, with the composed edits.
+	c := a.Clone()
+	c.q = c.q[:0]
+	c.rewrites++
+	// Merge the replaced pieces of a and the edits of b, both in increasing
+	// order in a's edited data, into clusters of touching ranges,
+	// each of which becomes one edit of a's original data.
+	pi, bi := 0, 0
+	for {
+		for pi < len(pieces) && pieces[pi].kept {
+			pi++
+		}
+		if pi == len(pieces) && bi == len(bedits) {
+			break
+		}
+		var ys, ye int
+		if bi == len(bedits) || pi < len(pieces) && pieces[pi].y <= bedits[bi].Start {
+			ys, ye = pieces[pi].y, pieces[pi].yEnd
+		} else {
+			ys, ye = bedits[bi].Start, bedits[bi].End
+		}
+		xs, xe := -1, -1
+		var new strings.Builder
+		cur := ys
+		for {
+			switch {
+			case pi < len(pieces) && pieces[pi].kept:
+				pi++
+			case pi < len(pieces) && pieces[pi].y <= ye:
+				p := pieces[pi]
+				if xs < 0 || p.x < xs {
+					xs = p.x
+				}
+				if p.xEnd > xe {
+					xe = p.xEnd
+				}
+				if p.yEnd > ye {
+					ye = p.yEnd
+				}
+				pi++
+			case bi < len(bedits) && bedits[bi].Start <= ye:
+				e := bedits[bi]
+				new.WriteString(b.text(cur, e.Start))
+				new.WriteString(e.New)
+				cur = e.End
+				if e.End > ye {
+					ye = e.End
+				}
+				bi++
+			default:
+				goto done
+			}
+		}
+	done:
+		new.WriteString(b.text(cur, ye))
+		if x, ok := toX(ys, true); ok && (xs < 0 || x < xs) {
+			xs = x
+		}
+		if x, ok := toX(ye, false); ok && x > xe {
+			xe = x
+		}
+		if xs < 0 {
+			xs, xe = 0, 0 // a's original and edited data are both empty
+		}
+		c.q = append(c.q, edit{start: xs, end: xe, new: new.String()})
+	}
+	return c, nil
+}
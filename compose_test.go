@@ -0,0 +1,99 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package edit
+
+import (
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCompose(t *testing.T) {
+	a := NewBufferString("0123456789")
+	a.Replace(1, 3, "ab")
+	a.Delete(5, 7)
+	a.Insert(9, "xyz")
+	// a's output is "0ab3478xyz9".
+	b := NewBufferString(a.String())
+	b.Replace(0, 1, "Z") // unchanged data
+	b.Insert(5, "!")     // at a's deletion
+	b.Replace(8, 9, "Y") // inside a's insertion
+	c, err := Compose(a, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := c.String(), b.String(); got != want {
+		t.Errorf("Compose(a, b).String() = %q, want %q", got, want)
+	}
+	want := []Edit{
+		{0, 3, "Zab"},
+		{5, 7, "!"},
+		{9, 9, "xYz"},
+	}
+	if got := c.Edits(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Compose(a, b).Edits() = %v, want %v", got, want)
+	}
+
+	if _, err := Compose(a, NewBufferString("0123456789")); err == nil {
+		t.Errorf("Compose with unrelated buffer succeeded")
+	}
+
+	// The composed buffer keeps a's original data and settings.
+	ra := NewBufferFromReaderAt(strings.NewReader("0123456789"), 10)
+	ra.Replace(1, 3, "ab")
+	m := ra.Checkpoint()
+	ra.OnConflict(ConflictFirstWins, nil)
+	rb := NewBufferString(ra.String())
+	rb.Insert(5, "!")
+	c, err = Compose(ra, rb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := c.String(), rb.String(); got != want {
+		t.Errorf("Compose of ReaderAt buffer: String() = %q, want %q", got, want)
+	}
+	if c.OriginalLen() != 10 || c.conflict != ConflictFirstWins {
+		t.Errorf("Compose of ReaderAt buffer: OriginalLen() = %d, conflict policy %d; want 10, %d", c.OriginalLen(), c.conflict, ConflictFirstWins)
+	}
+
+	// Marks of a do not apply to the composed queue.
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Rollback of the composed buffer to a mark of a did not panic")
+		}
+	}()
+	c.Rollback(m)
+}
+
+func TestComposeRandom(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	randomEdits := func(b *Buffer) {
+		n := b.contentsLen()
+		pos := 0
+		for pos <= n && r.Intn(4) > 0 {
+			start := pos + r.Intn(n-pos+1)
+			end := start + r.Intn(n-start+1)
+			if end-start > 3 {
+				end = start + 3
+			}
+			b.Replace(start, end, "abc"[:r.Intn(4)])
+			pos = end + 1
+		}
+	}
+	for i := 0; i < 1000; i++ {
+		a := NewBufferString("0123456789"[:r.Intn(11)])
+		randomEdits(a)
+		b := NewBufferString(a.String())
+		randomEdits(b)
+		c, err := Compose(a, b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := c.String(), b.String(); got != want {
+			t.Fatalf("Compose(%v, %v) produces %q, want %q", a.Edits(), b.Edits(), got, want)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package edit
+
+// A ConflictPolicy says what to do when queued edits overlap
+// in a way that cannot be merged.
+type ConflictPolicy int
+
+const (
+	// ConflictReturnError makes WriteTo and other methods that return an error
+	// return a *ConflictError describing overlapping edits.
+	// Methods that cannot return an error, such as Bytes and String, panic.
+	// It is the default.
+	ConflictReturnError ConflictPolicy = iota
+
+	// ConflictPanic makes WriteTo panic on overlapping edits, as Bytes and String do,
+	// for callers that treat overlapping edits as a programming error.
+	// Apply and ApplyString still return a *ConflictError.
+	ConflictPanic
+
+	// ConflictFirstWins keeps, of two conflicting edits, the one applied first,
+	// and drops the other.
+	ConflictFirstWins
+
+	// ConflictLastWins keeps, of two conflicting edits, the one applied last,
+	// and drops the other.
+	ConflictLastWins
+)
+
+// OnConflict sets the policy for overlapping edits that cannot be merged.
+// Under ConflictFirstWins and ConflictLastWins, "first" and "last" refer to the
+// order in which edits are applied: by start offset, then by end offset,
+// then by the order they were queued. When an edit conflicts with several
+// others, the edits are considered in that order (or its reverse, for
+// ConflictLastWins), and each is kept unless it conflicts with one already kept.
+// So of two replacements of the same range, ConflictFirstWins keeps the one
+// queued first, even if both have the same text. Of two nested replacements,
+// the outer one is applied first unless both start at the same offset,
+// in which case the shorter one is.
+//
+// If dropped is not nil, it is called with each edit dropped to resolve
+// a conflict, the first time the queued edits are applied, as by WriteTo,
+// String, or ResultLen, after they last changed. So each dropped edit is
+// reported once, however many times the same edits are applied.
+// Soft edits are resolved before the policy applies; see InsertSoft.
+func (b *Buffer) OnConflict(policy ConflictPolicy, dropped func(Edit)) {
+	b.conflict = policy
+	b.onDrop = dropped
+	b.invalidate()
+}
+
+// resolveConflicts splits the sorted edits q into those to apply and those to drop
+// so that no two kept edits conflict, preserving the order of each.
+// If lastWins is set, later edits are preferred over earlier ones.
+func resolveConflicts(q edits, lastWins bool) (kept, dropped edits) {
+	keep := make([]bool, len(q))
+	if !lastWins {
+		var ks edits
+		var ends []int
+		for i, e := range q {
+			if overlapsAny(ks, ends, e) {
+				continue
+			}
+			keep[i] = true
+			end := e.end
+			if n := len(ends); n > 0 && ends[n-1] > end {
+				end = ends[n-1]
+			}
+			ks = append(ks, e)
+			ends = append(ends, end)
+		}
+	} else {
+		// Every edit kept so far is applied after e.
+		// Only those starting before e ends can conflict with it,
+		// and they are the ones kept most recently.
+		var rev edits
+		for i := len(q) - 1; i >= 0; i-- {
+			e := q[i]
+			ok := true
+			for j := len(rev) - 1; j >= 0 && rev[j].start < e.end; j-- {
+				if rev[j].conflicts(e) {
+					ok = false
+					break
+				}
+			}
+			if ok {
+				keep[i] = true
+				rev = append(rev, e)
+			}
+		}
+	}
+	for i, e := range q {
+		if keep[i] {
+			kept = append(kept, e)
+		} else {
+			dropped = append(dropped, e)
+		}
+	}
+	return kept, dropped
+}
+
+// DedupeEdits sets whether b ignores each queued edit that is identical to one
+// queued before it, with the same range and replacement text, as when several
+// tools or code paths independently queue the same fix. With deduplication on,
+// queueing an edit twice has the same effect as queueing it once, even for
+// insertions, and identical replacements no longer conflict. The text of a lazy
+// edit is the text its function computes (see ReplaceLazy). Deduplication is off by
+// default; to remove identical replacements and deletions from the queue once,
+// see Canonicalize.
+func (b *Buffer) DedupeEdits(on bool) {
+	b.dedupe = on
+	b.invalidate()
+}
+
+// dedupe returns the sorted edits q without those identical to an earlier one.
+// It copies q only if there are edits to remove.
+func dedupe(q edits) edits {
+	var out edits
+	run := 0 // start of the edits in q with the same range as the current one
+	for i, e := range q {
+		if i > 0 && (q[i-1].start != e.start || q[i-1].end != e.end) {
+			run = i
+		}
+		dup := false
+		for _, f := range q[run:i] {
+			if f.new == e.new {
+				dup = true
+				break
+			}
+		}
+		if dup && out == nil {
+			out = append(make(edits, 0, len(q)), q[:i]...)
+		}
+		if out != nil && !dup {
+			out = append(out, e)
+		}
+	}
+	if out == nil {
+		return q
+	}
+	return out
+}
@@ -0,0 +1,172 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package edit
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestOnConflict(t *testing.T) {
+	queue := func(b *Buffer) {
+		b.Replace(2, 5, "AAA")
+		b.Replace(4, 7, "BBB")
+		b.Insert(8, "!")
+	}
+	tests := []struct {
+		policy  ConflictPolicy
+		want    string
+		dropped []Edit
+	}{
+		{ConflictFirstWins, "01AAA567!89", []Edit{{4, 7, "BBB"}}},
+		{ConflictLastWins, "0123BBB7!89", []Edit{{2, 5, "AAA"}}},
+	}
+	for _, tt := range tests {
+		b := NewBufferString("0123456789")
+		queue(b)
+		var dropped []Edit
+		b.OnConflict(tt.policy, func(e Edit) { dropped = append(dropped, e) })
+		if got := b.String(); got != tt.want {
+			t.Errorf("policy %d: String() = %q, want %q", tt.policy, got, tt.want)
+		}
+		if !reflect.DeepEqual(dropped, tt.dropped) {
+			t.Errorf("policy %d: dropped %v, want %v", tt.policy, dropped, tt.dropped)
+		}
+	}
+
+	b := NewBufferString("0123456789")
+	queue(b)
+	var sb strings.Builder
+	want := &ConflictError{A: Edit{2, 5, "AAA"}, B: Edit{4, 7, "BBB"}}
+	if _, err := b.WriteTo(&sb); err == nil {
+		t.Errorf("default policy: WriteTo succeeded, want *ConflictError")
+	} else if cerr, ok := err.(*ConflictError); !ok || *cerr != *want {
+		t.Errorf("default policy: WriteTo returned %v, want %v", err, want)
+	}
+	b.OnConflict(ConflictReturnError, nil)
+	if _, err := b.WriteTo(new(strings.Builder)); err == nil {
+		t.Errorf("ConflictReturnError: WriteTo succeeded, want *ConflictError")
+	}
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Errorf("String did not panic on overlapping edits")
+			}
+		}()
+		_ = b.String()
+	}()
+
+	b.OnConflict(ConflictPanic, nil)
+	defer func() {
+		if recover() == nil {
+			t.Errorf("ConflictPanic: WriteTo did not panic")
+		}
+	}()
+	b.WriteTo(&sb)
+}
+
+func TestOnConflictChain(t *testing.T) {
+	// Each replacement overlaps only its neighbors.
+	for _, tt := range []struct {
+		policy ConflictPolicy
+		want   string
+	}{
+		{ConflictFirstWins, "0AA3CCC789"},
+		{ConflictLastWins, "01BBB5DDD9"},
+	} {
+		b := NewBufferString("0123456789")
+		b.Replace(1, 3, "AA")
+		b.Replace(2, 5, "BBB")
+		b.Replace(4, 7, "CCC")
+		b.Replace(6, 9, "DDD")
+		b.OnConflict(tt.policy, nil)
+		if got := b.String(); got != tt.want {
+			t.Errorf("policy %d: String() = %q, want %q", tt.policy, got, tt.want)
+		}
+	}
+}
+
+func TestOnConflictNested(t *testing.T) {
+	for _, tt := range []struct {
+		policy  ConflictPolicy
+		want    string
+		dropped []Edit
+	}{
+		{ConflictFirstWins, "0AAAA6N89", []Edit{{1, 6, "B"}, {2, 4, "C"}, {7, 8, "N"}, {7, 9, "OO"}}},
+		{ConflictLastWins, "01C456OO9", []Edit{{1, 6, "AAAA"}, {1, 6, "B"}, {7, 8, "N"}, {7, 8, "N"}}},
+	} {
+		b := NewBufferString("0123456789")
+		b.Replace(1, 6, "AAAA")
+		b.Replace(1, 6, "B") // same range
+		b.Replace(2, 4, "C") // inside [1, 6)
+		b.Replace(7, 8, "N")
+		b.Replace(7, 8, "N")  // same range and text
+		b.Replace(7, 9, "OO") // same start, longer
+		var dropped []Edit
+		b.OnConflict(tt.policy, func(e Edit) { dropped = append(dropped, e) })
+		if got := b.String(); got != tt.want {
+			t.Errorf("policy %d: String() = %q, want %q", tt.policy, got, tt.want)
+		}
+		if !reflect.DeepEqual(dropped, tt.dropped) {
+			t.Errorf("policy %d: dropped %v, want %v", tt.policy, dropped, tt.dropped)
+		}
+	}
+}
+
+func TestOnConflictReportsOnce(t *testing.T) {
+	b := NewBufferString("0123456789")
+	b.Replace(1, 4, "A")
+	b.Replace(2, 5, "B")
+	calls := 0
+	b.OnConflict(ConflictFirstWins, func(Edit) { calls++ })
+	_ = b.String()
+	b.ResultLen()
+	b.Offset(5)
+	b.AppendTo(nil)
+	if calls != 1 {
+		t.Errorf("dropped edit reported %d times, want 1", calls)
+	}
+	b.Insert(9, "!")
+	_ = b.String()
+	_ = b.String()
+	if calls != 2 {
+		t.Errorf("after queueing another edit, dropped edit reported %d times in all, want 2", calls)
+	}
+}
+
+func TestDedupeEdits(t *testing.T) {
+	b := NewBufferString("0123456789")
+	b.Replace(2, 4, "AB")
+	b.Insert(6, "!")
+	b.Replace(2, 4, "AB")
+	b.Insert(6, "?")
+	b.Insert(6, "!")
+	b.ReplaceLazy(8, 9, func(old []byte) []byte { return []byte("AB") })
+	b.Replace(8, 9, "AB")
+	if err := b.Validate(); err == nil {
+		t.Errorf("Validate() without deduplication succeeded, want *ConflictError")
+	}
+	b.DedupeEdits(true)
+	if got, want := b.String(), "01AB45!?67AB9"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+	if got, want := b.Clone().String(), "01AB45!?67AB9"; got != want {
+		t.Errorf("Clone().String() = %q, want %q", got, want)
+	}
+	if got, want := len(b.Edits()), 7; got != want {
+		t.Errorf("len(Edits()) = %d, want %d; the queue should keep duplicates", got, want)
+	}
+	if cs := b.Conflicts(); len(cs) != 0 {
+		t.Errorf("Conflicts() = %v with deduplication, want none", cs)
+	}
+	b.DedupeEdits(false)
+	if cs := b.Conflicts(); len(cs) == 0 {
+		t.Errorf("Conflicts() reported nothing without deduplication")
+	}
+	if _, err := b.ApplyString(); err == nil {
+		t.Errorf("ApplyString() after turning deduplication off succeeded, want *ConflictError")
+	}
+}
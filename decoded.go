@@ -0,0 +1,110 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package edit
+
+import (
+	"fmt"
+	"sort"
+)
+
+// A Transformer converts bytes from one form to another.
+// It has the same method set as golang.org/x/text/transform.Transformer,
+// so the decoders in golang.org/x/text/encoding can be used directly.
+type Transformer interface {
+	Transform(dst, src []byte, atEOF bool) (nDst, nSrc int, err error)
+	Reset()
+}
+
+// A DecodedBuffer queues edits to data in some encoding other than UTF-8,
+// with edit positions given in decoded characters rather than bytes.
+// Character i is the i'th unit of encoded data that the decoder
+// turns into text; encoded bytes that decode to nothing, such as the escape
+// sequences of stateful encodings, belong to the character that follows them.
+type DecodedBuffer struct {
+	b       *Buffer
+	raw     []int // raw[i] is the byte offset of character i in the encoded data
+	decoded []int // decoded[i] is the offset of character i in the decoded UTF-8 text
+}
+
+// NewDecodedBuffer returns a buffer to accumulate changes to old,
+// where dec decodes old to UTF-8.
+// It returns an error if dec cannot decode old.
+// As with NewBuffer, the caller must not modify old while the buffer is in use.
+func NewDecodedBuffer(old []byte, dec Transformer) (*DecodedBuffer, error) {
+	d := &DecodedBuffer{b: NewBuffer(old), raw: []int{0}, decoded: []int{0}}
+	dec.Reset()
+	var dst [64]byte
+	pos, out := 0, 0
+	for pos < len(old) {
+		// Feed the decoder one more byte at a time until it makes progress,
+		// so that each call consumes exactly one character.
+		var nDst, nSrc int
+		var err error
+		for k := 1; nSrc == 0 && pos+k <= len(old); k++ {
+			nDst, nSrc, err = dec.Transform(dst[:], old[pos:pos+k], pos+k == len(old))
+		}
+		if nSrc == 0 {
+			return nil, fmt.Errorf("edit: cannot decode data at offset %d: %v", pos, err)
+		}
+		pos += nSrc
+		out += nDst
+		if nDst > 0 {
+			d.raw = append(d.raw, pos)
+			d.decoded = append(d.decoded, out)
+		}
+	}
+	if last := len(d.raw) - 1; d.raw[last] != len(old) {
+		// Trailing bytes that decoded to nothing belong to the last character.
+		d.raw[last] = len(old)
+	}
+	return d, nil
+}
+
+// Buffer returns the underlying buffer, which addresses the encoded data by byte offset.
+func (d *DecodedBuffer) Buffer() *Buffer {
+	return d.b
+}
+
+// Len returns the number of characters in the original data.
+func (d *DecodedBuffer) Len() int {
+	return len(d.raw) - 1
+}
+
+// Offset returns the byte offset in the encoded data of character char.
+// Offset(d.Len()) is the length of the encoded data.
+func (d *DecodedBuffer) Offset(char int) int {
+	if char < 0 || char >= len(d.raw) {
+		panic("invalid edit position")
+	}
+	return d.raw[char]
+}
+
+// OffsetFromDecoded returns the byte offset in the encoded data corresponding to
+// the byte offset off in the decoded UTF-8 text. It panics if off does not fall
+// on a character boundary.
+func (d *DecodedBuffer) OffsetFromDecoded(off int) int {
+	i := sort.SearchInts(d.decoded, off)
+	if i == len(d.decoded) || d.decoded[i] != off {
+		panic("edit position not on a character boundary")
+	}
+	return d.raw[i]
+}
+
+// Insert inserts the new string before character pos.
+// The new string is queued as is, so it must already be in the data's encoding.
+func (d *DecodedBuffer) Insert(pos int, new string) {
+	d.b.Insert(d.Offset(pos), new)
+}
+
+// Delete deletes characters [start, end).
+func (d *DecodedBuffer) Delete(start, end int) {
+	d.b.Delete(d.Offset(start), d.Offset(end))
+}
+
+// Replace replaces characters [start, end) with new.
+// The new string is queued as is, so it must already be in the data's encoding.
+func (d *DecodedBuffer) Replace(start, end int, new string) {
+	d.b.Replace(d.Offset(start), d.Offset(end), new)
+}
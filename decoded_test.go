@@ -0,0 +1,77 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package edit
+
+import (
+	"errors"
+	"testing"
+	"unicode/utf8"
+)
+
+var errShortSrc = errors.New("short source")
+
+// A dbcsDecoder decodes a toy double-byte encoding in the style of Shift-JIS:
+// bytes below 0x80 are ASCII, and a byte 0x80 or above leads a two-byte
+// character that decodes to U+3000 + the trail byte.
+type dbcsDecoder struct{}
+
+func (dbcsDecoder) Reset() {}
+
+func (dbcsDecoder) Transform(dst, src []byte, atEOF bool) (nDst, nSrc int, err error) {
+	for nSrc < len(src) {
+		r, size := rune(src[nSrc]), 1
+		if r >= 0x80 {
+			if nSrc+1 >= len(src) {
+				if !atEOF {
+					return nDst, nSrc, errShortSrc
+				}
+				r = utf8.RuneError
+			} else {
+				r, size = 0x3000+rune(src[nSrc+1]), 2
+			}
+		}
+		if nDst+utf8.RuneLen(r) > len(dst) {
+			return nDst, nSrc, errors.New("short destination")
+		}
+		nDst += utf8.EncodeRune(dst[nDst:], r)
+		nSrc += size
+	}
+	return nDst, nSrc, nil
+}
+
+func TestDecodedBuffer(t *testing.T) {
+	old := []byte("a\x81\x01b\x82\x02c")
+	d, err := NewDecodedBuffer(old, dbcsDecoder{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Len() != 5 {
+		t.Errorf("d.Len() = %d, want 5", d.Len())
+	}
+	for char, want := range []int{0, 1, 3, 4, 6, 7} {
+		if got := d.Offset(char); got != want {
+			t.Errorf("d.Offset(%d) = %d, want %d", char, got, want)
+		}
+	}
+	// Decoded: "a" U+3001 "b" U+3002 "c", with the CJK characters 3 bytes each.
+	if got := d.OffsetFromDecoded(4); got != 3 {
+		t.Errorf("d.OffsetFromDecoded(4) = %d, want 3", got)
+	}
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Errorf("d.OffsetFromDecoded(2) did not panic mid-character")
+			}
+		}()
+		d.OffsetFromDecoded(2)
+	}()
+
+	d.Replace(1, 2, "X")
+	d.Insert(3, "Y")
+	d.Delete(4, 5)
+	if got, want := d.Buffer().String(), "aXbY\x82\x02"; got != want {
+		t.Errorf("edited data = %q, want %q", got, want)
+	}
+}
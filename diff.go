@@ -0,0 +1,220 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package edit
+
+import "bytes"
+
+// maxDiffCost bounds the number of line insertions and deletions diff
+// searches for before giving up and replacing the differing lines wholesale.
+// It bounds diff's memory use, which is quadratic in that number.
+const maxDiffCost = 2000
+
+// Diff returns a new buffer over old holding edits that transform it into new.
+// The edits are found by diffing old and new line by line and then narrowing
+// each run of differing lines to the bytes that differ, so they are small
+// but not necessarily minimal. As with NewBuffer, the caller must not modify
+// old while the buffer is in use.
+func Diff(old, new []byte) *Buffer {
+	b := NewBuffer(old)
+	b.q = diff(old, new)
+	return b
+}
+
+// DiffTo returns a new buffer over the data with b's queued edits applied,
+// holding edits that transform it into target.
+// This allows chaining: b's edits take the original to b's output,
+// and the returned buffer's edits take b's output to target.
+// DiffTo materializes b's output in order to diff it against target.
+// It returns an error if b's queued edits overlap.
+func (b *Buffer) DiffTo(target []byte) (*Buffer, error) {
+	out, err := b.Apply()
+	if err != nil {
+		return nil, err
+	}
+	nb := NewBuffer(out)
+	nb.q = diff(out, target)
+	return nb, nil
+}
+
+// diff returns edits, in increasing offset order, that transform old into new.
+// It matches up lines using Myers' algorithm and then narrows each run of
+// differing lines down to the bytes that differ.
+func diff(old, new []byte) edits {
+	a, b := splitLineIDs(old, new)
+	var q edits
+	oldOff, newOff := 0, 0
+	i0, j0 := 0, 0
+	hunk := func(i, j int) {
+		oldEnd, newEnd := advanceLines(oldOff, a.slice(i0, i)), advanceLines(newOff, b.slice(j0, j))
+		if e, ok := narrow(old, new, oldOff, oldEnd, newOff, newEnd); ok {
+			q = append(q, e)
+		}
+		oldOff, newOff = oldEnd, newEnd
+	}
+	for _, m := range matchLines(a.ids, b.ids) {
+		i, j := m[0], m[1]
+		if i > i0 || j > j0 {
+			hunk(i, j)
+		}
+		oldOff += a.lens[i]
+		newOff += b.lens[j]
+		i0, j0 = i+1, j+1
+	}
+	if i0 < len(a.ids) || j0 < len(b.ids) {
+		hunk(len(a.ids), len(b.ids))
+	}
+	return q
+}
+
+// lineIDs holds the lines of some text, identified by small integers
+// such that equal lines have equal ids.
+type lineIDs struct {
+	ids  []int
+	lens []int // byte length of each line, including its newline
+}
+
+// splitLineIDs splits old and new into lines with common ids.
+func splitLineIDs(old, new []byte) (a, b lineIDs) {
+	seen := make(map[string]int)
+	split := func(data []byte) lineIDs {
+		var l lineIDs
+		for len(data) > 0 {
+			n := bytes.IndexByte(data, '\n') + 1
+			if n == 0 {
+				n = len(data)
+			}
+			id, ok := seen[string(data[:n])]
+			if !ok {
+				id = len(seen)
+				seen[string(data[:n])] = id
+			}
+			l.ids = append(l.ids, id)
+			l.lens = append(l.lens, n)
+			data = data[n:]
+		}
+		return l
+	}
+	return split(old), split(new)
+}
+
+// advanceLines returns off advanced past the lines in l.
+func advanceLines(off int, l lineIDs) int {
+	for _, n := range l.lens {
+		off += n
+	}
+	return off
+}
+
+// slice returns the lines [i, j) of l.
+func (l lineIDs) slice(i, j int) lineIDs {
+	return lineIDs{l.ids[i:j], l.lens[i:j]}
+}
+
+// narrow returns an edit replacing old[oldStart:oldEnd] with new[newStart:newEnd],
+// trimmed of any common prefix and suffix. It reports false if the ranges are identical.
+func narrow(old, new []byte, oldStart, oldEnd, newStart, newEnd int) (edit, bool) {
+	for oldStart < oldEnd && newStart < newEnd && old[oldStart] == new[newStart] {
+		oldStart++
+		newStart++
+	}
+	for oldStart < oldEnd && newStart < newEnd && old[oldEnd-1] == new[newEnd-1] {
+		oldEnd--
+		newEnd--
+	}
+	if oldStart == oldEnd && newStart == newEnd {
+		return edit{}, false
+	}
+	return edit{start: oldStart, end: oldEnd, new: string(new[newStart:newEnd])}, true
+}
+
+// matchLines returns the pairs of indexes (i, j) of lines with a[i] == b[j]
+// in a longest common subsequence of a and b, in increasing order.
+// If more than maxDiffCost insertions and deletions are needed,
+// it matches only the common prefix and suffix.
+func matchLines(a, b []int) [][2]int {
+	n, m := len(a), len(b)
+	max := n + m
+	off := max + 1
+	v := make([]int, 2*off+1)
+	var trace [][]int // trace[d][k+d] is v[k] before step d
+	var d int
+	for d = 0; d <= max; d++ {
+		if d > maxDiffCost {
+			return matchEnds(a, b)
+		}
+		trace = append(trace, append([]int(nil), v[off-d:off+d+1]...))
+		done := false
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || k != d && v[off+k-1] < v[off+k+1] {
+				x = v[off+k+1]
+			} else {
+				x = v[off+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[off+k] = x
+			if x >= n && y >= m {
+				done = true
+				break
+			}
+		}
+		if done {
+			break
+		}
+	}
+
+	// Walk back through the trace, collecting the diagonal (matching) moves.
+	var matches [][2]int
+	x, y := n, m
+	for ; d > 0; d-- {
+		vv := trace[d]
+		k := x - y
+		var prevK int
+		if k == -d || k != d && vv[k-1+d] < vv[k+1+d] {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := vv[prevK+d]
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			x--
+			y--
+			matches = append(matches, [2]int{x, y})
+		}
+		x, y = prevX, prevY
+	}
+	for x > 0 && y > 0 {
+		x--
+		y--
+		matches = append(matches, [2]int{x, y})
+	}
+	for i, j := 0, len(matches)-1; i < j; i, j = i+1, j-1 {
+		matches[i], matches[j] = matches[j], matches[i]
+	}
+	return matches
+}
+
+// matchEnds returns the pairs of indexes of the common prefix and suffix of a and b.
+func matchEnds(a, b []int) [][2]int {
+	var matches [][2]int
+	i := 0
+	for i < len(a) && i < len(b) && a[i] == b[i] {
+		matches = append(matches, [2]int{i, i})
+		i++
+	}
+	var suffix int
+	for suffix < len(a)-i && suffix < len(b)-i && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	for s := suffix; s > 0; s-- {
+		matches = append(matches, [2]int{len(a) - s, len(b) - s})
+	}
+	return matches
+}
@@ -0,0 +1,77 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package edit
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		old, new string
+		n        int // number of edits expected
+	}{
+		{"", "", 0},
+		{"a\nb\nc\n", "a\nb\nc\n", 0},
+		{"", "a\n", 1},
+		{"a\n", "", 1},
+		{"a\nb\nc\n", "a\nB\nc\n", 1},
+		{"a\nb\nc\nd\ne\n", "x\na\nc\nd\ne\ny", 3},
+		{"one two\nthree\n", "one 2\nthree\n", 1},
+		{"no newline", "no newline\n", 1},
+	}
+	for _, tt := range tests {
+		b := Diff([]byte(tt.old), []byte(tt.new))
+		if got := b.String(); got != tt.new {
+			t.Errorf("Diff(%q, %q) produces %q", tt.old, tt.new, got)
+		}
+		if q := b.Edits(); len(q) != tt.n {
+			t.Errorf("Diff(%q, %q) = %d edits %v, want %d", tt.old, tt.new, len(q), q, tt.n)
+		}
+	}
+}
+
+func TestDiffRandom(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	lines := func() string {
+		var sb strings.Builder
+		for i := r.Intn(30); i > 0; i-- {
+			sb.WriteString(string(rune('a' + r.Intn(5))))
+			sb.WriteString("\n")
+		}
+		return sb.String()
+	}
+	for i := 0; i < 200; i++ {
+		old, new := lines(), lines()
+		b := NewBufferString(old)
+		b.q = diff([]byte(old), []byte(new))
+		if got := b.String(); got != new {
+			t.Fatalf("diff(%q, %q) produces %q", old, new, got)
+		}
+	}
+}
+
+func TestDiffTo(t *testing.T) {
+	b := NewBufferString("a\nb\nc\n")
+	b.Replace(2, 3, "B")
+	target := "a\nB\nc\nd\n"
+	nb, err := b.DiffTo([]byte(target))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := nb.String(); got != target {
+		t.Errorf("DiffTo buffer produces %q, want %q", got, target)
+	}
+	if len(nb.q) != 1 {
+		t.Errorf("DiffTo buffer has %d edits, want 1", len(nb.q))
+	}
+
+	b.Replace(2, 4, "x")
+	if _, err := b.DiffTo([]byte(target)); err == nil {
+		t.Errorf("DiffTo succeeded with overlapping edits")
+	}
+}
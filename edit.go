@@ -7,17 +7,60 @@ package edit
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"sort"
 	"strings"
+	"sync"
+	"unsafe"
 )
 
 // A Buffer is a queue of edits to apply to a given byte slice.
+//
+// Methods that only read a Buffer, such as WriteTo, Bytes, and String, leave
+// the queue as it is and may be called concurrently with each other, though
+// not with methods that queue or change edits. Functions passed to
+// ReplaceLazy and OnConflict may then be called concurrently too.
 type Buffer struct {
-	old []byte
-	str string // old, but a string, used only when old is nil
-	q   edits
+	old     []byte
+	str     string      // old, but a string, used only when old is nil
+	src     io.ReaderAt // old, but read on demand, used only when not nil; see NewBufferFromReaderAt
+	srcLen  int         // the length of the data in src
+	q       edits
+	markers map[string]int // named offsets into old, for InsertAtMarker
+
+	batching  bool // inside Batch: defer validation of edit positions
+	checkUTF8 bool // reject edit positions inside UTF-8 sequences; see CheckUTF8
+	dedupe    bool // ignore edits identical to earlier ones; see DedupeEdits
+	large     bool // keep sorted edits across insertions; see NewBufferLarge
+	sources   int  // number of source ids used by merged edits
+	rewrites  int  // number of times the queue has been rewritten as a whole, for Rollback
+
+	eol      string // if not empty, the line ending for new text; see MatchLineEndings
+	tabWidth int    // if positive, the width of a tab in visual columns; see SetTabWidth
+
+	conflict ConflictPolicy // what to do with conflicting edits; see OnConflict
+	onDrop   func(Edit)     // called with edits dropped by conflict; may be nil
+
+	cacheResult bool // memoize the output of Bytes and String; see SetCacheResult
+	maxOutput   int  // if positive, the largest output allowed; see SetMaxOutputSize
+
+	// mu guards the memoized fields below, so that methods that only read b,
+	// such as WriteTo, may be called concurrently. Mutations reset them.
+	mu    sync.Mutex
+	cache *cachedResult // memoized output, nil until computed or after a mutation
+	snap  edits         // q sorted in the order edits are applied, nil until computed or after a mutation
+	lines *LineIndex    // line index of old, computed on first use by lineIndex
+
+	dropsReported bool // the edits dropped by conflict have been passed to onDrop
+}
+
+// A cachedResult is the memoized output of a Buffer.
+type cachedResult struct {
+	data   []byte
+	str    string
+	hasStr bool // str has been computed from data
 }
 
 // An edit records a single text modification: change the bytes in [start,end) to new.
@@ -25,18 +68,148 @@ type edit struct {
 	start int
 	end   int
 	new   string
+	soft  bool // drop instead of failing if it overlaps a non-soft edit
+
+	priority int // order among insertions at the same position; see InsertWithPriority
+
+	source int // the buffer that queued the edit, for edits added by Merge; 0 for the receiver
+
+	lazy func(old []byte) []byte // if not nil, computes new when edits are applied; see ReplaceLazy
+
+	label string // describes where the edit came from, for diagnostics; see ReplaceLabeled
 }
 
-// An edits is a list of edits that is sortable by start offset, breaking ties by end offset.
+// An edits is a list of edits that is sortable by start offset,
+// breaking ties by end offset and then by priority.
 type edits []edit
 
-func (x edits) Len() int      { return len(x) }
-func (x edits) Swap(i, j int) { x[i], x[j] = x[j], x[i] }
-func (x edits) Less(i, j int) bool {
-	if x[i].start != x[j].start {
-		return x[i].start < x[j].start
+func (x edits) Len() int           { return len(x) }
+func (x edits) Swap(i, j int)      { x[i], x[j] = x[j], x[i] }
+func (x edits) Less(i, j int) bool { return x[i].before(&x[j]) }
+
+// before reports whether e sorts before f, regardless of queue order.
+func (e *edit) before(f *edit) bool {
+	if e.start != f.start {
+		return e.start < f.start
+	}
+	if e.end != f.end {
+		return e.end < f.end
+	}
+	return e.priority < f.priority
+}
+
+// sorted returns a copy of the queued edits in the order they are applied,
+// with the replacement text of lazy edits computed.
+func (b *Buffer) sorted() edits {
+	q := append(edits(nil), b.sortedQueue()...)
+	for i, e := range q {
+		if e.lazy != nil {
+			var old []byte
+			if b.old != nil {
+				old = b.old[e.start:e.end:e.end]
+			} else if b.src != nil {
+				old = b.readSrc(e.start, e.end)
+			} else {
+				old = []byte(b.str[e.start:e.end])
+			}
+			q[i].new = string(e.lazy(old))
+			q[i].lazy = nil
+		}
+	}
+	return q
+}
+
+// sortedQueue returns the queued edits in the order they are applied,
+// sorting them only once until the next mutation.
+// The result is shared and must not be modified.
+func (b *Buffer) sortedQueue() edits {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if n := len(b.snap); n < len(b.q) {
+		if n == 0 {
+			b.snap = b.q.sortedCopy()
+		} else {
+			// A large buffer kept the sorted edits before those appended since.
+			b.snap = b.snap.merge(b.q[n:].sortedCopy())
+		}
+	}
+	return b.snap
+}
+
+// isSorted reports whether x is sorted. Unlike sort.IsSorted,
+// it does not allocate, which matters for a Buffer reused with Reset.
+func (x edits) isSorted() bool {
+	for i := len(x) - 1; i > 0; i-- {
+		if x.Less(i, i-1) {
+			return false
+		}
+	}
+	return true
+}
+
+// sortedCopy returns a copy of x sorted stably, as by sort.Stable.
+// Edits are large, so rather than sorting x itself, which moves each edit
+// many times, sortedCopy sorts compact keys, breaking ties by queue order,
+// and then moves each edit once.
+func (x edits) sortedCopy() edits {
+	if len(x) <= 12 {
+		// For short queues, sort.Stable is an insertion sort, which moves few edits.
+		q := append(edits(nil), x...)
+		sort.Stable(q)
+		return q
+	}
+	keys := make(editKeys, len(x))
+	for i, e := range x {
+		keys[i] = editKey{e.start, e.end, e.priority, i}
+	}
+	sort.Sort(keys)
+	q := make(edits, len(x))
+	for i, k := range keys {
+		q[i] = x[k.i]
+	}
+	return q
+}
+
+// merge returns a new list of the edits of x and y, which are both sorted,
+// in sorted order. The edits of y were queued after those of x,
+// so they follow those of x that they tie with.
+func (x edits) merge(y edits) edits {
+	q := make(edits, 0, len(x)+len(y))
+	for len(x) > 0 && len(y) > 0 {
+		if y[0].before(&x[0]) {
+			q = append(q, y[0])
+			y = y[1:]
+		} else {
+			q = append(q, x[0])
+			x = x[1:]
+		}
+	}
+	q = append(q, x...)
+	return append(q, y...)
+}
+
+// An editKey holds the fields of an edit that determine its order, and its index in the queue.
+type editKey struct {
+	start, end, priority, i int
+}
+
+// An editKeys sorts keys in the order their edits are applied.
+type editKeys []editKey
+
+func (x editKeys) Len() int      { return len(x) }
+func (x editKeys) Swap(i, j int) { x[i], x[j] = x[j], x[i] }
+func (x editKeys) Less(i, j int) bool {
+	a, b := &x[i], &x[j]
+	if a.start != b.start {
+		return a.start < b.start
 	}
-	return x[i].end < x[j].end
+	if a.end != b.end {
+		return a.end < b.end
+	}
+	if a.priority != b.priority {
+		return a.priority < b.priority
+	}
+	return a.i < b.i
 }
 
 // NewBuffer returns a new buffer to accumulate changes to an initial data slice.
@@ -51,80 +224,1140 @@ func NewBufferString(old string) *Buffer {
 	return &Buffer{str: old}
 }
 
+// NewBufferFromReaderAt returns a new buffer to accumulate changes to the size
+// bytes of data read from r, such as a large file or memory-mapped region, so
+// that the data need not be held in memory. WriteTo reads unchanged ranges of
+// the data from r only as it writes them, copying them in chunks; so do Reader,
+// WriteFile, and similar methods. Methods that search or compare the whole
+// data, such as ReplaceAll, ReplaceAllRegexp, and Merge, read all of it into
+// memory, as do Bytes and String, whose results hold the edited data.
+//
+// As with NewBuffer, the data must not change until after the Buffer is done
+// being used. If reading from r fails, WriteTo and other methods that return
+// an error return it; the others panic.
+func NewBufferFromReaderAt(r io.ReaderAt, size int64) *Buffer {
+	if size < 0 || int64(int(size)) != size {
+		panic("invalid size")
+	}
+	return &Buffer{src: r, srcLen: int(size)}
+}
+
+// readSrc returns the data in [start, end) read from b.src.
+// It panics if reading fails.
+func (b *Buffer) readSrc(start, end int) []byte {
+	p := make([]byte, end-start)
+	b.readSrcAt(p, start)
+	return p
+}
+
+// readSrcAt reads len(p) bytes from b.src at offset off into p.
+// It panics if reading fails.
+func (b *Buffer) readSrcAt(p []byte, off int) {
+	if n, err := b.src.ReadAt(p, int64(off)); n < len(p) {
+		panic("edit: reading original data: " + err.Error())
+	}
+}
+
+// NewBufferUTF8 is like NewBuffer, but the returned buffer checks that edit
+// positions fall on UTF-8 sequence boundaries, as set by CheckUTF8.
+func NewBufferUTF8(old []byte) *Buffer {
+	return &Buffer{old: old, checkUTF8: true}
+}
+
+// NewBufferLarge is like NewBuffer, but the returned buffer is suited to
+// queueing a great many edits, such as those of a code generator or minifier,
+// between calls that apply them, such as OutputLen, Conflicts, or WriteTo.
+// Such calls sort the queued edits. A buffer from NewBuffer sorts them
+// all again after any new edit is queued, while the returned buffer keeps
+// the edits it has sorted and merges only the newly inserted, deleted,
+// or replaced ones into them. Other changes to the queue, such as Undo
+// or Optimize, still cause a full sort. The cost is the memory for
+// the sorted copy of the queue, which the buffer holds on to as it grows.
+func NewBufferLarge(old []byte) *Buffer {
+	return &Buffer{old: old, large: true}
+}
+
+// NewBufferFromEdits returns a new buffer for the data old with the given
+// edits queued, in order, as if by Replace, which panics if an edit is invalid.
+// NewBufferFromEdits(old, b.Edits()) reproduces the edits queued in b,
+// and thus b's output, provided b has no soft edits that are dropped.
+func NewBufferFromEdits(old []byte, edits []Edit) *Buffer {
+	b := NewBuffer(old)
+	b.Add(edits...)
+	return b
+}
+
+// Clone returns a copy of b, with the same original data and its own copy
+// of the queued edits and named markers, so that edits queued in either
+// buffer do not affect the other. Clones may be edited concurrently,
+// as when trying alternative rewrites in parallel. A Mark returned by
+// b.Checkpoint before the call is valid for the clone too.
+func (b *Buffer) Clone() *Buffer {
+	c := &Buffer{
+		old:         b.old,
+		str:         b.str,
+		src:         b.src,
+		srcLen:      b.srcLen,
+		q:           append(edits(nil), b.q...),
+		sources:     b.sources,
+		rewrites:    b.rewrites,
+		cacheResult: b.cacheResult,
+		maxOutput:   b.maxOutput,
+		checkUTF8:   b.checkUTF8,
+		dedupe:      b.dedupe,
+		large:       b.large,
+		eol:         b.eol,
+		tabWidth:    b.tabWidth,
+		conflict:    b.conflict,
+		onDrop:      b.onDrop,
+		lines:       b.lines,
+	}
+	if b.markers != nil {
+		c.markers = make(map[string]int, len(b.markers))
+		for name, off := range b.markers {
+			c.markers[name] = off
+		}
+	}
+	return c
+}
+
+// Reset discards the queued edits and named markers and makes b a buffer
+// for the data old, as if newly returned by NewBuffer(old), except that b
+// keeps the memory allocated for its queue, for reuse. Reset allows a pool
+// of Buffers to avoid allocating a new queue for each use.
+func (b *Buffer) Reset(old []byte) {
+	b.reset()
+	b.old = old
+}
+
+// ResetString is like Reset but makes b a buffer for the string old,
+// as if newly returned by NewBufferString(old).
+func (b *Buffer) ResetString(old string) {
+	b.reset()
+	b.str = old
+}
+
+// reset makes b an empty buffer, keeping its queue's capacity.
+func (b *Buffer) reset() {
+	q := b.q[:cap(b.q)]
+	for i := range q {
+		q[i] = edit{} // release replacement text
+	}
+	*b = Buffer{q: q[:0], rewrites: b.rewrites + 1}
+}
+
 // contentsLen returns the length of the original data.
 func (b *Buffer) contentsLen() int {
 	if b.old != nil {
 		return len(b.old)
 	}
+	if b.src != nil {
+		return b.srcLen
+	}
 	return len(b.str)
 }
 
+// sameContents reports whether b and c have the same original data.
+func (b *Buffer) sameContents(c *Buffer) bool {
+	switch {
+	case b.src != nil || c.src != nil:
+		n := b.contentsLen()
+		return c.contentsLen() == n && b.text(0, n) == c.text(0, n)
+	case b.old != nil && c.old != nil:
+		return bytes.Equal(b.old, c.old)
+	case b.old != nil:
+		return string(b.old) == c.str
+	case c.old != nil:
+		return b.str == string(c.old)
+	}
+	return b.str == c.str
+}
+
+// byteAt returns the original byte at offset off.
+func (b *Buffer) byteAt(off int) byte {
+	if b.old != nil {
+		return b.old[off]
+	}
+	if b.src != nil {
+		return b.readSrc(off, off+1)[0]
+	}
+	return b.str[off]
+}
+
+// text returns the original data in [start, end) as a string.
+func (b *Buffer) text(start, end int) string {
+	if b.old != nil {
+		return string(b.old[start:end])
+	}
+	if b.src != nil {
+		return unsafeString(b.readSrc(start, end))
+	}
+	return b.str[start:end]
+}
+
 // Insert inserts the new string at old[pos:pos].
+// Several insertions at the same position appear in the order they were
+// queued; see InsertBefore and InsertAfter for other orders.
 func (b *Buffer) Insert(pos int, new string) {
-	if pos < 0 || pos > b.contentsLen() {
+	if !b.batching && (pos < 0 || pos > b.contentsLen()) {
 		panic("invalid edit position")
 	}
-	b.q = append(b.q, edit{pos, pos, new})
+	b.checkRunes(pos, pos)
+	if b.eol != "" {
+		new = matchEOL(new, b.eol)
+	}
+	b.q = append(b.q, edit{start: pos, end: pos, new: new})
+	b.appended()
 }
 
 // Delete deletes the text old[start:end].
 func (b *Buffer) Delete(start, end int) {
-	if end < start || start < 0 || end > b.contentsLen() {
+	if !b.batching && (end < start || start < 0 || end > b.contentsLen()) {
 		panic("invalid edit position")
 	}
-	b.q = append(b.q, edit{start, end, ""})
+	b.checkRunes(start, end)
+	b.q = append(b.q, edit{start: start, end: end})
+	b.appended()
 }
 
 // Replace replaces old[start:end] with new.
 func (b *Buffer) Replace(start, end int, new string) {
+	if !b.batching && (end < start || start < 0 || end > b.contentsLen()) {
+		panic("invalid edit position")
+	}
+	b.checkRunes(start, end)
+	if b.eol != "" {
+		new = matchEOL(new, b.eol)
+	}
+	b.q = append(b.q, edit{start: start, end: end, new: new})
+	b.appended()
+}
+
+// ReplaceLabeled is like Replace, but attaches label to the edit, describing
+// where it came from, such as the name of the rewrite rule that queued it and
+// the position that triggered the rule. Labels appear in conflict errors and
+// panics, in Debug and AuditRanges, and in the hunk headers of unified diffs,
+// so that a conflict among edits queued by many rules can be traced to them.
+// Insertions and deletions can be labeled too: Replace(pos, pos, new, label)
+// inserts new, and Replace(start, end, "", label) deletes.
+func (b *Buffer) ReplaceLabeled(start, end int, new, label string) {
+	b.Replace(start, end, new)
+	b.q[len(b.q)-1].label = label
+}
+
+// InsertBytes is like Insert but takes the new text as a byte slice.
+// To avoid copying large replacement text, b keeps a reference to new,
+// so the caller must ensure new is not modified until after b is done being used,
+// as for the data passed to NewBuffer.
+func (b *Buffer) InsertBytes(pos int, new []byte) {
+	b.Insert(pos, unsafeString(new))
+}
+
+// ReplaceBytes is like Replace but takes the new text as a byte slice.
+// As with InsertBytes, b keeps a reference to new, which must not be modified.
+func (b *Buffer) ReplaceBytes(start, end int, new []byte) {
+	b.Replace(start, end, unsafeString(new))
+}
+
+// unsafeString returns a string sharing the memory of p, which must not be modified afterward.
+func unsafeString(p []byte) string {
+	return *(*string)(unsafe.Pointer(&p))
+}
+
+// Add queues each of edits, in order, as if by Replace.
+// Together with Edits, it allows edits to be filtered, transformed,
+// or combined from several buffers: b.Add(c.Edits()...) queues
+// the edits of c in b. Add panics if an edit is invalid.
+func (b *Buffer) Add(edits ...Edit) {
+	for _, e := range edits {
+		b.Replace(e.Start, e.End, e.New)
+	}
+}
+
+// OriginalLen returns the length of the original data.
+func (b *Buffer) OriginalLen() int {
+	return b.contentsLen()
+}
+
+// Append inserts new at the end of the original data.
+// It is shorthand for Insert(b.OriginalLen(), new).
+func (b *Buffer) Append(new string) {
+	b.Insert(b.contentsLen(), new)
+}
+
+// Prepend inserts new at the start of the original data.
+// It is shorthand for Insert(0, new).
+func (b *Buffer) Prepend(new string) {
+	b.Insert(0, new)
+}
+
+// InsertRel is like Insert, but pos is relative to the end of the original
+// data: it is at most zero, with 0 the end of the data and -len(old) its start.
+// For example, InsertRel(0, s) appends s and InsertRel(-1, s) inserts s
+// before the last byte.
+func (b *Buffer) InsertRel(pos int, new string) {
+	b.Insert(b.contentsLen()+pos, new)
+}
+
+// DeleteRel is like Delete, but start and end are relative to the end of the
+// original data, as for InsertRel. For example, DeleteRel(-1, 0) deletes the last byte.
+func (b *Buffer) DeleteRel(start, end int) {
+	n := b.contentsLen()
+	b.Delete(n+start, n+end)
+}
+
+// ReplaceRel is like Replace, but start and end are relative to the end of the
+// original data, as for InsertRel.
+func (b *Buffer) ReplaceRel(start, end int, new string) {
+	n := b.contentsLen()
+	b.Replace(n+start, n+end, new)
+}
+
+// Undo removes the most recently queued edit, reporting false if there
+// are no queued edits.
+func (b *Buffer) Undo() bool {
+	if len(b.q) == 0 {
+		return false
+	}
+	b.q[len(b.q)-1] = edit{} // release replacement text
+	b.q = b.q[:len(b.q)-1]
+	b.invalidate()
+	return true
+}
+
+// Len returns the number of queued edits.
+func (b *Buffer) Len() int {
+	return len(b.q)
+}
+
+// A Mark records the state of a Buffer's queue, for Rollback.
+type Mark struct {
+	n       int // length of the queue
+	rewrite int // Buffer.rewrites at the time
+}
+
+// Checkpoint returns a Mark recording the edits queued so far,
+// so that edits queued speculatively after it can be discarded by Rollback.
+func (b *Buffer) Checkpoint() Mark {
+	return Mark{n: len(b.q), rewrite: b.rewrites}
+}
+
+// Rollback removes the edits queued since m was returned by Checkpoint.
+// Marks may be nested: rolling back to a mark discards any later marks too.
+// Rollback panics if m is no longer valid, because edits queued before it
+// have been removed by Undo or an earlier Rollback, or the queue has been
+// rewritten as a whole, as by Optimize or Truncate.
+func (b *Buffer) Rollback(m Mark) {
+	if !b.markValid(m) {
+		panic("invalid mark")
+	}
+	for i := m.n; i < len(b.q); i++ {
+		b.q[i] = edit{} // release replacement text
+	}
+	b.q = b.q[:m.n]
+	b.invalidate()
+}
+
+// markValid reports whether m can be passed to Rollback.
+func (b *Buffer) markValid(m Mark) bool {
+	return m.rewrite == b.rewrites && m.n <= len(b.q)
+}
+
+// TryInsert is like Insert but returns an error instead of panicking
+// if pos is out of range.
+func (b *Buffer) TryInsert(pos int, new string) error {
+	if err := b.checkRange(pos, pos); err != nil {
+		return err
+	}
+	b.Insert(pos, new)
+	return nil
+}
+
+// TryDelete is like Delete but returns an error instead of panicking
+// if the range is invalid.
+func (b *Buffer) TryDelete(start, end int) error {
+	if err := b.checkRange(start, end); err != nil {
+		return err
+	}
+	b.Delete(start, end)
+	return nil
+}
+
+// TryReplace is like Replace but returns an error instead of panicking
+// if the range is invalid.
+func (b *Buffer) TryReplace(start, end int, new string) error {
+	if err := b.checkRange(start, end); err != nil {
+		return err
+	}
+	b.Replace(start, end, new)
+	return nil
+}
+
+// ReplaceExpect is like TryReplace, but it also checks that the original data
+// in [start, end) is expectOld, returning a *MismatchError if not, as for edits
+// computed against a version of the data that may be stale.
+// It queues no edit if it returns an error.
+func (b *Buffer) ReplaceExpect(start, end int, expectOld, new string) error {
+	if err := b.checkRange(start, end); err != nil {
+		return err
+	}
+	if got := b.text(start, end); got != expectOld {
+		return &MismatchError{Start: start, End: end, Want: expectOld, Got: got}
+	}
+	b.Replace(start, end, new)
+	return nil
+}
+
+// DeleteExpect is like ReplaceExpect, but deletes old[start:end].
+func (b *Buffer) DeleteExpect(start, end int, expectOld string) error {
+	return b.ReplaceExpect(start, end, expectOld, "")
+}
+
+// A MismatchError reports an edit rejected by ReplaceExpect or DeleteExpect
+// because the original data in its range was not the expected text.
+type MismatchError struct {
+	Start, End int    // the range of the rejected edit
+	Want, Got  string // the expected and actual original text
+}
+
+func (err *MismatchError) Error() string {
+	return fmt.Sprintf("edit: original data at [%d,%d) is %q, want %q", err.Start, err.End, err.Got, err.Want)
+}
+
+// A PositionError reports an edit whose positions are not valid
+// for the original data, as returned by TryInsert, TryDelete, TryReplace, and Batch.
+type PositionError struct {
+	Start, End int  // the range of the rejected edit; Start == End for an insertion
+	Len        int  // the length of the original data
+	SplitsRune bool // the range is valid, but UTF-8 checking is on and it splits a UTF-8 sequence
+}
+
+func (err *PositionError) Error() string {
+	if err.SplitsRune {
+		return fmt.Sprintf("edit: edit position [%d,%d) splits a UTF-8 sequence", err.Start, err.End)
+	}
+	return fmt.Sprintf("edit: invalid edit position [%d,%d) in data of length %d", err.Start, err.End, err.Len)
+}
+
+// checkRange returns a *PositionError if [start, end) is not a range of the original data,
+// or if UTF-8 checking is on and the range splits a UTF-8 sequence.
+func (b *Buffer) checkRange(start, end int) error {
+	n := b.contentsLen()
+	if end < start || start < 0 || end > n {
+		return &PositionError{Start: start, End: end, Len: n}
+	}
+	if b.checkUTF8 && (!b.runeStart(start) || !b.runeStart(end)) {
+		return &PositionError{Start: start, End: end, Len: n, SplitsRune: true}
+	}
+	return nil
+}
+
+// CheckUTF8 sets whether b checks that the positions of new edits fall on
+// UTF-8 sequence boundaries of the original data, so that edits made in terms
+// of characters cannot produce invalid UTF-8 by splitting one. When checking
+// is on, Insert, Delete, and Replace panic, and the Try variants return an error,
+// if a position is in the middle of a UTF-8 sequence. Checking is off by default.
+func (b *Buffer) CheckUTF8(on bool) {
+	b.checkUTF8 = on
+}
+
+// checkRunes panics if UTF-8 checking is on and the valid range [start, end)
+// splits a UTF-8 sequence.
+func (b *Buffer) checkRunes(start, end int) {
+	if b.checkUTF8 && !b.batching && (!b.runeStart(start) || !b.runeStart(end)) {
+		panic("edit position splits UTF-8 sequence")
+	}
+}
+
+// Insertions at the same position appear in the edited data in the order
+// they were queued, except that those queued with InsertBefore come first
+// and those queued with InsertAfter come last. For finer control, as when
+// insertions come from independent rewrite passes, InsertWithPriority orders
+// insertions by an explicit priority.
+//
+// An insertion at pos always follows the replacement text of an edit
+// ending at pos and precedes that of an edit starting at pos: given
+// Replace(a, b, r1), Replace(b, c, r2), and an insertion of s at b,
+// the edited data contains r1, s, r2 in that order, whichever of Insert,
+// InsertBefore, or InsertAfter queued s. To place text before r1,
+// insert it at a instead; to place it after r2, insert it at c.
+
+// InsertBefore is like Insert, but the new string appears in the edited data
+// before those of other insertions at pos queued with Insert or InsertAfter.
+func (b *Buffer) InsertBefore(pos int, new string) {
+	b.Insert(pos, new)
+	b.q[len(b.q)-1].priority = -1
+}
+
+// InsertAfter is like Insert, but the new string appears in the edited data
+// after those of other insertions at pos queued with Insert or InsertBefore.
+func (b *Buffer) InsertAfter(pos int, new string) {
+	b.Insert(pos, new)
+	b.q[len(b.q)-1].priority = 1
+}
+
+// InsertWithPriority is like Insert, but the new string appears in the edited data
+// after those of other insertions at pos with lower priority and before those with
+// higher priority, and in the order queued among those with the same priority.
+// Insert queues insertions with priority 0, InsertBefore with priority -1,
+// and InsertAfter with priority 1.
+func (b *Buffer) InsertWithPriority(pos int, new string, prio int) {
+	b.Insert(pos, new)
+	b.q[len(b.q)-1].priority = prio
+}
+
+// DeleteInclusive deletes the text old[start:endInclusive+1].
+// It is like Delete but takes the position of the last byte to delete,
+// for use with sources that report inclusive ranges.
+func (b *Buffer) DeleteInclusive(start, endInclusive int) {
+	if endInclusive < start || start < 0 || endInclusive >= b.contentsLen() {
+		panic("invalid edit position")
+	}
+	b.Delete(start, endInclusive+1)
+}
+
+// ReplaceInclusive replaces old[start:endInclusive+1] with new.
+// It is like Replace but takes the position of the last byte to replace,
+// for use with sources that report inclusive ranges.
+func (b *Buffer) ReplaceInclusive(start, endInclusive int, new string) {
+	if endInclusive < start || start < 0 || endInclusive >= b.contentsLen() {
+		panic("invalid edit position")
+	}
+	b.Replace(start, endInclusive+1, new)
+}
+
+// ReplaceFunc replaces old[start:end] with f(old[start:end]).
+// f is called immediately, with the original text, not the text as
+// changed by other queued edits. Unlike Replace, ReplaceFunc checks
+// the range even within Batch, since f needs the text.
+func (b *Buffer) ReplaceFunc(start, end int, f func(old string) string) {
+	if end < start || start < 0 || end > b.contentsLen() {
+		panic("invalid edit position")
+	}
+	b.Replace(start, end, f(b.text(start, end)))
+}
+
+// ReplaceLazy replaces old[start:end] with the text returned by f, which
+// is not called until the edits are applied, as by WriteTo or Bytes.
+// f is passed the original text, not the text as changed by other queued
+// edits, and must not modify or retain it. Each time the edits are applied,
+// f is called again, after the functions of the lazy edits before it
+// in the order edits are applied; see also ReplaceFunc.
+func (b *Buffer) ReplaceLazy(start, end int, f func(old []byte) []byte) {
+	b.Replace(start, end, "")
+	b.q[len(b.q)-1].lazy = f
+}
+
+// Transform replaces old[start:end] with f applied to it, as for case folding,
+// escaping, or reindenting a range. It is the same as ReplaceLazy: f is called
+// with the original text each time the edits are applied.
+func (b *Buffer) Transform(start, end int, f func([]byte) []byte) {
+	b.ReplaceLazy(start, end, f)
+}
+
+// hasLazy reports whether x contains any lazy edits.
+func (x edits) hasLazy() bool {
+	for _, e := range x {
+		if e.lazy != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// Truncate shortens the original data to its first length bytes, as when only
+// part of it turned out to be available. Queued edits that reach past the new
+// end (see EditsBeyond) are dropped, or if clamp is set, cut short at the new end:
+// their range is intersected with [0, length), and insertions past the end move to it.
+// Named markers past the new end are removed.
+// Truncate panics if length is negative or greater than the current length.
+func (b *Buffer) Truncate(length int, clamp bool) {
+	if length < 0 || length > b.contentsLen() {
+		panic("invalid truncation length")
+	}
+	if b.old != nil {
+		b.old = b.old[:length]
+	} else if b.src != nil {
+		b.srcLen = length
+	} else {
+		b.str = b.str[:length]
+	}
+	b.lines = nil
+	q := b.q[:0]
+	for _, e := range b.q {
+		if e.end > length {
+			if !clamp {
+				continue
+			}
+			e.end = length
+			if e.start > length {
+				e.start = length
+			}
+		}
+		q = append(q, e)
+	}
+	b.q = q
+	b.rewrites++
+	b.invalidate()
+	for name, off := range b.markers {
+		if off > length {
+			delete(b.markers, name)
+		}
+	}
+}
+
+// Clear discards all queued edits, keeping the original data, named markers,
+// and settings such as the conflict policy.
+func (b *Buffer) Clear() {
+	for i := range b.q {
+		b.q[i] = edit{} // release replacement text
+	}
+	b.q = b.q[:0]
+	b.rewrites++
+	b.invalidate()
+}
+
+// ClearRange discards the queued edits that touch the original range
+// [start, end), as reported by EditsIn, and returns the number discarded,
+// as when resolving a conflict between rewrite passes in favor of one of them.
+// ClearRange panics if [start, end) is not a range of the original data.
+func (b *Buffer) ClearRange(start, end int) int {
 	if end < start || start < 0 || end > b.contentsLen() {
 		panic("invalid edit position")
 	}
-	b.q = append(b.q, edit{start, end, new})
+	q := b.q[:0]
+	for _, e := range b.q {
+		if !e.touches(start, end, start == end) {
+			q = append(q, e)
+		}
+	}
+	n := len(b.q) - len(q)
+	for i := len(q); i < len(b.q); i++ {
+		b.q[i] = edit{} // release replacement text
+	}
+	b.q = q
+	b.rewrites++
+	b.invalidate()
+	return n
+}
+
+// Optimize replaces the queued edits with the equivalent normalized edits
+// (see EditsHash), which produce the same edited data: overlapping and
+// abutting deletions are merged, empty insertions are removed, and edits with
+// no unchanged data between them, such as an insertion at the start of a
+// replacement, are combined into one. Soft edits that would be dropped are
+// removed. Afterward, the queue holds the edits in the order they are applied,
+// so Undo removes the last of them. Optimize panics if two edits overlap.
+//
+// An edit that is not combined with others keeps its label (see ReplaceLabeled);
+// combined edits have none. Priorities and merge sources are discarded,
+// having already determined the order of the edits, and lazy edits
+// (see ReplaceLazy) become plain replacements with the text computed now.
+func (b *Buffer) Optimize() {
+	labels := make(map[Edit]string)
+	for _, e := range b.applied() {
+		if _, ok := labels[e.spec()]; !ok && e.label != "" {
+			labels[e.spec()] = e.label
+		}
+	}
+	specs := b.normalized()
+	q := make(edits, len(specs))
+	for i, s := range specs {
+		q[i] = edit{start: s.Start, end: s.End, new: s.New, label: labels[s]}
+	}
+	b.q = q
+	b.rewrites++
+	b.invalidate()
+}
+
+// Type inserts s at the original offset cursor, as typing at a cursor
+// in an editor would, and returns the offset in the edited data
+// just past the inserted text, before any insertions at cursor that follow it,
+// such as those queued by InsertAfter.
+func (b *Buffer) Type(cursor int, s string) (newCursor int) {
+	b.Insert(cursor, s)
+	// The insertion is applied last among those at cursor with the default
+	// priority, which were all queued before it.
+	q := b.applied()
+	newCursor = b.Offset(cursor)
+	for i, p := range b.placedQueue(q) {
+		if e := q[i]; e.start == cursor && e.end == cursor && e.priority == 0 {
+			newCursor = p.OutEnd
+		}
+	}
+	return newCursor
 }
 
 // Bytes returns a new byte slice containing the original data
 // with the queued edits applied.
+// If result caching is enabled, the returned slice is shared
+// between calls and must not be modified; see SetCacheResult.
 func (b *Buffer) Bytes() []byte {
-	buf := new(bytes.Buffer)
-	b.WriteTo(buf)
-	return buf.Bytes()
+	if b.cacheResult {
+		return b.cached().data
+	}
+	return b.build()
 }
 
 // String returns a string containing the original data
 // with the queued edits applied.
 func (b *Buffer) String() string {
-	buf := new(strings.Builder)
-	b.WriteTo(buf)
-	return buf.String()
+	if b.cacheResult {
+		c := b.cached()
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if !c.hasStr {
+			c.str = string(c.data)
+			c.hasStr = true
+		}
+		return c.str
+	}
+	// The slice from build is not shared, so it can become the string without copying.
+	return unsafeString(b.build())
+}
+
+// SetCacheResult sets whether b memoizes its output, so that repeated
+// calls to Bytes and String with no intervening changes to b do not
+// recompute it. Any change to b, such as queueing an edit, discards the
+// memoized output. Caching is off by default, to avoid holding on to a
+// copy of the output; turning it off discards any memoized output.
+// While caching is on, the slice returned by Bytes must not be modified.
+func (b *Buffer) SetCacheResult(on bool) {
+	b.cacheResult = on
+	b.cache = nil
+}
+
+// cached returns the memoized output of b, computing it if necessary.
+func (b *Buffer) cached() *cachedResult {
+	b.mu.Lock()
+	c := b.cache
+	b.mu.Unlock()
+	if c == nil {
+		// Build without holding b.mu, which build needs.
+		// Concurrent callers may each build the output; one of them is kept.
+		data := b.build()
+		b.mu.Lock()
+		if b.cache == nil {
+			b.cache = &cachedResult{data: data}
+		}
+		c = b.cache
+		b.mu.Unlock()
+	}
+	return c
+}
+
+// invalidate discards the memoized output of b.
+// It must be called by every method that changes the output,
+// except that those that only append to the queue may call appended instead.
+func (b *Buffer) invalidate() {
+	b.cache = nil
+	b.snap = nil
+	b.dropsReported = false
+}
+
+// appended discards the memoized output of b after edits are appended
+// to its queue. A large buffer keeps the sorted edits queued before them,
+// for sortedQueue to merge the appended ones into.
+func (b *Buffer) appended() {
+	if !b.large {
+		b.invalidate()
+		return
+	}
+	b.cache = nil
+	b.dropsReported = false
 }
 
-// WriteTo writed the data with queued edits applied to w.
+// WriteTo writes the data with queued edits applied to w.
+// It implements io.WriterTo: n is the number of bytes written,
+// and err is the first error returned by w, after which WriteTo stops.
+// Unchanged data and replacement text are written to w as they are reached,
+// using w's WriteString method when available. WriteTo never flushes or closes w.
+//
+// If two edits overlap in a way that cannot be merged, WriteTo stops when it
+// reaches them and returns a *ConflictError describing them, or panics if
+// the conflict policy is ConflictPanic; see OnConflict.
 func (b *Buffer) WriteTo(w io.Writer) (n int64, err error) {
+	n, err = b.writeQueue(w, b.applied())
+	return n, b.overlapErr(err)
+}
+
+// writeAll writes the data with queued edits applied to w, which must not fail,
+// for methods such as Bytes that cannot return an error.
+// It panics if two edits overlap or the output is too large.
+func (b *Buffer) writeAll(w io.Writer) {
+	_, err := b.writeQueue(w, b.applied())
+	if err == ErrOutputTooLarge {
+		panic("output exceeds maximum size")
+	}
+	panicOnOverlap(err)
+}
+
+// Apply returns a new byte slice containing the original data with the
+// queued edits applied, like Bytes. If two edits overlap, Apply returns
+// a *ConflictError describing them instead of panicking.
+func (b *Buffer) Apply() ([]byte, error) {
+	buf := new(bytes.Buffer)
+	if _, err := b.writeQueue(buf, b.applied()); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// ApplyString is like Apply but returns a string, like String.
+func (b *Buffer) ApplyString() (string, error) {
+	buf := new(strings.Builder)
+	if _, err := b.writeQueue(buf, b.applied()); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// Validate checks that the queued edits can be applied, without producing
+// the edited data. If two edits overlap in a way that cannot be merged, so that
+// Bytes would panic, Validate returns a *ConflictError describing them.
+// Overlapping deletions are valid.
+func (b *Buffer) Validate() error {
+	return b.walkErr(nopSpan, nopRepl)
+}
+
+// writeQueue writes the original data with the sorted edits q applied to w.
+// It returns a *ConflictError if two edits overlap,
+// and ErrOutputTooLarge, without writing anything, if the output is too large.
+func (b *Buffer) writeQueue(w io.Writer, q edits) (n int64, err error) {
+	if b.tooLarge(q) {
+		return 0, ErrOutputTooLarge
+	}
+	err = b.walkQueue(q, func(start, end int) error {
+		m, err := b.writeSpan(w, start, end)
+		n += int64(m)
+		return err
+	}, func(start, end int, new string) error {
+		if new == "" {
+			return nil
+		}
+		m, err := io.WriteString(w, new)
+		n += int64(m)
+		return err
+	})
+	return n, err
+}
+
+// AppendTo appends the data with queued edits applied to dst
+// and returns the extended slice, growing dst at most once.
+// Overlapping edits cause a panic, as with Bytes.
+func (b *Buffer) AppendTo(dst []byte) []byte {
+	if n := b.ResultLen(); cap(dst)-len(dst) < n {
+		dst = append(dst, make([]byte, n)...)[:len(dst)]
+	}
+	return b.appendTo(dst)
+}
+
+// appendTo appends the data with queued edits applied to dst.
+func (b *Buffer) appendTo(dst []byte) []byte {
+	return b.appendQueue(dst, b.applied())
+}
+
+// appendQueue appends the original data with the sorted edits q applied to dst.
+// It panics if two edits overlap or the output is too large.
+func (b *Buffer) appendQueue(dst []byte, q edits) []byte {
+	if b.tooLarge(q) {
+		panic("output exceeds maximum size")
+	}
+	panicOnOverlap(b.walkQueue(q, func(start, end int) error {
+		if b.old != nil {
+			dst = append(dst, b.old[start:end]...)
+		} else if b.src != nil {
+			n := len(dst)
+			dst = append(dst, make([]byte, end-start)...)
+			b.readSrcAt(dst[n:], start)
+		} else {
+			dst = append(dst, b.str[start:end]...)
+		}
+		return nil
+	}, func(start, end int, new string) error {
+		dst = append(dst, new...)
+		return nil
+	}))
+	return dst
+}
+
+// build returns a new slice holding the data with queued edits applied,
+// allocated once at its exact length. It panics if two edits overlap.
+func (b *Buffer) build() []byte {
+	q := b.applied()
+	n := 0
+	panicOnOverlap(b.walkQueue(q, func(start, end int) error {
+		n += end - start
+		return nil
+	}, func(start, end int, new string) error {
+		n += len(new)
+		return nil
+	}))
+	return b.appendQueue(make([]byte, 0, n), q)
+}
+
+// writeSpan writes the original data in [start, end) to w.
+func (b *Buffer) writeSpan(w io.Writer, start, end int) (int, error) {
+	if b.old != nil {
+		return w.Write(b.old[start:end])
+	}
+	if b.src != nil {
+		n, err := io.CopyN(w, io.NewSectionReader(b.src, int64(start), int64(end-start)), int64(end-start))
+		if err == io.EOF {
+			// The source is shorter than the length given for it.
+			err = io.ErrUnexpectedEOF
+		}
+		return int(n), err
+	}
+	return io.WriteString(w, b.str[start:end])
+}
+
+// ResultLen returns the length of the data with queued edits applied,
+// without materializing it.
+func (b *Buffer) ResultLen() int {
+	n, err := b.TryResultLen()
+	panicOnOverlap(err)
+	return n
+}
+
+// TryResultLen is like ResultLen but returns a *ConflictError instead of
+// panicking if two edits overlap.
+func (b *Buffer) TryResultLen() (int, error) {
+	n := 0
+	err := b.walkErr(func(start, end int) error {
+		n += end - start
+		return nil
+	}, func(start, end int, new string) error {
+		n += len(new)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// OutputLen returns the number of bytes Bytes would return.
+// It is the same as ResultLen.
+func (b *Buffer) OutputLen() int {
+	return b.ResultLen()
+}
+
+// Stats returns the number of bytes of text the queued edits insert and delete.
+// Replacing n bytes with m bytes deletes n and inserts m; overlapping deletions
+// count each deleted byte once. The edited data is thus
+// ResultLen() == len(original) + inserted - deleted bytes long.
+func (b *Buffer) Stats() (inserted, deleted int) {
+	b.walk(nopSpan, func(start, end int, new string) error {
+		inserted += len(new)
+		deleted += end - start
+		return nil
+	})
+	return inserted, deleted
+}
+
+// ChangeCount returns the number of places where the queued edits change the
+// data, for summaries such as "rewrote 12 bytes in 3 places": the number of
+// normalized edits (see EditsHash) that do not replace text with identical text.
+// Use Changed to learn whether the edited data differs from the original at all.
+func (b *Buffer) ChangeCount() int {
+	n := 0
+	for _, s := range b.normalized() {
+		if s.End-s.Start != len(s.New) || !b.hasText(s.Start, s.New) {
+			n++
+		}
+	}
+	return n
+}
+
+// ResultEmpty reports whether the data with queued edits applied is empty.
+func (b *Buffer) ResultEmpty() bool {
+	return b.ResultLen() == 0
+}
+
+// errStopWalk is returned by walk callbacks to end the walk early.
+var errStopWalk = errors.New("stop walk")
+
+// Offset returns the offset in the edited data corresponding to the offset
+// pos in the original data, accounting for the queued edits.
+// Text inserted at pos lands before the returned offset, so insertions
+// at pos shift it forward. A position inside a replaced or deleted range,
+// including at its start, maps to the start of its replacement text.
+// Offset panics if pos is not in [0, len(original)].
+func (b *Buffer) Offset(pos int) int {
+	return b.offset(pos, GravityRight)
+}
+
+// offset is Offset, but for GravityLeft, text inserted at pos lands after the returned offset.
+func (b *Buffer) offset(pos int, g Gravity) int {
+	if pos < 0 || pos > b.contentsLen() {
+		panic("invalid offset")
+	}
+	out := 0
+	b.walk(func(start, end int) error {
+		if pos < end {
+			out += pos - start
+			return errStopWalk
+		}
+		out += end - start
+		return nil
+	}, func(start, end int, new string) error {
+		if pos < end || g == GravityLeft && start == pos {
+			return errStopWalk
+		}
+		out += len(new)
+		return nil
+	})
+	return out
+}
+
+// walk applies the queued edits in order.
+// It calls span for each non-empty range [start, end) of the original data
+// that is kept, and repl for each applied edit with the range of original data
+// it removes and its replacement text, in output order.
+// Overlapping deletes are merged, so the ranges passed to repl never overlap.
+// walk stops at and returns the first error returned by span or repl.
+// It panics if two edits overlap in a way that cannot be merged.
+func (b *Buffer) walk(span func(start, end int) error, repl func(start, end int, new string) error) error {
+	return panicOnOverlap(b.walkErr(span, repl))
+}
+
+// walkErr is like walk but returns a *ConflictError instead of panicking
+// when two edits overlap.
+func (b *Buffer) walkErr(span func(start, end int) error, repl func(start, end int, new string) error) error {
+	return b.walkQueue(b.applied(), span, repl)
+}
+
+// overlapErr returns err, for methods that return a *ConflictError when two edits
+// overlap, but panics instead if err is one and the policy is ConflictPanic.
+func (b *Buffer) overlapErr(err error) error {
+	if b.conflict == ConflictPanic {
+		return panicOnOverlap(err)
+	}
+	return err
+}
+
+// panicOnOverlap panics if err is a *ConflictError and otherwise returns err.
+func panicOnOverlap(err error) error {
+	if err, ok := err.(*ConflictError); ok {
+		panic(err.message())
+	}
+	return err
+}
+
+// Canonicalize is like Optimize, but first removes each queued replacement
+// or deletion that is identical to one queued before it, as when several tools
+// independently queue the same fix. Identical insertions are all kept, since
+// each inserts its text. Canonicalize panics if two edits that are not
+// identical overlap.
+func (b *Buffer) Canonicalize() {
+	type key struct {
+		start, end int
+		new        string
+	}
+	seen := make(map[key]bool)
+	q := b.q[:0]
+	for _, e := range b.q {
+		if e.start < e.end && e.lazy == nil {
+			k := key{e.start, e.end, e.new}
+			if seen[k] {
+				continue
+			}
+			seen[k] = true
+		}
+		q = append(q, e)
+	}
+	for i := len(q); i < len(b.q); i++ {
+		b.q[i] = edit{} // release replacement text
+	}
+	b.q = q
+	b.invalidate()
+	b.Optimize()
+}
+
+// applied returns the queued edits to apply, in the order to apply them.
+func (b *Buffer) applied() edits {
 	// Sort edits by starting position and then by ending position.
 	// Breaking ties by ending position allows insertions at point x
 	// to be applied before a replacement of the text at [x, y).
-	sort.Stable(b.q)
+	// Sort a copy, so that the queue stays in the order edits were queued,
+	// unless the queue is already sorted.
+	q := b.q
+	if q.hasLazy() {
+		q = b.sorted()
+	} else if !q.isSorted() {
+		q = b.sortedQueue()
+	}
+	if b.dedupe {
+		q = dedupe(q)
+	}
+	if q.hasSoft() {
+		q, _ = resolveSoft(q)
+	}
+	if b.conflict == ConflictFirstWins || b.conflict == ConflictLastWins {
+		var dropped edits
+		q, dropped = resolveConflicts(q, b.conflict == ConflictLastWins)
+		if b.onDrop != nil && len(dropped) > 0 && b.reportDrops() {
+			for _, e := range dropped {
+				b.onDrop(e.spec())
+			}
+		}
+	}
+	return q
+}
 
-	var total int64
-	write := func(p []byte) error {
-		n, err := w.Write(p)
-		total += int64(n)
-		return err
+// reportDrops reports whether the edits dropped by conflict from the current
+// queue are yet to be passed to onDrop, and records that they have been.
+func (b *Buffer) reportDrops() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.dropsReported {
+		return false
 	}
-	writeStr := func(s string) error {
-		n, err := io.WriteString(w, s)
-		total += int64(n)
-		return err
+	b.dropsReported = true
+	return true
+}
+
+// nopSpan and nopRepl are walk callbacks that do nothing.
+func nopSpan(start, end int) error             { return nil }
+func nopRepl(start, end int, new string) error { return nil }
+
+// A ConflictError reports two queued edits that overlap in a way that cannot be merged,
+// so that the edits cannot be applied.
+type ConflictError struct {
+	A, B Edit // the conflicting edits, in the order they are applied
+
+	ALabel, BLabel string // the labels of A and B, if any; see ReplaceLabeled
+}
+
+func (err *ConflictError) Error() string {
+	return "edit: " + err.message()
+}
+
+// message describes the conflict, as in the panics of methods such as Bytes.
+func (err *ConflictError) message() string {
+	a, b := err.A, err.B
+	return fmt.Sprintf("overlapping edits: [%d,%d)->%q%s, [%d,%d)->%q%s", a.Start, a.End, a.New, labelSuffix(err.ALabel), b.Start, b.End, b.New, labelSuffix(err.BLabel))
+}
+
+// labelSuffix returns the label of an edit formatted to follow its description,
+// or "" if the edit has no label.
+func labelSuffix(label string) string {
+	if label == "" {
+		return ""
 	}
+	return " (" + label + ")"
+}
 
+// walkQueue is like walkErr but applies the sorted edits q instead of the queued edits.
+func (b *Buffer) walkQueue(q edits, span func(start, end int) error, repl func(start, end int, new string) error) error {
 	offset := 0
-	for i, e := range b.q {
+	var e0 edit // the last edit applied, which ended at offset
+	for _, e := range q {
 		start := e.start
 		if start < offset {
-			e0 := b.q[i-1]
 			if e.new != "" || e0.new != "" {
-				panic(fmt.Sprintf("overlapping edits: [%d,%d)->%q, [%d,%d)->%q", e0.start, e0.end, e0.new, e.start, e.end, e.new))
+				return &ConflictError{A: e0.spec(), B: e.spec(), ALabel: e0.label, BLabel: e.label}
 			}
 			// Both edits are deletes, which can be safely merged.
 			if e.end < e0.end {
@@ -135,23 +1368,19 @@ func (b *Buffer) WriteTo(w io.Writer) (n int64, err error) {
 			// Start deleting where e0 left off.
 			start = offset
 		}
-		if b.old != nil {
-			err = write(b.old[offset:start])
-		} else {
-			err = writeStr(b.str[offset:start])
-		}
-		if err != nil {
-			return total, err
+		if start > offset {
+			if err := span(offset, start); err != nil {
+				return err
+			}
 		}
 		offset = e.end
-		if err := writeStr(e.new); err != nil {
-			return total, err
+		e0 = e
+		if err := repl(start, e.end, e.new); err != nil {
+			return err
 		}
 	}
-	if b.old != nil {
-		err = write(b.old[offset:])
-	} else {
-		err = writeStr(b.str[offset:])
+	if n := b.contentsLen(); n > offset {
+		return span(offset, n)
 	}
-	return total, err
+	return nil
 }
@@ -4,7 +4,17 @@
 
 package edit
 
-import "testing"
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
 
 func TestEdit(t *testing.T) {
 	b := NewBuffer([]byte("0123456789"))
@@ -25,6 +35,9 @@ func TestEdit(t *testing.T) {
 	if string(sb) != want {
 		t.Errorf("b.Bytes() = %q, want %q", sb, want)
 	}
+	if n := b.OutputLen(); n != len(want) {
+		t.Errorf("b.OutputLen() = %d, want %d", n, len(want))
+	}
 }
 
 func TestEditString(t *testing.T) {
@@ -46,6 +59,9 @@ func TestEditString(t *testing.T) {
 	if string(sb) != want {
 		t.Errorf("b.Bytes() = %q, want %q", sb, want)
 	}
+	if n := b.OutputLen(); n != len(want) {
+		t.Errorf("b.OutputLen() = %d, want %d", n, len(want))
+	}
 }
 
 func TestOverlappingDeletes(t *testing.T) {
@@ -58,6 +74,12 @@ func TestOverlappingDeletes(t *testing.T) {
 	if got := b.String(); got != want {
 		t.Errorf("b.String() = %q want %q", got, want)
 	}
+	if got := b.OutputLen(); got != len(want) {
+		t.Errorf("b.OutputLen() = %d want %d", got, len(want))
+	}
+	if err := b.Validate(); err != nil {
+		t.Errorf("b.Validate() = %v", err)
+	}
 
 	// Test overlap at beginning.
 	b = NewBuffer([]byte(in))
@@ -66,6 +88,12 @@ func TestOverlappingDeletes(t *testing.T) {
 	if got := b.String(); got != want {
 		t.Errorf("b.String() = %q want %q", got, want)
 	}
+	if got := b.OutputLen(); got != len(want) {
+		t.Errorf("b.OutputLen() = %d want %d", got, len(want))
+	}
+	if err := b.Validate(); err != nil {
+		t.Errorf("b.Validate() = %v", err)
+	}
 
 	// Test overlap in middle.
 	b = NewBuffer([]byte(in))
@@ -74,6 +102,12 @@ func TestOverlappingDeletes(t *testing.T) {
 	if got := b.String(); got != want {
 		t.Errorf("b.String() = %q want %q", got, want)
 	}
+	if got := b.OutputLen(); got != len(want) {
+		t.Errorf("b.OutputLen() = %d want %d", got, len(want))
+	}
+	if err := b.Validate(); err != nil {
+		t.Errorf("b.Validate() = %v", err)
+	}
 
 	// Test overlap at end.
 	b = NewBuffer([]byte(in))
@@ -82,6 +116,12 @@ func TestOverlappingDeletes(t *testing.T) {
 	if got := b.String(); got != want {
 		t.Errorf("b.String() = %q want %q", got, want)
 	}
+	if got := b.OutputLen(); got != len(want) {
+		t.Errorf("b.OutputLen() = %d want %d", got, len(want))
+	}
+	if err := b.Validate(); err != nil {
+		t.Errorf("b.Validate() = %v", err)
+	}
 
 	// Test covering overlap.
 	b = NewBuffer([]byte(in))
@@ -91,6 +131,12 @@ func TestOverlappingDeletes(t *testing.T) {
 	if got := b.String(); got != want {
 		t.Errorf("b.String() = %q want %q", got, want)
 	}
+	if got := b.OutputLen(); got != len(want) {
+		t.Errorf("b.OutputLen() = %d want %d", got, len(want))
+	}
+	if err := b.Validate(); err != nil {
+		t.Errorf("b.Validate() = %v", err)
+	}
 
 	// Test partial overlap.
 	b = NewBuffer([]byte(in))
@@ -99,9 +145,162 @@ func TestOverlappingDeletes(t *testing.T) {
 	if got := b.String(); got != want {
 		t.Errorf("b.String() = %q want %q", got, want)
 	}
+	if got := b.OutputLen(); got != len(want) {
+		t.Errorf("b.OutputLen() = %d want %d", got, len(want))
+	}
+	if err := b.Validate(); err != nil {
+		t.Errorf("b.Validate() = %v", err)
+	}
+}
+
+func TestType(t *testing.T) {
+	b := NewBufferString("0123456789")
+	b.Replace(4, 6, "xyz")
+	b.Insert(4, "a")
+	for _, tt := range []struct {
+		cursor int
+		s      string
+		want   int
+	}{
+		{4, "b", 6},
+		{4, "cd", 8},
+		{2, "π", 4},
+		{10, "!", 18},
+	} {
+		if got := b.Type(tt.cursor, tt.s); got != tt.want {
+			t.Errorf("b.Type(%d, %q) = %d, want %d", tt.cursor, tt.s, got, tt.want)
+		}
+	}
+	const want = "01π23abcdxyz6789!"
+	if got := b.String(); got != want {
+		t.Errorf("b.String() = %q, want %q", got, want)
+	}
+
+	// The cursor stays before insertions that follow the typed text.
+	b = NewBufferString("abc")
+	b.InsertAfter(1, "Z")
+	if got := b.Type(1, "X"); got != 2 {
+		t.Errorf("b.Type(1, \"X\") after InsertAfter = %d, want 2", got)
+	}
+	if got := b.String(); got != "aXZbc" {
+		t.Errorf("b.String() = %q, want %q", got, "aXZbc")
+	}
+}
+
+func TestInclusive(t *testing.T) {
+	b := NewBufferString("0123456789")
+	b.DeleteInclusive(1, 2)
+	b.ReplaceInclusive(5, 5, "five")
+	b.ReplaceInclusive(9, 9, "nine")
+	if got, want := b.String(), "034five678nine"; got != want {
+		t.Errorf("b.String() = %q, want %q", got, want)
+	}
+
+	for _, r := range [][2]int{{3, 2}, {-1, 2}, {5, 10}} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("DeleteInclusive(%d, %d) did not panic", r[0], r[1])
+				}
+			}()
+			b.DeleteInclusive(r[0], r[1])
+		}()
+	}
+}
+
+func TestClearRange(t *testing.T) {
+	b := NewBufferString("0123456789")
+	b.Replace(1, 3, "a")
+	b.Insert(5, "b")
+	b.Insert(6, "c")
+	b.Delete(7, 9)
+	m := b.Checkpoint()
+	if n := b.ClearRange(2, 6); n != 2 {
+		t.Errorf("ClearRange(2, 6) = %d, want 2", n)
+	}
+	if got, want := b.String(), "012345c69"; got != want {
+		t.Errorf("after ClearRange, String() = %q, want %q", got, want)
+	}
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Errorf("Rollback to mark before ClearRange did not panic")
+			}
+		}()
+		b.Rollback(m)
+	}()
+
+	b.Insert(10, "!")
+	b.Clear()
+	if got, want := b.String(), "0123456789"; got != want {
+		t.Errorf("after Clear, String() = %q, want %q", got, want)
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	for _, clamp := range []bool{false, true} {
+		b := NewBufferString("0123456789")
+		b.Insert(2, "two")
+		b.Replace(5, 8, "x")
+		b.Insert(9, "nine")
+		b.Delete(3, 4)
+		if got, want := b.EditsBeyond(6), []int{1, 2}; !reflect.DeepEqual(got, want) {
+			t.Errorf("EditsBeyond(6) = %v, want %v", got, want)
+		}
+		b.Truncate(6, clamp)
+		want := "01two245"
+		if clamp {
+			want = "01two24xnine"
+		}
+		if got := b.String(); got != want {
+			t.Errorf("Truncate(6, %v): b.String() = %q, want %q", clamp, got, want)
+		}
+	}
 }
 
-var sink []byte
+var _ io.WriterTo = (*Buffer)(nil)
+
+// A limitedWriter accepts n bytes and then fails.
+type limitedWriter struct {
+	n int
+}
+
+var errFull = errors.New("full")
+
+func (w *limitedWriter) Write(p []byte) (int, error) {
+	if len(p) > w.n {
+		n := w.n
+		w.n = 0
+		return n, errFull
+	}
+	w.n -= len(p)
+	return len(p), nil
+}
+
+func TestWriterTo(t *testing.T) {
+	b := NewBufferString("0123456789")
+	b.Insert(8, ",7½,")
+	b.Replace(3, 4, "three,")
+	var wt io.WriterTo = b
+	var sb strings.Builder
+	n, err := wt.WriteTo(&sb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := b.String(); sb.String() != want || n != int64(len(want)) {
+		t.Errorf("WriteTo wrote %q (n=%d), want %q", sb.String(), n, want)
+	}
+
+	n, err = b.WriteTo(&limitedWriter{n: 5})
+	if n != 5 || err != errFull {
+		t.Errorf("WriteTo to full writer = %d, %v; want 5, %v", n, err, errFull)
+	}
+}
+
+var (
+	sink       []byte
+	sinkString string
+)
 
 func BenchmarkBytes(b *testing.B) {
 	b.ReportAllocs()
@@ -117,3 +316,1029 @@ func BenchmarkBytes(b *testing.B) {
 		sink = b.Bytes()
 	}
 }
+
+func BenchmarkAppendTo(b *testing.B) {
+	data := bytes.Repeat([]byte("0123456789abcdef"), 4)
+	buf := NewBuffer(data)
+	queueBenchEdits(buf)
+	b.ReportAllocs()
+	var dst []byte
+	for i := 0; i < b.N; i++ {
+		dst = buf.AppendTo(dst[:0])
+	}
+	sink = dst
+}
+
+func BenchmarkBytesReused(b *testing.B) {
+	data := bytes.Repeat([]byte("0123456789abcdef"), 4)
+	buf := NewBuffer(data)
+	queueBenchEdits(buf)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		sink = buf.Bytes()
+	}
+}
+
+func TestAppendTo(t *testing.T) {
+	b := NewBufferString("0123456789")
+	b.Replace(3, 4, "three")
+	b.Delete(6, 8)
+	if got, want := string(b.AppendTo([]byte("prefix:"))), "prefix:012three4589"; got != want {
+		t.Errorf("AppendTo = %q, want %q", got, want)
+	}
+	dst := make([]byte, 2, 64)
+	if got := b.AppendTo(dst); &got[0] != &dst[0] {
+		t.Errorf("AppendTo reallocated a slice with enough capacity")
+	}
+}
+
+func TestReset(t *testing.T) {
+	b := NewBufferString("0123456789")
+	b.Insert(2, "x")
+	b.SetCacheResult(true)
+	_ = b.String()
+	b.Reset([]byte("abc"))
+	if got, want := b.String(), "abc"; got != want {
+		t.Errorf("after Reset, String() = %q, want %q", got, want)
+	}
+	b.Replace(1, 2, "B")
+	if got, want := b.String(), "aBc"; got != want {
+		t.Errorf("after Reset, String() = %q, want %q", got, want)
+	}
+	b.ResetString("")
+	if got, want := b.String(), ""; got != want {
+		t.Errorf("after ResetString, String() = %q, want %q", got, want)
+	}
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Insert past end of data after ResetString did not panic")
+		}
+	}()
+	b.Insert(1, "x")
+}
+
+func TestResetAllocs(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789abcdef"), 4)
+	b := NewBuffer(data)
+	queueBenchEdits(b)
+	allocs := testing.AllocsPerRun(100, func() {
+		b.Reset(data)
+		queueBenchEdits(b)
+		b.WriteTo(io.Discard)
+	})
+	if allocs != 0 {
+		t.Errorf("reused Buffer allocated %v times, want 0", allocs)
+	}
+}
+
+// queueBenchEdits queues many small edits in b, whose data has length 64.
+func queueBenchEdits(b *Buffer) {
+	for i := 0; i < 64; i += 2 {
+		b.Replace(i, i+1, "x")
+	}
+}
+
+func BenchmarkNewBuffer(b *testing.B) {
+	data := bytes.Repeat([]byte("0123456789abcdef"), 4)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		buf := NewBuffer(data)
+		queueBenchEdits(buf)
+		buf.WriteTo(io.Discard)
+	}
+}
+
+func BenchmarkManyEdits(b *testing.B) {
+	data := bytes.Repeat([]byte("0123456789abcdef"), 1<<14)
+	pos := make([]int, 50000)
+	for i := range pos {
+		pos[i] = (i * 7919) % len(data) // scattered, out of order
+	}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		buf := NewBuffer(data)
+		for _, p := range pos {
+			buf.Replace(p, p+1, "xy")
+		}
+		buf.WriteTo(io.Discard)
+	}
+}
+
+func BenchmarkManyEditsInterleaved(b *testing.B) {
+	data := bytes.Repeat([]byte("0123456789abcdef"), 1<<14)
+	for _, bench := range []struct {
+		name string
+		new  func([]byte) *Buffer
+	}{
+		{"NewBuffer", NewBuffer},
+		{"NewBufferLarge", NewBufferLarge},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				buf := bench.new(data)
+				for j := 0; j < 20000; j++ {
+					p := (j * 7919) % len(data) // scattered, out of order
+					buf.Replace(p, p+1, "xy")
+					if j%100 == 0 {
+						buf.ResultLen()
+					}
+				}
+				buf.WriteTo(io.Discard)
+			}
+		})
+	}
+}
+
+func BenchmarkResetPooled(b *testing.B) {
+	data := bytes.Repeat([]byte("0123456789abcdef"), 4)
+	pool := sync.Pool{New: func() interface{} { return new(Buffer) }}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		buf := pool.Get().(*Buffer)
+		buf.Reset(data)
+		queueBenchEdits(buf)
+		buf.WriteTo(io.Discard)
+		pool.Put(buf)
+	}
+}
+
+func TestCacheResult(t *testing.T) {
+	b := NewBufferString("0123456789")
+	b.SetCacheResult(true)
+	check := func(step, want string) {
+		t.Helper()
+		if got := b.String(); got != want {
+			t.Errorf("%s: String() = %q, want %q", step, got, want)
+		}
+		if got := string(b.Bytes()); got != want {
+			t.Errorf("%s: Bytes() = %q, want %q", step, got, want)
+		}
+	}
+	check("initial", "0123456789")
+	b.Insert(1, "a")
+	check("Insert", "0a123456789")
+	if p, q := b.Bytes(), b.Bytes(); &p[0] != &q[0] {
+		t.Errorf("Bytes() recomputed output with no intervening edits")
+	}
+	b.Delete(2, 3)
+	check("Delete", "0a13456789")
+	b.Replace(4, 5, "b")
+	check("Replace", "0a13b56789")
+	b.InsertSoft(6, "c")
+	check("InsertSoft", "0a13b5c6789")
+
+	other := NewBufferString("0123456789")
+	other.Insert(8, "d")
+	b.Merge(other)
+	check("Merge", "0a13b5c67d89")
+
+	if _, err := b.MergePatch([]byte(`[{"start":9,"end":9,"new":"e"}]`)); err != nil {
+		t.Fatal(err)
+	}
+	check("MergePatch", "0a13b5c67d8e9")
+
+	b.Batch(func(b *Buffer) {
+		b.Insert(0, "f")
+		b.Insert(-1, "g")
+	})
+	check("Batch rollback", "0a13b5c67d8e9")
+
+	b.Truncate(7, false)
+	check("Truncate", "0a13b5c6")
+
+	b.SetCacheResult(false)
+	b.Insert(0, "h")
+	check("uncached", "h0a13b5c6")
+}
+
+func TestInsertJunction(t *testing.T) {
+	const in = "0123456789"
+	for _, insert := range []func(b *Buffer, pos int, s string){
+		(*Buffer).Insert,
+		(*Buffer).InsertBefore,
+		(*Buffer).InsertAfter,
+	} {
+		b := NewBufferString(in)
+		b.Replace(4, 7, "R2")
+		insert(b, 4, "s")
+		b.Replace(1, 4, "R1")
+		b.Insert(1, "<") // before R1
+		b.Insert(7, ">") // after R2
+		if got, want := b.String(), "0<R1sR2>789"; got != want {
+			t.Errorf("String() = %q, want %q", got, want)
+		}
+	}
+}
+
+func TestInsertBeforeAfter(t *testing.T) {
+	const in = "0123456789"
+	// Priority orders insertions at one position, regardless of call order.
+	b := NewBufferString(in)
+	b.InsertAfter(5, "a1")
+	b.Insert(5, "i1")
+	b.InsertBefore(5, "b1")
+	b.Insert(5, "i2")
+	b.InsertAfter(5, "a2")
+	b.InsertBefore(5, "b2")
+	if got, want := b.String(), "01234b1b2i1i2a1a256789"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+
+	// Edits starting at the position follow all insertions there,
+	// and edits ending there precede them.
+	b = NewBufferString(in)
+	b.Replace(5, 6, "R")
+	b.InsertBefore(5, "<")
+	b.Replace(4, 5, "L")
+	b.InsertAfter(5, ">")
+	b.Insert(5, "=")
+	if got, want := b.String(), "0123L<=>R6789"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+}
+
+func TestReplaceLabeled(t *testing.T) {
+	b := NewBufferString("a\nb\nc\nd\ne\nf\ng\nh\ni\nj\nk\nl\nm\nn\no\np\n")
+	b.ReplaceLabeled(0, 1, "A", "rule:upper x.go:1")
+	b.ReplaceLabeled(30, 31, "P", "rule:upper x.go:16")
+	b.Replace(2, 3, "B")
+	if got, want := b.Debug(), "Replace[0,1) => \"A\" (rule:upper x.go:1)\nReplace[30,31) => \"P\" (rule:upper x.go:16)\nReplace[2,3) => \"B\"\n"; got != want {
+		t.Errorf("Debug() = %q, want %q", got, want)
+	}
+	d := string(b.Diff("x.go"))
+	for _, want := range []string{"@@ -1,5 +1,5 @@ rule:upper x.go:1\n", "@@ -13,4 +13,4 @@ rule:upper x.go:16\n"} {
+		if !strings.Contains(d, want) {
+			t.Errorf("Diff() = %q, want it to contain %q", d, want)
+		}
+	}
+
+	b.ReplaceLabeled(1, 3, "", "rule:join x.go:1")
+	err := b.Validate()
+	want := &ConflictError{A: Edit{1, 3, ""}, B: Edit{2, 3, "B"}, ALabel: "rule:join x.go:1"}
+	if cerr, ok := err.(*ConflictError); !ok || *cerr != *want {
+		t.Fatalf("Validate() = %v, want %v", err, want)
+	}
+	if got, want := err.Error(), `edit: overlapping edits: [1,3)->"" (rule:join x.go:1), [2,3)->"B"`; got != want {
+		t.Errorf("Validate().Error() = %q, want %q", got, want)
+	}
+}
+
+func TestInsertWithPriority(t *testing.T) {
+	b := NewBufferString("0123456789")
+	b.InsertWithPriority(5, "c", 10)
+	b.InsertAfter(5, "+1")
+	b.InsertWithPriority(5, "a", -10)
+	b.Insert(5, "0")
+	b.InsertWithPriority(5, "b", -10)
+	b.InsertBefore(5, "-1")
+	if got, want := b.String(), "01234ab-10+1c56789"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+}
+
+func TestApply(t *testing.T) {
+	b := NewBufferString("0123456789")
+	b.Replace(3, 4, "three")
+	b.Delete(6, 8)
+	if got, err := b.Apply(); string(got) != "012three4589" || err != nil {
+		t.Errorf("Apply() = %q, %v; want %q, nil", got, err, "012three4589")
+	}
+	if got, err := b.ApplyString(); got != "012three4589" || err != nil {
+		t.Errorf("ApplyString() = %q, %v; want %q, nil", got, err, "012three4589")
+	}
+
+	b.Replace(7, 9, "x")
+	want := &ConflictError{A: Edit{6, 8, ""}, B: Edit{7, 9, "x"}}
+	_, err := b.Apply()
+	if cerr, ok := err.(*ConflictError); !ok || *cerr != *want {
+		t.Errorf("Apply() error = %v, want %v", err, want)
+	}
+	if _, err := b.ApplyString(); err == nil {
+		t.Errorf("ApplyString() succeeded with overlapping edits")
+	}
+	func() {
+		defer func() {
+			if r := recover(); r != want.message() {
+				t.Errorf("String() panicked with %v, want %q", r, want.message())
+			}
+		}()
+		_ = b.String()
+	}()
+}
+
+func TestValidate(t *testing.T) {
+	b := NewBufferString("0123456789")
+	b.Replace(3, 4, "three")
+	b.Insert(4, "four")
+	b.Replace(4, 6, "five")
+	if err := b.Validate(); err != nil {
+		t.Errorf("Validate() = %v", err)
+	}
+	b.Replace(5, 7, "six")
+	want := &ConflictError{A: Edit{4, 6, "five"}, B: Edit{5, 7, "six"}}
+	err := b.Validate()
+	if cerr, ok := err.(*ConflictError); !ok || *cerr != *want {
+		t.Errorf("Validate() = %v, want %v", err, want)
+	}
+}
+
+func TestTryEdits(t *testing.T) {
+	b := NewBufferString("0123456789")
+	for _, err := range []error{
+		b.TryInsert(-1, "x"),
+		b.TryInsert(11, "x"),
+		b.TryDelete(5, 4),
+		b.TryDelete(9, 11),
+		b.TryReplace(-1, 2, "x"),
+	} {
+		if err == nil {
+			t.Errorf("invalid edit succeeded")
+		}
+	}
+	var perr *PositionError
+	if err := b.TryDelete(9, 11); !errors.As(err, &perr) || *perr != (PositionError{Start: 9, End: 11, Len: 10}) {
+		t.Errorf("TryDelete(9, 11) = %#v, want *PositionError{9, 11, 10}", err)
+	}
+	for _, err := range []error{
+		b.TryInsert(10, "!"),
+		b.TryDelete(0, 1),
+		b.TryReplace(4, 5, "four"),
+	} {
+		if err != nil {
+			t.Errorf("valid edit failed: %v", err)
+		}
+	}
+	if got, want := b.String(), "123four56789!"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+}
+
+func TestReplaceExpect(t *testing.T) {
+	b := NewBufferString("0123456789")
+	var merr *MismatchError
+	if err := b.ReplaceExpect(2, 4, "24", "x"); !errors.As(err, &merr) || *merr != (MismatchError{Start: 2, End: 4, Want: "24", Got: "23"}) {
+		t.Errorf("ReplaceExpect(2, 4, \"24\", \"x\") = %#v, want *MismatchError", err)
+	}
+	var perr *PositionError
+	if err := b.DeleteExpect(8, 11, "89"); !errors.As(err, &perr) {
+		t.Errorf("DeleteExpect(8, 11, \"89\") = %#v, want *PositionError", err)
+	}
+	if err := b.ReplaceExpect(2, 4, "23", "x"); err != nil {
+		t.Errorf("ReplaceExpect with matching text: %v", err)
+	}
+	if err := b.DeleteExpect(8, 10, "89"); err != nil {
+		t.Errorf("DeleteExpect with matching text: %v", err)
+	}
+	if got, want := b.String(), "01x4567"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+}
+
+func TestOffset(t *testing.T) {
+	b := NewBufferString("0123456789")
+	b.Insert(2, "ab")
+	b.Replace(4, 6, "R")
+	b.Delete(7, 8)
+	b.Insert(10, "!")
+	// Output: 01ab23R689!
+	tests := []struct{ pos, want int }{
+		{0, 0},
+		{2, 4},   // after the insertion
+		{4, 6},   // start of replacement
+		{5, 6},   // inside replacement
+		{6, 7},   // just after replacement
+		{7, 8},   // deleted
+		{8, 8},   // just after deletion
+		{10, 11}, // after final insertion
+	}
+	for _, tt := range tests {
+		if got := b.Offset(tt.pos); got != tt.want {
+			t.Errorf("Offset(%d) = %d, want %d", tt.pos, got, tt.want)
+		}
+	}
+	for _, pos := range []int{-1, 11} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Offset(%d) did not panic", pos)
+				}
+			}()
+			b.Offset(pos)
+		}()
+	}
+}
+
+// A countingReaderAt is an io.ReaderAt that counts the bytes read from it
+// and fails reads that extend past offset fail, if fail is non-negative.
+type countingReaderAt struct {
+	r    io.ReaderAt
+	n    int
+	fail int64
+}
+
+func (r *countingReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if r.fail >= 0 && off+int64(len(p)) > r.fail {
+		return 0, errors.New("read failed")
+	}
+	n, err := r.r.ReadAt(p, off)
+	r.n += n
+	return n, err
+}
+
+func TestNewBufferFromReaderAt(t *testing.T) {
+	const in = "line one\nline two\nline three\n"
+	queue := func(b *Buffer) {
+		b.Replace(5, 8, "1")
+		b.InsertAt(2, 0, "> ")
+		b.ReplaceAll("line", "LINE")
+		b.Delete(24, 26)
+	}
+	want := NewBufferString(in)
+	queue(want)
+	ra := &countingReaderAt{r: strings.NewReader(in), fail: -1}
+	b := NewBufferFromReaderAt(ra, int64(len(in)))
+	queue(b)
+	if got, want := b.String(), want.String(); got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+	var buf bytes.Buffer
+	if _, err := b.WriteTo(&buf); err != nil || buf.String() != want.String() {
+		t.Errorf("WriteTo wrote %q, %v; want %q, nil", buf.String(), err, want.String())
+	}
+	if got, err := io.ReadAll(b.Reader()); err != nil || string(got) != want.String() {
+		t.Errorf("Reader read %q, %v; want %q, nil", got, err, want.String())
+	}
+	if !b.Changed() {
+		t.Errorf("Changed() = false, want true")
+	}
+
+	// WriteTo reads only the unchanged data.
+	ra.n = 0
+	b = NewBufferFromReaderAt(ra, int64(len(in)))
+	b.Replace(0, 20, "")
+	if _, err := b.WriteTo(io.Discard); err != nil {
+		t.Fatal(err)
+	}
+	if ra.n != len(in)-20 {
+		t.Errorf("WriteTo read %d bytes, want %d", ra.n, len(in)-20)
+	}
+
+	ra.fail = 25
+	if _, err := b.WriteTo(io.Discard); err == nil {
+		t.Errorf("WriteTo succeeded with a failing reader")
+	}
+
+	// A source shorter than its given length is an error, not the end of the data.
+	b = NewBufferFromReaderAt(strings.NewReader("abc"), 6)
+	b.Insert(6, "X")
+	var sb strings.Builder
+	if n, err := b.WriteTo(&sb); err != io.ErrUnexpectedEOF || sb.String() != "abc" || n != 3 {
+		t.Errorf("WriteTo of short source = %d, %v, wrote %q; want 3, io.ErrUnexpectedEOF, %q", n, err, sb.String(), "abc")
+	}
+}
+
+func TestClone(t *testing.T) {
+	b := NewBufferString("0123456789")
+	b.Replace(3, 4, "three")
+	c := b.Clone()
+	c.Insert(0, "start,")
+	c.Replace(8, 10, "end")
+	b.Insert(5, "five")
+	if got, want := b.String(), "012three4five56789"; got != want {
+		t.Errorf("b.String() = %q, want %q", got, want)
+	}
+	if got, want := c.String(), "start,012three4567end"; got != want {
+		t.Errorf("c.String() = %q, want %q", got, want)
+	}
+
+	m := NewBufferStringMarkers("0123", map[string]int{"x": 1})
+	mc := m.Clone()
+	mc.InsertAtMarker("x", "y")
+	if got, want := m.String(), "0123"; got != want {
+		t.Errorf("m.String() = %q, want %q", got, want)
+	}
+	if got, want := mc.String(), "0y123"; got != want {
+		t.Errorf("mc.String() = %q, want %q", got, want)
+	}
+
+	// Clones can explore alternatives in parallel, starting from a common mark.
+	mark := b.Checkpoint()
+	outs := make([]string, 4)
+	var wg sync.WaitGroup
+	for i := range outs {
+		c := b.Clone()
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			c.Insert(0, strings.Repeat("x", i))
+			outs[i] = c.String()
+			c.Rollback(mark)
+		}(i)
+	}
+	wg.Wait()
+	for i, out := range outs {
+		if want := strings.Repeat("x", i) + b.String(); out != want {
+			t.Errorf("clone %d produced %q, want %q", i, out, want)
+		}
+	}
+}
+
+func TestReplaceFunc(t *testing.T) {
+	const in = "x = 41; name"
+	for _, b := range []*Buffer{NewBufferString(in), NewBuffer([]byte(in))} {
+		b.ReplaceFunc(8, 12, strings.ToUpper)
+		b.ReplaceFunc(4, 6, func(old string) string {
+			n, err := strconv.Atoi(old)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return strconv.Itoa(n + 1)
+		})
+		if got, want := b.String(), "x = 42; NAME"; got != want {
+			t.Errorf("String() = %q, want %q", got, want)
+		}
+	}
+}
+
+func TestNewBufferLarge(t *testing.T) {
+	const in = "0123456789abcdefghij"
+	queue := func(b *Buffer) []string {
+		var outs []string
+		for i := 0; i < 60; i++ {
+			p := (i * 7) % len(in)
+			switch i % 5 {
+			case 0:
+				b.Insert(p, "<")
+			case 1:
+				b.InsertBefore(p, "(")
+			case 2:
+				b.InsertAfter(p, ")")
+			case 3:
+				b.Insert(p, ">") // ties with earlier insertions at p
+			case 4:
+				b.Undo()
+			}
+			if i%3 == 0 {
+				outs = append(outs, b.String())
+			}
+		}
+		return outs
+	}
+	want := queue(NewBuffer([]byte(in)))
+	got := queue(NewBufferLarge([]byte(in)))
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("NewBufferLarge outputs = %q, want %q", got, want)
+	}
+
+	b := NewBufferLarge([]byte(in))
+	b.Replace(10, 12, "AB")
+	b.Delete(2, 4)
+	_ = b.String()
+	b.Replace(0, 1, "Z")
+	b.Delete(15, 20)
+	if got, want := b.String(), "Z1456789ABcde"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+	if !b.Clone().large {
+		t.Errorf("Clone of a large buffer is not large")
+	}
+}
+
+func TestCheckUTF8(t *testing.T) {
+	const in = "aπb½c" // π is [1,3), ½ is [4,6)
+	b := NewBufferString(in)
+	b.CheckUTF8(true)
+	b.Insert(1, "<")
+	b.Replace(1, 3, "pi")
+	b.Delete(4, 6)
+	b.Insert(7, ">")
+	if got, want := b.String(), "a<pibc>"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+
+	for _, f := range []func(){
+		func() { b.Insert(2, "x") },
+		func() { b.Delete(3, 5) },
+		func() { b.Replace(5, 7, "x") },
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("edit splitting a UTF-8 sequence did not panic")
+				}
+			}()
+			f()
+		}()
+	}
+	if err := b.TryReplace(2, 4, "x"); err == nil {
+		t.Errorf("TryReplace splitting a UTF-8 sequence succeeded")
+	}
+	if err := b.Batch(func(b *Buffer) { b.Insert(5, "x") }); err == nil {
+		t.Errorf("Batch splitting a UTF-8 sequence succeeded")
+	}
+
+	b.CheckUTF8(false)
+	b.Insert(2, "x") // no longer checked
+
+	u := NewBufferUTF8([]byte(in))
+	if err := u.TryDelete(1, 2); err == nil {
+		t.Errorf("NewBufferUTF8: TryDelete splitting a UTF-8 sequence succeeded")
+	}
+}
+
+func TestStats(t *testing.T) {
+	b := NewBufferString("0123456789")
+	b.Insert(1, "ab")
+	b.Replace(2, 3, "xyz")
+	b.Delete(4, 7)
+	b.Delete(5, 8) // overlaps the previous deletion
+	b.Delete(5, 6) // subsumed
+	ins, del := b.Stats()
+	if ins != 5 || del != 5 {
+		t.Errorf("Stats() = %d, %d; want 5, 5", ins, del)
+	}
+	if got, want := b.OutputLen(), 10+ins-del; got != want {
+		t.Errorf("OutputLen() = %d, want %d", got, want)
+	}
+	// The insertion at 1 and the replacement at 2 are separate places,
+	// and the deletions merge into one.
+	b.Replace(9, 10, "9")
+	if got, want := b.ChangeCount(), 3; got != want {
+		t.Errorf("ChangeCount() = %d, want %d", got, want)
+	}
+}
+
+func TestConcurrentReads(t *testing.T) {
+	for _, cache := range []bool{false, true} {
+		b := NewBufferString("0123456789\nabc\n")
+		b.SetCacheResult(cache)
+		b.Insert(5, "a")
+		b.Replace(1, 3, "b")
+		b.Insert(12, "c")
+		want := NewBufferString("0123456789\nabc\n")
+		want.Insert(5, "a")
+		want.Replace(1, 3, "b")
+		want.Insert(12, "c")
+		var wg sync.WaitGroup
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				var sb strings.Builder
+				b.WriteTo(&sb)
+				if sb.String() != want.String() || b.String() != want.String() || string(b.Bytes()) != want.String() {
+					t.Errorf("concurrent reads (cache %v) = %q, want %q", cache, sb.String(), want.String())
+				}
+				b.TextEdits()
+			}()
+		}
+		wg.Wait()
+	}
+}
+
+func TestWriteToKeepsQueueOrder(t *testing.T) {
+	edit := func(b *Buffer, preview bool) {
+		b.Insert(5, "a")
+		b.Insert(2, "b")
+		b.Insert(5, "c")
+		if preview {
+			_ = b.String()
+		}
+		b.Insert(5, "d")
+		b.Insert(2, "e")
+	}
+	want := NewBufferString("0123456789")
+	edit(want, false)
+	b := NewBufferString("0123456789")
+	edit(b, true)
+	if got, want := b.String(), want.String(); got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+	if got, want := b.Debug(), want.Debug(); got != want {
+		t.Errorf("String() changed the queue:\n%s\nwant:\n%s", got, want)
+	}
+
+	// A Batch that is rolled back restores the queue even if fn reads the output.
+	b.Batch(func(b *Buffer) {
+		b.Insert(0, "x")
+		_ = b.String()
+		b.Insert(-1, "y")
+	})
+	if got, want := b.String(), want.String(); got != want {
+		t.Errorf("after rolled back Batch, String() = %q, want %q", got, want)
+	}
+}
+
+func TestUndo(t *testing.T) {
+	b := NewBufferString("0123456789")
+	b.Insert(5, "a")
+	b.Replace(1, 2, "one")
+	_ = b.String() // does not affect which edit is most recent
+	b.Delete(7, 9)
+	b.Insert(0, "b")
+	if b.Len() != 4 {
+		t.Errorf("Len() = %d, want 4", b.Len())
+	}
+	if !b.Undo() || !b.Undo() {
+		t.Fatalf("Undo() = false with queued edits")
+	}
+	if got, want := b.String(), "0one234a56789"; got != want {
+		t.Errorf("after Undo, String() = %q, want %q", got, want)
+	}
+	if b.Len() != 2 {
+		t.Errorf("Len() = %d, want 2", b.Len())
+	}
+	b.Undo()
+	b.Undo()
+	if b.Undo() {
+		t.Errorf("Undo() = true with no queued edits")
+	}
+}
+
+func TestCanonicalize(t *testing.T) {
+	b := NewBufferString("0123456789")
+	b.Replace(1, 3, "x")
+	b.Insert(5, "!")
+	b.Replace(1, 3, "x") // duplicate: removed
+	b.Insert(5, "!")     // identical insertion: kept
+	b.Delete(6, 7)
+	b.Delete(7, 8)
+	b.Delete(6, 7)
+	b.Insert(9, "")
+	b.Canonicalize()
+	if got, want := b.String(), "0x34!!589"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+	want := []Edit{{1, 3, "x"}, {5, 5, "!!"}, {6, 8, ""}}
+	if got := b.Edits(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Edits() = %v, want %v", got, want)
+	}
+}
+
+func TestOptimize(t *testing.T) {
+	tests := []struct {
+		edit func(b *Buffer)
+		n    int
+	}{
+		{func(b *Buffer) {
+			b.Insert(8, ",7½,")
+			b.Replace(9, 10, "the-end")
+			b.Insert(10, "!")
+			b.Insert(4, "3.14,")
+			b.Insert(4, "π,")
+			b.Insert(4, "3.15,")
+			b.Replace(3, 4, "three,")
+		}, 3},
+		{func(b *Buffer) {
+			b.Delete(5, 6)
+			b.Delete(6, 7)
+			b.Delete(2, 3)
+			b.Delete(2, 4)
+		}, 2},
+		{func(b *Buffer) {
+			b.Insert(3, "a")
+			b.Replace(3, 5, "b")
+			b.Insert(5, "")
+			b.ReplaceSoft(4, 6, "dropped")
+		}, 1},
+	}
+	for i, tt := range tests {
+		b := NewBufferString("0123456789")
+		tt.edit(b)
+		want := b.String()
+		b.Optimize()
+		if got := b.String(); got != want {
+			t.Errorf("%d: after Optimize, String() = %q, want %q", i, got, want)
+		}
+		if got := len(b.Edits()); got != tt.n {
+			t.Errorf("%d: after Optimize, %d edits, want %d", i, got, tt.n)
+		}
+	}
+
+	// Edits that are not combined keep their labels.
+	b := NewBufferString("0123456789")
+	b.ReplaceLabeled(1, 2, "one", "rule A")
+	b.ReplaceLabeled(4, 5, "four", "rule B")
+	b.Insert(5, "!") // combined with the edit labeled B
+	b.Optimize()
+	var labels []string
+	for _, c := range b.Changes() {
+		labels = append(labels, c.Label)
+	}
+	if want := []string{"rule A", ""}; !reflect.DeepEqual(labels, want) {
+		t.Errorf("after Optimize, labels = %q, want %q", labels, want)
+	}
+}
+
+func TestAdd(t *testing.T) {
+	b := NewBufferString("0123456789")
+	b.Replace(1, 2, "one")
+	b.Insert(5, "!")
+	b.Delete(8, 9)
+	// Keep all but the insertion, and add one more.
+	c := NewBufferString("0123456789")
+	for _, e := range b.Edits() {
+		if e.Start != e.End {
+			c.Add(e)
+		}
+	}
+	c.Add(Edit{0, 0, "<"}, Edit{10, 10, ">"})
+	if got, want := c.String(), "<0one2345679>"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+}
+
+func TestReplaceBytes(t *testing.T) {
+	b := NewBufferString("0123456789")
+	b.InsertBytes(2, []byte("ab"))
+	b.ReplaceBytes(4, 6, []byte("R"))
+	if got, want := b.String(), "01ab23R6789"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+	new := bytes.Repeat([]byte("x"), 1000)
+	allocs := testing.AllocsPerRun(100, func() {
+		b.ReplaceBytes(8, 9, new)
+		b.Undo()
+	})
+	if allocs != 0 {
+		t.Errorf("ReplaceBytes allocated %v times, want 0", allocs)
+	}
+}
+
+func TestReplaceLazy(t *testing.T) {
+	b := NewBufferString("a-b-c-d")
+	calls := 0
+	upper := func(old []byte) []byte {
+		calls++
+		return bytes.ToUpper(old)
+	}
+	b.ReplaceLazy(6, 7, upper)
+	b.ReplaceLazy(2, 3, upper)
+	b.Replace(0, 1, "x")
+	if calls != 0 {
+		t.Errorf("ReplaceLazy called f before the edits were applied")
+	}
+	if got, want := b.String(), "x-B-c-D"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+
+	// The functions run in the order edits are applied, on each application.
+	b = NewBufferString("#,#,#")
+	n := 0
+	count := func([]byte) []byte {
+		n++
+		return []byte(strconv.Itoa(n))
+	}
+	for _, off := range []int{4, 0, 2} {
+		b.ReplaceLazy(off, off+1, count)
+	}
+	if got, want := b.String(), "1,2,3"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+	if got, want := b.String(), "4,5,6"; got != want {
+		t.Errorf("second String() = %q, want %q", got, want)
+	}
+}
+
+func TestTransform(t *testing.T) {
+	b := NewBufferString("<a> & <b>")
+	b.Transform(0, 3, func(old []byte) []byte {
+		return bytes.ReplaceAll(bytes.ReplaceAll(old, []byte("<"), []byte("&lt;")), []byte(">"), []byte("&gt;"))
+	})
+	b.Transform(6, 9, bytes.ToUpper)
+	b.Replace(4, 5, "and")
+	if got, want := b.String(), "&lt;a&gt; and <B>"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+}
+
+func TestCheckpoint(t *testing.T) {
+	b := NewBufferString("0123456789")
+	b.Replace(1, 2, "one")
+	m := b.Checkpoint()
+	b.Insert(5, "!")
+	inner := b.Checkpoint()
+	b.Delete(8, 9)
+	b.Rollback(inner)
+	if got, want := b.String(), "0one234!56789"; got != want {
+		t.Errorf("after inner Rollback, String() = %q, want %q", got, want)
+	}
+	b.Rollback(m)
+	if got, want := b.String(), "0one23456789"; got != want {
+		t.Errorf("after Rollback, String() = %q, want %q", got, want)
+	}
+	b.Rollback(m) // rolling back again does nothing
+
+	for _, invalidate := range []func(b *Buffer){
+		func(b *Buffer) { b.Undo(); b.Undo() },
+		func(b *Buffer) { b.Optimize() },
+		func(b *Buffer) { b.Reset([]byte("0123456789")) },
+	} {
+		b := NewBufferString("0123456789")
+		b.Insert(1, "x")
+		m := b.Checkpoint()
+		b.Insert(2, "y")
+		invalidate(b)
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Rollback to an invalid mark did not panic")
+				}
+			}()
+			b.Rollback(m)
+		}()
+	}
+}
+
+func TestNewBufferFromEdits(t *testing.T) {
+	old := []byte("0123456789")
+	b := NewBuffer(old)
+	b.Insert(8, ",7½,")
+	b.Replace(9, 10, "the-end")
+	b.InsertAfter(4, "3.14,")
+	b.Insert(4, "π,")
+	b.Delete(5, 7)
+	b.Delete(6, 8)
+	data, err := json.Marshal(b.Edits())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var edits []Edit
+	if err := json.Unmarshal(data, &edits); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := NewBufferFromEdits(old, edits).String(), b.String(); got != want {
+		t.Errorf("round trip through %s produces %q, want %q", data, got, want)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("NewBufferFromEdits with invalid edit did not panic")
+		}
+	}()
+	NewBufferFromEdits(old, []Edit{{Start: 3, End: 11}})
+}
+
+func TestRelativeEdits(t *testing.T) {
+	b := NewBufferString("0123456789")
+	b.InsertRel(0, "!")
+	b.InsertRel(-1, "<")
+	b.InsertRel(-10, "^")
+	b.ReplaceRel(-4, -3, "six")
+	b.DeleteRel(-9, -7)
+	if got, want := b.String(), "^0345six78<9!"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+	b.Append("$")
+	b.Prepend("[")
+	if got, want := b.String(), "^[0345six78<9!$"; got != want {
+		t.Errorf("after Append and Prepend, String() = %q, want %q", got, want)
+	}
+	if got := b.OriginalLen(); got != 10 {
+		t.Errorf("OriginalLen() = %d, want 10", got)
+	}
+	for _, f := range []func(){
+		func() { b.InsertRel(-11, "x") },
+		func() { b.InsertRel(1, "x") },
+		func() { b.DeleteRel(-11, -9) },
+		func() { b.ReplaceRel(-1, 1, "x") },
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("out-of-range relative edit did not panic")
+				}
+			}()
+			f()
+		}()
+	}
+}
+
+// largeBenchBuffer returns a buffer over several megabytes of data
+// with hundreds of edits queued.
+func largeBenchBuffer() *Buffer {
+	data := bytes.Repeat([]byte("0123456789abcdef"), 1<<18)
+	buf := NewBuffer(data)
+	for off := 0; off+10000 <= len(data); off += 10000 {
+		buf.Replace(off, off+4, "replacement")
+		buf.Insert(off+5000, "inserted text")
+	}
+	return buf
+}
+
+func BenchmarkBytesLarge(b *testing.B) {
+	buf := largeBenchBuffer()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		sink = buf.Bytes()
+	}
+}
+
+func BenchmarkStringLarge(b *testing.B) {
+	buf := largeBenchBuffer()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		sinkString = buf.String()
+	}
+}
@@ -0,0 +1,185 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package edit
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// EditFile reads the named file, calls fn to queue edits in a Buffer
+// holding its contents, and writes back the edited contents.
+// If fn returns an error, or the queued edits overlap, EditFile returns it
+// without writing the file, and if the edits do not change the contents
+// (see Changed), EditFile does not write the file at all, leaving its
+// modification time alone.
+//
+// The file is replaced atomically: the edited contents are written to
+// a temporary file in the same directory, which is then renamed over the
+// original, so a failure part way through never leaves a truncated file.
+// The new file has the same permission bits as the original.
+// If path names a symbolic link, the file it refers to is rewritten.
+func EditFile(path string, fn func(b *Buffer) error) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	b := NewBuffer(data)
+	if err := fn(b); err != nil {
+		return err
+	}
+	out, err := b.Apply()
+	if err != nil {
+		return err
+	}
+	if !b.Changed() {
+		return nil
+	}
+	return writeFile(path, out, fi.Mode().Perm(), time.Time{})
+}
+
+// writeFile atomically replaces the named file with data, with permission bits perm,
+// by writing a temporary file in the same directory and renaming it over the original.
+// If the named file is a symbolic link, the file it refers to is replaced instead,
+// leaving the link in place. If mtime is not zero, it becomes the new file's access
+// and modification time.
+func writeFile(path string, data []byte, perm os.FileMode, mtime time.Time) error {
+	if real, err := filepath.EvalSymlinks(path); err == nil {
+		path = real
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Chmod(perm)
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil && !mtime.IsZero() {
+		err = os.Chtimes(tmp, mtime, mtime)
+	}
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// A Set holds a Buffer for each of several files, for edits that span files,
+// as in a refactoring tool.
+type Set struct {
+	files     map[string]*setFile
+	keepTimes bool
+}
+
+// A setFile is a file in a Set.
+type setFile struct {
+	b     *Buffer
+	perm  os.FileMode
+	mtime time.Time
+}
+
+// NewSet returns a new, empty Set.
+func NewSet() *Set {
+	return &Set{files: make(map[string]*setFile)}
+}
+
+// File returns the Buffer for the named file, reading the file
+// the first time it is requested. Later calls return the same Buffer.
+func (s *Set) File(name string) (*Buffer, error) {
+	if f := s.files[name]; f != nil {
+		return f.b, nil
+	}
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := os.Stat(name)
+	if err != nil {
+		return nil, err
+	}
+	f := &setFile{b: NewBuffer(data), perm: fi.Mode().Perm(), mtime: fi.ModTime()}
+	s.files[name] = f
+	return f.b, nil
+}
+
+// Names returns the names of the files in s, in sorted order.
+func (s *Set) Names() []string {
+	names := make([]string, 0, len(s.files))
+	for name := range s.files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// KeepModTimes sets whether Write preserves the modification times of the
+// files it rewrites, as for tools whose edits should not trigger rebuilds.
+// By default, rewritten files get the current time.
+func (s *Set) KeepModTimes(on bool) {
+	s.keepTimes = on
+}
+
+// Diff returns a unified diff of the edits to all the files in s,
+// in sorted order by name, as produced by Buffer.Diff.
+func (s *Set) Diff() []byte {
+	var buf bytes.Buffer
+	for _, name := range s.Names() {
+		buf.Write(s.files[name].b.Diff(name))
+	}
+	return buf.Bytes()
+}
+
+// Write writes back the edited contents of each file in s whose edits change it,
+// replacing each file atomically and preserving its permission bits, as EditFile does.
+// Before writing any file, Write applies the edits of every file, so that if
+// any file's edits overlap, it returns an error naming that file and writes nothing.
+// If writing a file fails, Write returns the error; files earlier in sorted
+// order have already been written.
+func (s *Set) Write() error {
+	names := s.Names()
+	outs := make([][]byte, len(names))
+	changed := make([]bool, len(names))
+	for i, name := range names {
+		b := s.files[name].b
+		out, err := b.Apply()
+		if err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+		outs[i], changed[i] = out, b.Changed()
+	}
+	for i, name := range names {
+		if !changed[i] {
+			continue
+		}
+		f := s.files[name]
+		var mtime time.Time
+		if s.keepTimes {
+			mtime = f.mtime
+		}
+		if err := writeFile(name, outs[i], f.perm, mtime); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,185 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package edit
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestEditFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "f.txt")
+	if err := os.WriteFile(path, []byte("0123456789"), 0640); err != nil {
+		t.Fatal(err)
+	}
+	check := func(want string) {
+		t.Helper()
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != want {
+			t.Errorf("file contains %q, want %q", data, want)
+		}
+		ents, err := os.ReadDir(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(ents) != 1 {
+			t.Errorf("directory has %d entries, want 1", len(ents))
+		}
+	}
+
+	err := EditFile(path, func(b *Buffer) error {
+		b.Replace(3, 4, "three")
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	check("012three456789")
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != 0640 {
+		t.Errorf("file mode = %v, want %v", fi.Mode().Perm(), os.FileMode(0640))
+	}
+
+	// Unchanged contents are not written.
+	old := time.Now().Add(-time.Hour).Truncate(time.Second)
+	if err := os.Chtimes(path, old, old); err != nil {
+		t.Fatal(err)
+	}
+	err = EditFile(path, func(b *Buffer) error {
+		b.Replace(0, 1, "0")
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi, err := os.Stat(path); err != nil || !fi.ModTime().Equal(old) {
+		t.Errorf("unchanged file was rewritten")
+	}
+
+	errFn := errors.New("fn failed")
+	err = EditFile(path, func(b *Buffer) error {
+		b.Delete(0, 3)
+		return errFn
+	})
+	if err != errFn {
+		t.Errorf("EditFile error = %v, want %v", err, errFn)
+	}
+	check("012three456789")
+
+	// Conflicting edits are reported, not written.
+	err = EditFile(path, func(b *Buffer) error {
+		b.Replace(0, 3, "x")
+		b.Replace(2, 4, "y")
+		return nil
+	})
+	if err == nil {
+		t.Errorf("EditFile with conflicting edits succeeded")
+	}
+	check("012three456789")
+}
+
+func TestEditFileSymlink(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "f.txt")
+	link := filepath.Join(dir, "link.txt")
+	if err := os.WriteFile(path, []byte("0123456789"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("f.txt", link); err != nil {
+		t.Skipf("cannot create symbolic link: %v", err)
+	}
+	err := EditFile(link, func(b *Buffer) error {
+		b.Insert(10, "!")
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi, err := os.Lstat(link); err != nil || fi.Mode()&os.ModeSymlink == 0 {
+		t.Errorf("link was replaced (%v)", err)
+	}
+	if data, err := os.ReadFile(path); err != nil || string(data) != "0123456789!" {
+		t.Errorf("link target contains %q, %v; want %q", data, err, "0123456789!")
+	}
+}
+
+func TestSet(t *testing.T) {
+	dir := t.TempDir()
+	a, b, c := filepath.Join(dir, "a.txt"), filepath.Join(dir, "b.txt"), filepath.Join(dir, "c.txt")
+	old := time.Date(2001, 2, 3, 4, 5, 6, 0, time.UTC)
+	for _, name := range []string{a, b, c} {
+		if err := os.WriteFile(name, []byte("0123456789\n"), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(name, old, old); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s := NewSet()
+	s.KeepModTimes(true)
+	edit := func(name string, fn func(b *Buffer)) {
+		t.Helper()
+		buf, err := s.File(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fn(buf)
+	}
+	edit(b, func(buf *Buffer) { buf.Replace(0, 1, "zero") })
+	edit(a, func(buf *Buffer) { buf.Delete(0, 11) })
+	edit(c, func(buf *Buffer) {})
+	edit(b, func(buf *Buffer) { buf.Insert(11, "end\n") }) // same buffer as before
+
+	wantDiff := "--- a/" + a + "\n+++ b/" + a + "\n@@ -1 +0,0 @@\n-0123456789\n" +
+		"--- a/" + b + "\n+++ b/" + b + "\n@@ -1 +1,2 @@\n-0123456789\n+zero123456789\n+end\n"
+	if got := string(s.Diff()); got != wantDiff {
+		t.Errorf("Diff() =\n%s\nwant:\n%s", got, wantDiff)
+	}
+
+	// Overlapping edits in one file keep all files from being written.
+	edit(c, func(buf *Buffer) {
+		buf.Replace(0, 2, "x")
+		buf.Replace(1, 3, "y")
+	})
+	if err := s.Write(); err == nil {
+		t.Errorf("Write with overlapping edits succeeded")
+	}
+	if data, _ := os.ReadFile(a); string(data) != "0123456789\n" {
+		t.Errorf("failed Write changed %s to %q", a, data)
+	}
+	cb, _ := s.File(c)
+	cb.Undo()
+	cb.Undo()
+
+	if err := s.Write(); err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]string{a: "", b: "zero123456789\nend\n", c: "0123456789\n"} {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != want {
+			t.Errorf("%s contains %q, want %q", name, data, want)
+		}
+		fi, err := os.Stat(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !fi.ModTime().Equal(old) || fi.Mode().Perm() != 0600 {
+			t.Errorf("%s has mode %v and time %v, want %v and %v", name, fi.Mode().Perm(), fi.ModTime(), os.FileMode(0600), old)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package edit
+
+import "strings"
+
+// NormalizeIndent queues edits that rewrite the leading whitespace of each
+// line of the original data to use tabs (if toTabs is set) or spaces only,
+// and returns the number of lines changed. The indentation of each line is
+// measured in columns, with tabs advancing to the next multiple of tabWidth,
+// and re-emitted as that many columns: as tabs followed by any leftover
+// spaces, or as spaces. Only leading spaces and tabs are touched.
+// NormalizeIndent panics if tabWidth is not positive.
+func (b *Buffer) NormalizeIndent(toTabs bool, tabWidth int) int {
+	if tabWidth <= 0 {
+		panic("invalid tab width")
+	}
+	changed := 0
+	n := b.contentsLen()
+	for _, start := range b.lineStarts() {
+		end, col := start, 0
+	scan:
+		for ; end < n; end++ {
+			switch b.byteAt(end) {
+			case ' ':
+				col++
+			case '\t':
+				col += tabWidth - col%tabWidth
+			default:
+				break scan
+			}
+		}
+		var indent string
+		if toTabs {
+			indent = strings.Repeat("\t", col/tabWidth) + strings.Repeat(" ", col%tabWidth)
+		} else {
+			indent = strings.Repeat(" ", col)
+		}
+		if indent != b.text(start, end) {
+			b.Replace(start, end, indent)
+			changed++
+		}
+	}
+	return changed
+}
+
+// TrimTrailingWhitespace queues deletions of the spaces and tabs at the end
+// of each line of the original data, including a final line without a newline,
+// and returns the number of lines changed. A carriage return before a newline
+// is kept, and the whitespace before it is trimmed, unless trimCR is set,
+// in which case carriage returns count as whitespace to trim, so that
+// \r\n line endings become \n.
+func (b *Buffer) TrimTrailingWhitespace(trimCR bool) int {
+	changed := 0
+	n := b.contentsLen()
+	starts := b.lineStarts()
+	for i, start := range starts {
+		end := n
+		if i+1 < len(starts) {
+			end = starts[i+1] - 1 // the newline
+		}
+		if !trimCR && end > start && b.byteAt(end-1) == '\r' {
+			end--
+		}
+		trim := end
+		for trim > start {
+			c := b.byteAt(trim - 1)
+			if c != ' ' && c != '\t' && (c != '\r' || !trimCR) {
+				break
+			}
+			trim--
+		}
+		if trim < end {
+			b.Delete(trim, end)
+			changed++
+		}
+	}
+	return changed
+}
+
+// MatchLineEndings sets whether b rewrites the line endings of the new text
+// of edits queued later to match those of the original data, so that edits
+// written with \n line endings do not give a file using \r\n mixed line
+// endings, and vice versa. When on, each \n or \r\n in new text becomes the
+// line ending used by most lines of the original data; if the original data
+// has no line endings, new text is left as it is. The text of lazy edits
+// (see ReplaceLazy) is not rewritten. Matching is off by default.
+// To check that edits do not split a \r\n pair, see GraphemeSafetyWarnings.
+func (b *Buffer) MatchLineEndings(on bool) {
+	b.eol = ""
+	if !on {
+		return
+	}
+	crlf, lf := 0, 0
+	for _, start := range b.lineStarts()[1:] {
+		if start >= 2 && b.byteAt(start-2) == '\r' {
+			crlf++
+		} else {
+			lf++
+		}
+	}
+	switch {
+	case crlf > lf:
+		b.eol = "\r\n"
+	case lf > 0:
+		b.eol = "\n"
+	}
+}
+
+// matchEOL returns s with each \n or \r\n line ending replaced by eol.
+func matchEOL(s, eol string) string {
+	if !strings.Contains(s, "\n") {
+		return s
+	}
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	if eol != "\n" {
+		s = strings.ReplaceAll(s, "\n", eol)
+	}
+	return s
+}
+
+// InsertIndented inserts new at pos, indenting it to match the original line
+// containing pos: each line of new that follows a newline is prefixed with
+// that line's leading spaces and tabs, as is the first line if pos is at
+// the start of a line, as when a code generator inserts a block of statements.
+// Empty lines are left empty, so as not to add trailing whitespace.
+func (b *Buffer) InsertIndented(pos int, new string) {
+	if pos < 0 || pos > b.contentsLen() {
+		panic("invalid edit position")
+	}
+	starts := b.lineIndex().starts
+	start, _ := b.lineSpan(starts, pos)
+	end := start
+	for n := b.contentsLen(); end < n; end++ {
+		if c := b.byteAt(end); c != ' ' && c != '\t' {
+			break
+		}
+	}
+	indent := b.text(start, end)
+	if indent == "" {
+		b.Insert(pos, new)
+		return
+	}
+	var sb strings.Builder
+	for i, line := range strings.SplitAfter(new, "\n") {
+		if line != "" && line != "\n" && (i > 0 || pos == start) {
+			sb.WriteString(indent)
+		}
+		sb.WriteString(line)
+	}
+	b.Insert(pos, sb.String())
+}
@@ -0,0 +1,87 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package edit
+
+import "testing"
+
+func TestNormalizeIndent(t *testing.T) {
+	const in = "a\n    b\n\tc\n  \td\n      e\n\t \tf g\n"
+	tests := []struct {
+		toTabs  bool
+		want    string
+		changed int
+	}{
+		{true, "a\n\tb\n\tc\n\td\n\t  e\n\t\tf g\n", 4},
+		{false, "a\n    b\n    c\n    d\n      e\n        f g\n", 3},
+	}
+	for _, tt := range tests {
+		b := NewBufferString(in)
+		if n := b.NormalizeIndent(tt.toTabs, 4); n != tt.changed {
+			t.Errorf("NormalizeIndent(%v, 4) = %d, want %d", tt.toTabs, n, tt.changed)
+		}
+		if got := b.String(); got != tt.want {
+			t.Errorf("NormalizeIndent(%v, 4) produces %q, want %q", tt.toTabs, got, tt.want)
+		}
+	}
+}
+
+func TestTrimTrailingWhitespace(t *testing.T) {
+	const in = "a \nb\t \r\nc\r\n\t\n \td \r \r\ne  "
+	tests := []struct {
+		trimCR  bool
+		want    string
+		changed int
+	}{
+		{false, "a\nb\r\nc\r\n\n \td \r\r\ne", 5},
+		{true, "a\nb\nc\n\n \td\ne", 6},
+	}
+	for _, tt := range tests {
+		b := NewBufferString(in)
+		if n := b.TrimTrailingWhitespace(tt.trimCR); n != tt.changed {
+			t.Errorf("TrimTrailingWhitespace(%v) = %d, want %d", tt.trimCR, n, tt.changed)
+		}
+		if got := b.String(); got != tt.want {
+			t.Errorf("TrimTrailingWhitespace(%v) produces %q, want %q", tt.trimCR, got, tt.want)
+		}
+	}
+}
+
+func TestMatchLineEndings(t *testing.T) {
+	b := NewBufferString("a\r\nb\r\nc\n")
+	b.MatchLineEndings(true)
+	b.Insert(3, "x\ny\r\n")
+	b.Replace(6, 7, "z\n")
+	b.MatchLineEndings(false)
+	b.Insert(8, "w\n")
+	if got, want := b.String(), "a\r\nx\r\ny\r\nb\r\nz\r\n\nw\n"; got != want {
+		t.Errorf("CRLF: String() = %q, want %q", got, want)
+	}
+
+	b = NewBufferString("a\nb\r\nc\n")
+	b.MatchLineEndings(true)
+	b.Insert(0, "x\r\ny\n")
+	if got, want := b.String(), "x\ny\na\nb\r\nc\n"; got != want {
+		t.Errorf("LF: String() = %q, want %q", got, want)
+	}
+
+	b = NewBufferString("abc")
+	b.MatchLineEndings(true)
+	b.Insert(0, "x\r\ny\n")
+	if got, want := b.String(), "x\r\ny\nabc"; got != want {
+		t.Errorf("no line endings: String() = %q, want %q", got, want)
+	}
+}
+
+func TestInsertIndented(t *testing.T) {
+	const in = "func f() {\n\tif x {\n\t\treturn\n\t}\n}\n"
+	b := NewBufferString(in)
+	b.InsertIndented(19, "y()\n\nz()\n") // start of the return line
+	b.InsertIndented(18, " // x\nw()")   // end of the if line
+	b.InsertIndented(0, "// f\n")        // unindented line
+	want := "// f\nfunc f() {\n\tif x { // x\n\tw()\n\t\ty()\n\n\t\tz()\n\t\treturn\n\t}\n}\n"
+	if got := b.String(); got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+}
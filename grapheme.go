@@ -0,0 +1,177 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package edit
+
+import (
+	"fmt"
+	"unicode"
+	"unicode/utf8"
+)
+
+// GraphemeSafetyWarnings returns a warning for each queued deletion or
+// replacement, in call order, whose start or end splits a grapheme cluster
+// of the original text: a user-perceived character such as a letter
+// followed by combining accents, an emoji ZWJ sequence, or a flag.
+// Such edits produce valid UTF-8 but can corrupt text, for example by
+// deleting a base letter while keeping its accent. Each warning reports the
+// offset at which the split cluster starts. Offsets that split a UTF-8
+// sequence are reported too.
+//
+// Clusters are determined by the main rules of Unicode extended grapheme
+// clusters (UAX #29): CR LF, extending and spacing marks, zero-width joiners,
+// emoji modifiers, and regional indicator pairs. Hangul syllable sequences
+// and Indic conjuncts are not recognized.
+func (b *Buffer) GraphemeSafetyWarnings() []string {
+	var warnings []string
+	for _, e := range b.q {
+		if e.start == e.end {
+			continue
+		}
+		for _, end := range []struct {
+			name string
+			off  int
+		}{{"start", e.start}, {"end", e.end}} {
+			if b.clusterBoundary(end.off) {
+				continue
+			}
+			cluster := end.off
+			for !b.clusterBoundary(cluster) {
+				cluster--
+			}
+			warnings = append(warnings, fmt.Sprintf("edit [%d,%d)->%q: %s splits grapheme cluster at offset %d", e.start, e.end, e.new, end.name, cluster))
+		}
+	}
+	return warnings
+}
+
+// runeAt returns the rune starting at offset off in the original data and its size.
+func (b *Buffer) runeAt(off int) (rune, int) {
+	if b.old != nil {
+		return utf8.DecodeRune(b.old[off:])
+	}
+	if b.src != nil {
+		end := off + utf8.UTFMax
+		if n := b.contentsLen(); end > n {
+			end = n
+		}
+		return utf8.DecodeRune(b.readSrc(off, end))
+	}
+	return utf8.DecodeRuneInString(b.str[off:])
+}
+
+// runeBefore returns the rune ending at offset off in the original data and its size.
+func (b *Buffer) runeBefore(off int) (rune, int) {
+	if b.old != nil {
+		return utf8.DecodeLastRune(b.old[:off])
+	}
+	if b.src != nil {
+		start := off - utf8.UTFMax
+		if start < 0 {
+			start = 0
+		}
+		return utf8.DecodeLastRune(b.readSrc(start, off))
+	}
+	return utf8.DecodeLastRuneInString(b.str[:off])
+}
+
+// runeStart reports whether off is at the start of a UTF-8 sequence in the original data.
+func (b *Buffer) runeStart(off int) bool {
+	if off == 0 || off == b.contentsLen() {
+		return true
+	}
+	return utf8.RuneStart(b.byteAt(off))
+}
+
+// The rune methods address the original data by rune index rather than byte
+// offset, as for editor integrations that count user-visible characters.
+// Each UTF-8 sequence of the original data is one rune, as is each byte of
+// invalid UTF-8, as with utf8.DecodeRune. A rune index n is the position
+// before the nth rune, and the number of runes is the end of the data.
+// Converting an index scans the data from the start, so for many edits to
+// large data it is cheaper to convert indexes to byte offsets once, in order.
+// The methods panic if an index is out of range.
+
+// InsertRune inserts new before the rune with the given index.
+func (b *Buffer) InsertRune(pos int, new string) {
+	b.Insert(b.runeOffset(pos), new)
+}
+
+// DeleteRunes deletes the runes of the original data with indexes in [start, end).
+func (b *Buffer) DeleteRunes(start, end int) {
+	b.ReplaceRunes(start, end, "")
+}
+
+// ReplaceRunes replaces the runes of the original data with indexes in [start, end) with new.
+func (b *Buffer) ReplaceRunes(start, end int, new string) {
+	if end < start {
+		panic("invalid edit position")
+	}
+	b.Replace(b.runeOffset(start), b.runeOffset(end), new)
+}
+
+// runeOffset returns the byte offset in the original data of the rune with index n.
+func (b *Buffer) runeOffset(n int) int {
+	if n < 0 {
+		panic("invalid edit position")
+	}
+	off, end := 0, b.contentsLen()
+	for ; n > 0; n-- {
+		if off == end {
+			panic("invalid edit position")
+		}
+		_, size := b.runeAt(off)
+		off += size
+	}
+	return off
+}
+
+const zwj = '\u200d' // zero width joiner
+
+// clusterBoundary reports whether off is a grapheme cluster boundary in the original data.
+func (b *Buffer) clusterBoundary(off int) bool {
+	if off == 0 || off == b.contentsLen() {
+		return true
+	}
+	if !b.runeStart(off) {
+		return false
+	}
+	r0, size0 := b.runeBefore(off)
+	r1, _ := b.runeAt(off)
+	switch {
+	case r0 == '\r' && r1 == '\n':
+		return false
+	case r0 == '\r' || r0 == '\n' || r1 == '\r' || r1 == '\n':
+		return true
+	case extends(r1):
+		return false
+	case r0 == zwj:
+		return false
+	case regionalIndicator(r0) && regionalIndicator(r1):
+		// Regional indicators pair up into flags; off splits a pair
+		// if an odd number of them precede it.
+		n := 1
+		for p := off - size0; p > 0; n++ {
+			r, size := b.runeBefore(p)
+			if !regionalIndicator(r) {
+				break
+			}
+			p -= size
+		}
+		return n%2 == 0
+	}
+	return true
+}
+
+// extends reports whether r attaches to the preceding character.
+func extends(r rune) bool {
+	return unicode.In(r, unicode.Mn, unicode.Me, unicode.Mc) ||
+		r == zwj ||
+		'\U0001F3FB' <= r && r <= '\U0001F3FF' // emoji modifiers
+}
+
+// regionalIndicator reports whether r is a regional indicator symbol, used in pairs to form flags.
+func regionalIndicator(r rune) bool {
+	return '\U0001F1E6' <= r && r <= '\U0001F1FF'
+}
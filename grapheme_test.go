@@ -0,0 +1,64 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package edit
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGraphemeSafetyWarnings(t *testing.T) {
+	const in = "café \U0001F1EB\U0001F1F7\U0001F1E9\U0001F1EA x\r\ny"
+	// Offsets: "cafe" 0-4, U+0301 4-6, " " 6, flags FR 7-15 and DE 15-23,
+	// " " 23, "x" 24, "\r\n" 25-27, "y" 27.
+	b := NewBufferString(in)
+	b.Delete(0, 4)       // keeps the accent of the deleted "e"
+	b.Replace(4, 6, "")  // deletes the accent only
+	b.Delete(6, 7)       // fine
+	b.Replace(7, 15, "") // deletes a whole flag: fine
+	b.Delete(11, 19)     // splits both flags
+	b.Insert(5, "x")     // insertions are not checked
+	b.Delete(26, 27)     // splits CR LF
+	b.Delete(5, 6)       // splits the accent's UTF-8 encoding
+
+	want := []string{
+		`edit [0,4)->"": end splits grapheme cluster at offset 3`,
+		`edit [4,6)->"": start splits grapheme cluster at offset 3`,
+		`edit [11,19)->"": start splits grapheme cluster at offset 7`,
+		`edit [11,19)->"": end splits grapheme cluster at offset 15`,
+		`edit [26,27)->"": start splits grapheme cluster at offset 25`,
+		`edit [5,6)->"": start splits grapheme cluster at offset 3`,
+	}
+	if got := b.GraphemeSafetyWarnings(); !reflect.DeepEqual(got, want) {
+		t.Errorf("GraphemeSafetyWarnings() =\n%q\nwant\n%q", got, want)
+	}
+}
+
+func TestRuneEdits(t *testing.T) {
+	const in = "aπb½c\xff!" // runes a π b ½ c \xff !
+	b := NewBufferString(in)
+	b.InsertRune(0, "<")
+	b.ReplaceRunes(1, 2, "pi")
+	b.DeleteRunes(3, 4)
+	b.ReplaceRunes(5, 6, "?")
+	b.InsertRune(7, ">")
+	if got, want := b.String(), "<apibc?!>"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+	for _, f := range []func(){
+		func() { b.InsertRune(8, "x") },
+		func() { b.InsertRune(-1, "x") },
+		func() { b.DeleteRunes(3, 2) },
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("invalid rune index did not panic")
+				}
+			}()
+			f()
+		}()
+	}
+}
@@ -0,0 +1,137 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package edit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// A History records the successive versions, or generations, of data
+// edited over time, as for an audit trail. Generation 0 is the base data;
+// each call to Commit applies the edits of a Buffer over the latest
+// generation and records the next one. Earlier generations are not kept
+// but reconstructed by ReplayTo from the base data and the recorded edits.
+type History struct {
+	base   []byte
+	latest []byte
+	gens   []Generation
+}
+
+// A Generation records the edits that produced one generation of a History
+// from the one before it, along with a checksum of the data they produced.
+// Like a Script, a Generation encodes as a JSON object, such as
+//
+//	{"edits": [{"start": 1, "end": 2, "new": "x"}], "sha256": "84d8..."}
+type Generation struct {
+	Edits  []Edit `json:"edits"`  // normalized, as by EditsHash
+	SHA256 string `json:"sha256"` // hex-encoded checksum of the resulting data
+}
+
+// NewHistory returns a History whose generation 0 is base.
+// The caller must not modify base while the History is in use.
+func NewHistory(base []byte) *History {
+	return &History{base: base, latest: base}
+}
+
+// RestoreHistory returns a History with base as generation 0 and later
+// generations produced by gens, such as the result of Generations for a
+// History saved earlier. It returns an error if an edit does not apply or
+// produces data that does not match the checksum recorded for its generation.
+func RestoreHistory(base []byte, gens []Generation) (*History, error) {
+	h := NewHistory(base)
+	latest, err := h.replay(gens)
+	if err != nil {
+		return nil, err
+	}
+	h.latest = latest
+	h.gens = append([]Generation(nil), gens...)
+	return h, nil
+}
+
+// Len returns the number of generations committed after the base data,
+// which is also the number of the latest generation.
+func (h *History) Len() int {
+	return len(h.gens)
+}
+
+// Latest returns the data of the latest generation.
+// The caller must not modify it.
+func (h *History) Latest() []byte {
+	return h.latest
+}
+
+// Buffer returns a new Buffer over the data of the latest generation,
+// for queueing the edits of the next one.
+func (h *History) Buffer() *Buffer {
+	return NewBuffer(h.latest)
+}
+
+// Commit applies the edits queued in b, whose original data must be that of
+// the latest generation, records the result as the next generation,
+// and returns its number. Commit returns an error and records nothing if b
+// is for other data or its edits overlap.
+func (h *History) Commit(b *Buffer) (int, error) {
+	if !b.sameContents(NewBuffer(h.latest)) {
+		return 0, errors.New("edit: buffer is not for the latest generation")
+	}
+	out, err := b.Apply()
+	if err != nil {
+		return 0, err
+	}
+	sum := sha256.Sum256(out)
+	h.gens = append(h.gens, Generation{Edits: b.normalized(), SHA256: hex.EncodeToString(sum[:])})
+	h.latest = out
+	return len(h.gens), nil
+}
+
+// Generations returns a copy of the recorded generations, in order:
+// Generations()[i] produced generation i+1. Together with the base data,
+// they are the whole history; see RestoreHistory.
+func (h *History) Generations() []Generation {
+	return append([]Generation(nil), h.gens...)
+}
+
+// ReplayTo reconstructs the data of generation gen by applying the recorded
+// edits to the base data, checking the result of each generation against its
+// recorded checksum. It panics if there is no such generation.
+func (h *History) ReplayTo(gen int) ([]byte, error) {
+	if gen < 0 || gen > len(h.gens) {
+		panic("invalid generation")
+	}
+	return h.replay(h.gens[:gen])
+}
+
+// replay returns the result of applying the edits of gens
+// to the base data in turn, checking each result's checksum.
+func (h *History) replay(gens []Generation) ([]byte, error) {
+	data := h.base
+	for i, g := range gens {
+		b := NewBuffer(data)
+		for _, e := range g.Edits {
+			if err := b.checkRange(e.Start, e.End); err != nil {
+				return nil, generationError(i+1, err)
+			}
+		}
+		b.Add(g.Edits...)
+		out, err := b.Apply()
+		if err != nil {
+			return nil, generationError(i+1, err)
+		}
+		if sum := sha256.Sum256(out); hex.EncodeToString(sum[:]) != g.SHA256 {
+			return nil, fmt.Errorf("edit: generation %d has SHA-256 %x, want %s", i+1, sum, g.SHA256)
+		}
+		data = out
+	}
+	return data, nil
+}
+
+// generationError returns err, an error from this package, as an error in generation gen.
+func generationError(gen int, err error) error {
+	return fmt.Errorf("edit: generation %d: %s", gen, strings.TrimPrefix(err.Error(), "edit: "))
+}
@@ -0,0 +1,84 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package edit
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestHistory(t *testing.T) {
+	h := NewHistory([]byte("0123456789"))
+	want := []string{"0123456789"}
+	for _, fn := range []func(b *Buffer){
+		func(b *Buffer) { b.Replace(1, 3, "ab") },
+		func(b *Buffer) { b.Insert(10, "!"); b.Delete(0, 1) },
+		func(b *Buffer) {},
+	} {
+		b := h.Buffer()
+		fn(b)
+		gen, err := h.Commit(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want = append(want, b.String())
+		if gen != len(want)-1 || h.Len() != gen {
+			t.Errorf("Commit = %d, Len() = %d; want %d", gen, h.Len(), len(want)-1)
+		}
+	}
+	if got := string(h.Latest()); got != "ab3456789!" {
+		t.Errorf("Latest() = %q, want %q", got, "ab3456789!")
+	}
+	for gen, w := range want {
+		got, err := h.ReplayTo(gen)
+		if err != nil || string(got) != w {
+			t.Errorf("ReplayTo(%d) = %q, %v; want %q, nil", gen, got, err, w)
+		}
+	}
+
+	// A Buffer for an earlier generation or with overlapping edits is rejected.
+	if _, err := h.Commit(NewBufferString("0123456789")); err == nil {
+		t.Errorf("Commit of a buffer for generation 0 succeeded")
+	}
+	b := h.Buffer()
+	b.Replace(0, 2, "x")
+	b.Replace(1, 3, "y")
+	if _, err := h.Commit(b); err == nil || h.Len() != 3 {
+		t.Errorf("Commit of overlapping edits = %v, Len() = %d; want error, 3", err, h.Len())
+	}
+
+	// The exported history restores, and tampering is detected.
+	data, err := json.Marshal(h.Generations())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var gens []Generation
+	if err := json.Unmarshal(data, &gens); err != nil {
+		t.Fatal(err)
+	}
+	r, err := RestoreHistory([]byte("0123456789"), gens)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(r.Latest()) != string(h.Latest()) || r.Len() != h.Len() {
+		t.Errorf("restored history has latest %q and %d generations, want %q and %d", r.Latest(), r.Len(), h.Latest(), h.Len())
+	}
+	gens[1].Edits[0].New = "?"
+	if _, err := RestoreHistory([]byte("0123456789"), gens); err == nil || !strings.Contains(err.Error(), "generation 2") {
+		t.Errorf("RestoreHistory with altered edits = %v, want checksum error for generation 2", err)
+	}
+	gens[0].Edits[0].End = 20
+	if _, err := RestoreHistory([]byte("0123456789"), gens); err == nil {
+		t.Errorf("RestoreHistory with an edit outside the data succeeded")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("ReplayTo(4) did not panic")
+		}
+	}()
+	h.ReplayTo(4)
+}
@@ -0,0 +1,74 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package edit
+
+// Move moves the text old[start:end] to the original offset to.
+// It is shorthand for deleting old[start:end] and inserting its text at to,
+// so the moved text is the original text, not the result of other
+// edits to the same range, and such edits overlap the move as usual.
+// The destination must not lie strictly inside the moved range.
+func (b *Buffer) Move(start, end, to int) {
+	if end < start || start < 0 || end > b.contentsLen() || to < 0 || to > b.contentsLen() {
+		panic("invalid edit position")
+	}
+	if start < to && to < end {
+		panic("invalid move destination")
+	}
+	text := b.text(start, end)
+	b.Delete(start, end)
+	b.Insert(to, text)
+}
+
+// Copy inserts a copy of the text old[start:end] at the original offset to.
+// Like Move, it copies the original text, captured when Copy is called.
+func (b *Buffer) Copy(start, end, to int) {
+	if end < start || start < 0 || end > b.contentsLen() {
+		panic("invalid edit position")
+	}
+	b.Insert(to, b.text(start, end))
+}
+
+// InversePatch returns edits that turn the edited data back into the original
+// data. The edits are in terms of offsets into the edited data, in increasing
+// order, and do not overlap; queueing them in a Buffer holding the edited data
+// and applying them reproduces the original exactly.
+//
+// Since Move and Copy are queued as plain edits, their inverses need no special
+// treatment: the inverse of a Move deletes the text at the destination and
+// restores it at the source, and the inverse of a Copy deletes the copy.
+func (b *Buffer) InversePatch() []Edit {
+	var specs []Edit
+	out := 0
+	b.walk(func(start, end int) error {
+		out += end - start
+		return nil
+	}, func(start, end int, new string) error {
+		if start == end && new == "" {
+			return nil
+		}
+		old := b.text(start, end)
+		if n := len(specs); n > 0 && specs[n-1].End == out {
+			specs[n-1].End += len(new)
+			specs[n-1].New += old
+		} else {
+			specs = append(specs, Edit{Start: out, End: out + len(new), New: old})
+		}
+		out += len(new)
+		return nil
+	})
+	return specs
+}
+
+// Inverse returns a buffer holding the edited data, with edits queued that
+// restore the original data, as for an undo facility: Inverse().String()
+// is the original data, and the inverse of the inverse produces the edited
+// data again. Inverse returns an error if the queued edits overlap.
+func (b *Buffer) Inverse() (*Buffer, error) {
+	out, err := b.Apply()
+	if err != nil {
+		return nil, err
+	}
+	return NewBufferFromEdits(out, b.InversePatch()), nil
+}
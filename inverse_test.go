@@ -0,0 +1,70 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package edit
+
+import "testing"
+
+func TestInversePatch(t *testing.T) {
+	const in = "0123456789"
+	tests := []struct {
+		name string
+		edit func(b *Buffer)
+		want string
+	}{
+		{"move after", func(b *Buffer) { b.Move(1, 3, 7) }, "0345612789"},
+		{"move before", func(b *Buffer) { b.Move(6, 9, 2) }, "0167823459"},
+		{"move to end", func(b *Buffer) { b.Move(0, 2, 10) }, "2345678901"},
+		{"copy after", func(b *Buffer) { b.Copy(1, 3, 7) }, "012345612789"},
+		{"copy before", func(b *Buffer) { b.Copy(6, 9, 2) }, "0167823456789"},
+		{"move with edits", func(b *Buffer) {
+			b.Move(1, 3, 7)
+			b.Replace(4, 5, "four")
+			b.Insert(7, "!")
+		}, "03four5612!789"},
+	}
+	for _, tt := range tests {
+		b := NewBufferString(in)
+		tt.edit(b)
+		out := b.String()
+		if out != tt.want {
+			t.Errorf("%s: String() = %q, want %q", tt.name, out, tt.want)
+			continue
+		}
+		inv := NewBufferString(out)
+		for _, s := range b.InversePatch() {
+			inv.Replace(s.Start, s.End, s.New)
+		}
+		if got := inv.String(); got != in {
+			t.Errorf("%s: inverse of %q = %q, want %q", tt.name, out, got, in)
+		}
+	}
+}
+
+func TestInverse(t *testing.T) {
+	const in = "hello, world\n"
+	b := NewBufferString(in)
+	b.Replace(0, 5, "goodbye")
+	b.Delete(5, 7)
+	b.Insert(12, "!")
+	inv, err := b.Inverse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := inv.String(), in; got != want {
+		t.Errorf("Inverse().String() = %q, want %q", got, want)
+	}
+	redo, err := inv.Inverse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := redo.String(), b.String(); got != want {
+		t.Errorf("Inverse().Inverse().String() = %q, want %q", got, want)
+	}
+
+	b.Replace(3, 8, "x")
+	if _, err := b.Inverse(); err == nil {
+		t.Errorf("Inverse with overlapping edits succeeded")
+	}
+}
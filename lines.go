@@ -0,0 +1,518 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package edit
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// lineStarts returns the offset in the original data at which each line begins.
+// Line n (1-based) begins at lineStarts()[n-1]. Every newline starts a new line,
+// so data ending in a newline has a final, empty line.
+func (b *Buffer) lineStarts() []int {
+	starts := []int{0}
+	if b.old != nil {
+		for off := 0; ; {
+			i := bytes.IndexByte(b.old[off:], '\n')
+			if i < 0 {
+				break
+			}
+			off += i + 1
+			starts = append(starts, off)
+		}
+		return starts
+	}
+	if b.src != nil {
+		// Read the data in chunks rather than all at once.
+		buf := make([]byte, 32<<10)
+		for base := 0; base < b.srcLen; base += len(buf) {
+			chunk := buf
+			if n := b.srcLen - base; n < len(chunk) {
+				chunk = chunk[:n]
+			}
+			b.readSrcAt(chunk, base)
+			for off := 0; ; {
+				i := bytes.IndexByte(chunk[off:], '\n')
+				if i < 0 {
+					break
+				}
+				off += i + 1
+				starts = append(starts, base+off)
+			}
+		}
+		return starts
+	}
+	for off := 0; ; {
+		i := strings.IndexByte(b.str[off:], '\n')
+		if i < 0 {
+			break
+		}
+		off += i + 1
+		starts = append(starts, off)
+	}
+	return starts
+}
+
+// lineSpan returns the range [start, end) of the original line containing off,
+// including its newline, given the line starts of the original data.
+func (b *Buffer) lineSpan(starts []int, off int) (start, end int) {
+	i := sort.SearchInts(starts, off+1) - 1
+	if i+1 < len(starts) {
+		return starts[i], starts[i+1]
+	}
+	return starts[i], b.contentsLen()
+}
+
+// LineStats returns the number of lines added and removed by the queued edits,
+// as reported by git diff --numstat. A final line without a newline counts as a line,
+// and a line that gains or loses its newline counts as changed.
+func (b *Buffer) LineStats() (added, removed int) {
+	// Expand each edit to the original lines it touches,
+	// merging edits that touch the same or adjacent lines.
+	type region struct {
+		start, end int
+		out        strings.Builder
+	}
+	var regions []*region
+	starts := b.lineStarts()
+	b.walk(func(start, end int) error {
+		return nil
+	}, func(start, end int, new string) error {
+		if start == end && new == "" {
+			return nil
+		}
+		// An edit ending just after a newline removes it,
+		// joining the next line, so that line is touched too.
+		rs, _ := b.lineSpan(starts, start)
+		_, re := b.lineSpan(starts, end)
+		if k := len(regions); k > 0 && rs <= regions[k-1].end {
+			regions[k-1].end = re
+		} else {
+			regions = append(regions, &region{start: rs, end: re})
+		}
+		return nil
+	})
+
+	// Render the edited text of each region.
+	si, ri := 0, 0
+	b.walk(func(start, end int) error {
+		for si < len(regions) && regions[si].end <= start {
+			si++
+		}
+		for k := si; k < len(regions) && regions[k].start < end; k++ {
+			r := regions[k]
+			lo, hi := start, end
+			if lo < r.start {
+				lo = r.start
+			}
+			if hi > r.end {
+				hi = r.end
+			}
+			r.out.WriteString(b.text(lo, hi))
+		}
+		return nil
+	}, func(start, end int, new string) error {
+		for ri < len(regions) && regions[ri].end < start {
+			ri++
+		}
+		if ri < len(regions) {
+			regions[ri].out.WriteString(new)
+		}
+		return nil
+	})
+
+	// Count the lines that differ, ignoring lines in common
+	// at the beginning and end of each region.
+	for _, r := range regions {
+		old, new := splitLines(b.text(r.start, r.end)), splitLines(r.out.String())
+		for len(old) > 0 && len(new) > 0 && old[0] == new[0] {
+			old, new = old[1:], new[1:]
+		}
+		for len(old) > 0 && len(new) > 0 && old[len(old)-1] == new[len(new)-1] {
+			old, new = old[:len(old)-1], new[:len(new)-1]
+		}
+		added += len(new)
+		removed += len(old)
+	}
+	return added, removed
+}
+
+// splitLines splits s into lines, each including its newline.
+// A final line without a newline is included; an empty s has no lines.
+func splitLines(s string) []string {
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// OutputLineToOriginal returns the range [start, end) of original data that
+// produced the given 1-based line of the edited data. Replacement text is
+// attributed to the whole range it replaces; if the line mixes original and
+// replacement text, the range spans all of it. OutputLineToOriginal reports
+// false if the line consists entirely of inserted text, or is the empty line
+// after a final newline. It panics if the edited data has no such line.
+func (b *Buffer) OutputLineToOriginal(outLine int) (start, end int, ok bool) {
+	if outLine < 1 {
+		panic("invalid line number")
+	}
+	line := 1
+	add := func(s, e int) {
+		if !ok {
+			start, end, ok = s, e, true
+			return
+		}
+		if e > end {
+			end = e
+		}
+	}
+	// piece accounts for the output text, which came from the original range [s, e).
+	// If exact is set, each byte of text corresponds to the original byte at the same
+	// position in [s, e).
+	piece := func(text string, s, e int, exact bool) error {
+		for len(text) > 0 && line <= outLine {
+			n := strings.IndexByte(text, '\n') + 1
+			if n == 0 {
+				n = len(text)
+			}
+			if line == outLine {
+				if exact {
+					add(s, s+n)
+				} else if e > s {
+					add(s, e)
+				}
+			}
+			if text[n-1] == '\n' {
+				line++
+			}
+			text = text[n:]
+			if exact {
+				s += n
+			}
+		}
+		if line > outLine {
+			return errStopWalk
+		}
+		return nil
+	}
+	b.walk(func(s, e int) error {
+		return piece(b.text(s, e), s, e, true)
+	}, func(s, e int, new string) error {
+		return piece(new, s, e, false)
+	})
+	if line < outLine {
+		panic("invalid line number")
+	}
+	return start, end, ok
+}
+
+// StringWithLineNumbers returns the data with queued edits applied, for display,
+// with each line prefixed by its line number, counting from start,
+// right-aligned to the width of the largest number and followed by a space.
+// As with cat -n, a final newline does not start another numbered line,
+// and a final line without a newline is numbered and left without one.
+func (b *Buffer) StringWithLineNumbers(start int) string {
+	lines := splitLines(b.String())
+	if len(lines) == 0 {
+		return ""
+	}
+	width := len(strconv.Itoa(start + len(lines) - 1))
+	if w := len(strconv.Itoa(start)); w > width {
+		width = w // start is negative
+	}
+	var sb strings.Builder
+	for i, line := range lines {
+		fmt.Fprintf(&sb, "%*d %s", width, start+i, line)
+	}
+	return sb.String()
+}
+
+// ResultLines returns the lines of the data with queued edits applied,
+// without their newlines. As with strings.Split, and with the line numbers
+// used by EditsOnLine, every newline starts a new line, so data ending in a
+// newline has a final, empty line, and empty data has a single empty line.
+func (b *Buffer) ResultLines() []string {
+	return strings.Split(b.String(), "\n")
+}
+
+// A LineIndex converts line and column positions in the original data
+// of a Buffer to byte offsets, for use with Insert, Delete, and Replace.
+type LineIndex struct {
+	starts []int  // offset of the start of each line
+	crlf   []bool // whether each line ends in "\r\n"; nil if none does
+	n      int    // length of the data
+}
+
+// Lines returns a LineIndex for the original data of b.
+// The index holds the offset of each line, so it is cheap to query repeatedly.
+func (b *Buffer) Lines() *LineIndex {
+	x := &LineIndex{starts: b.lineStarts(), n: b.contentsLen()}
+	for i, start := range x.starts[1:] {
+		if start >= 2 && b.byteAt(start-2) == '\r' {
+			if x.crlf == nil {
+				x.crlf = make([]bool, len(x.starts))
+			}
+			x.crlf[i] = true
+		}
+	}
+	return x
+}
+
+// Offset returns the byte offset of the given 1-based line and 0-based
+// column, counted in bytes. A column past the end of the line is clamped to
+// the offset of the line's newline, or of the "\r" of a "\r\n", or for a final
+// line without a newline, to the end of the data. Lines are numbered as by EditsOnLine.
+// Offset panics if the data has no such line or col is negative.
+func (x *LineIndex) Offset(line, col int) int {
+	if line < 1 || line > len(x.starts) {
+		panic("invalid line number")
+	}
+	if col < 0 {
+		panic("invalid column")
+	}
+	end := x.n
+	if line < len(x.starts) {
+		end = x.starts[line] - 1 // the newline
+		if x.crlf != nil && x.crlf[line-1] {
+			end--
+		}
+	}
+	if off := x.starts[line-1] + col; off < end {
+		return off
+	}
+	return end
+}
+
+// lineIndex returns the line index of the original data, computing it on first use.
+func (b *Buffer) lineIndex() *LineIndex {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.lines == nil {
+		b.lines = b.Lines()
+	}
+	return b.lines
+}
+
+// The line and column methods address the original data by 1-based line
+// and 0-based column, as LineIndex.Offset does: columns count bytes, so a
+// tab is one column and a multi-byte UTF-8 sequence is several; the 1-based
+// column c of a go/token.Position is column c-1. A column past the end of a
+// line is clamped to the line's newline, before any "\r". They panic if a line does not exist.
+
+// InsertAt inserts new at the given line and column of the original data.
+func (b *Buffer) InsertAt(line, col int, new string) {
+	b.Insert(b.lineIndex().Offset(line, col), new)
+}
+
+// ReplaceRange replaces the original data from startLine, startCol up to
+// endLine, endCol with new.
+func (b *Buffer) ReplaceRange(startLine, startCol, endLine, endCol int, new string) {
+	x := b.lineIndex()
+	b.Replace(x.Offset(startLine, startCol), x.Offset(endLine, endCol), new)
+}
+
+// DeleteLines deletes the original lines startLine through endLine, inclusive,
+// along with the newline ending endLine, if any.
+func (b *Buffer) DeleteLines(startLine, endLine int) {
+	x := b.lineIndex()
+	if startLine < 1 || endLine < startLine || endLine > len(x.starts) {
+		panic("invalid line number")
+	}
+	end := x.n
+	if endLine < len(x.starts) {
+		end = x.starts[endLine]
+	}
+	b.Delete(x.starts[startLine-1], end)
+}
+
+// ReplaceLine replaces the text of the original line n with text,
+// keeping the newline that ends the line, if any, including a "\r" before it.
+func (b *Buffer) ReplaceLine(n int, text string) {
+	x := b.lineIndex()
+	b.Replace(x.starts[x.line(n)], x.Offset(n, x.n), text)
+}
+
+// InsertLinesAfter inserts lines, each ending in a newline, after the original
+// line n, so that the first inserted line follows line n; n == 0 inserts them
+// before the first line. After the final line, which has no newline, a newline
+// is inserted first to end it, and the last inserted line has none.
+func (b *Buffer) InsertLinesAfter(n int, lines []string) {
+	x := b.lineIndex()
+	if n != 0 {
+		x.line(n)
+	}
+	if len(lines) == 0 {
+		return
+	}
+	if n < len(x.starts) {
+		b.Insert(x.starts[n], strings.Join(lines, "\n")+"\n")
+		return
+	}
+	b.Insert(x.n, "\n"+strings.Join(lines, "\n"))
+}
+
+// line returns the 0-based index of the 1-based line n, panicking if there is no such line.
+func (x *LineIndex) line(n int) int {
+	if n < 1 || n > len(x.starts) {
+		panic("invalid line number")
+	}
+	return n - 1
+}
+
+// SetTabWidth sets the width of a tab, in visual columns, for VisualColumn,
+// VisualOffset, and ReplaceAtColumn. A width of 0 or less restores the default, 8.
+func (b *Buffer) SetTabWidth(n int) {
+	b.tabWidth = n
+}
+
+// The visual column methods address the original data by 1-based line and
+// 0-based visual column, as a text editor or a compiler reporting columns
+// with expanded tabs would: a tab advances to the next multiple of the tab
+// width (see SetTabWidth), and every other character, including a multi-byte
+// UTF-8 sequence, is one column wide. The 1-based column c of a diagnostic is
+// visual column c-1. They panic if a line does not exist.
+
+// VisualColumn returns the line and visual column of the original offset off.
+func (b *Buffer) VisualColumn(off int) (line, col int) {
+	if off < 0 || off > b.contentsLen() {
+		panic("invalid offset")
+	}
+	starts := b.lineIndex().starts
+	line = sort.SearchInts(starts, off+1)
+	col = b.visualScan(starts[line-1], off, func(int, int, int) bool { return true })
+	return line, col
+}
+
+// VisualOffset returns the original offset of the character at the given line
+// and visual column. A column inside a tab gives the offset of the tab.
+// A column past the end of the line is clamped as by LineIndex.Offset.
+func (b *Buffer) VisualOffset(line, col int) int {
+	x := b.lineIndex()
+	x.line(line)
+	if col < 0 {
+		panic("invalid column")
+	}
+	end := x.Offset(line, x.n)
+	off := end
+	b.visualScan(x.starts[line-1], end, func(o, c, next int) bool {
+		if col < next {
+			off = o
+			return false
+		}
+		return true
+	})
+	return off
+}
+
+// ReplaceAtColumn replaces the original data on line from visual column
+// startCol up to endCol with new. As with VisualOffset, a column inside
+// a tab refers to the whole tab.
+func (b *Buffer) ReplaceAtColumn(line, startCol, endCol int, new string) {
+	start := b.VisualOffset(line, startCol)
+	end := b.VisualOffset(line, endCol)
+	if endCol > startCol && end == start && start < b.contentsLen() && b.byteAt(start) == '\t' {
+		end++ // both columns are inside the tab
+	}
+	b.Replace(start, end, new)
+}
+
+// visualScan calls fn for each character of the original data in [start, end),
+// which must begin a line, with its offset, its visual column, and the
+// visual column following it, until fn returns false.
+// It returns the visual column reached.
+func (b *Buffer) visualScan(start, end int, fn func(off, col, next int) bool) int {
+	tw := b.tabWidth
+	if tw <= 0 {
+		tw = 8
+	}
+	text := b.text(start, end)
+	c := 0
+	for i := 0; i < len(text); {
+		next := c + 1
+		n := 1
+		if text[i] == '\t' {
+			next = (c/tw + 1) * tw
+		} else {
+			_, n = utf8.DecodeRuneInString(text[i:])
+		}
+		if !fn(start+i, c, next) {
+			break
+		}
+		c = next
+		i += n
+	}
+	return c
+}
+
+// LineMap returns, for each line of the data with queued edits applied, the
+// 1-based line of the original data it came from: LineMap()[i] is the origin of
+// output line i+1. A line that begins with unchanged data comes from the original
+// line holding that data; a line that begins with replacement text comes from
+// the original line where the edit starts. Lines are split as by
+// StringWithLineNumbers: a final newline does not start another line.
+func (b *Buffer) LineMap() []int {
+	starts := b.lineIndex().starts
+	line := func(off int) int {
+		return sort.Search(len(starts), func(i int) bool { return starts[i] > off })
+	}
+	var m []int
+	atStart := true // the next output byte begins a line
+	b.walk(func(start, end int) error {
+		if atStart {
+			m = append(m, line(start))
+		}
+		// The original lines after each newline in the span begin output lines.
+		l := line(start)
+		for l < len(starts) && starts[l] < end {
+			m = append(m, l+1)
+			l++
+		}
+		atStart = b.byteAt(end-1) == '\n'
+		return nil
+	}, func(start, end int, new string) error {
+		if new == "" {
+			return nil
+		}
+		if atStart {
+			m = append(m, line(start))
+		}
+		for i := 0; i < len(new)-1; i++ {
+			if new[i] == '\n' {
+				m = append(m, line(start))
+			}
+		}
+		atStart = new[len(new)-1] == '\n'
+		return nil
+	})
+	return m
+}
+
+// StringWithLineDirectives returns the data with queued edits applied, with
+// //line directives inserted so that the Go compiler reports positions in
+// the output as the positions given by LineMap in the named original file.
+// A directive precedes each output line whose original line does not follow
+// that of the line before it; when edits change only part of a line,
+// or insert no newlines, no directives are needed.
+func (b *Buffer) StringWithLineDirectives(filename string) string {
+	m := b.LineMap()
+	var sb strings.Builder
+	for i, l := range splitLines(b.String()) {
+		want := 1
+		if i > 0 {
+			want = m[i-1] + 1
+		}
+		if m[i] != want {
+			fmt.Fprintf(&sb, "//line %s:%d\n", filename, m[i])
+		}
+		sb.WriteString(l)
+	}
+	return sb.String()
+}
@@ -0,0 +1,320 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package edit
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestLineStats(t *testing.T) {
+	const in = "one\ntwo\nthree\nfour"
+	tests := []struct {
+		name           string
+		run            func(b *Buffer)
+		added, removed int
+	}{
+		{"none", func(b *Buffer) {}, 0, 0},
+		{"insert line", func(b *Buffer) { b.Insert(4, "1.5\n") }, 1, 0},
+		{"delete line", func(b *Buffer) { b.Delete(4, 8) }, 0, 1},
+		{"change word", func(b *Buffer) { b.Replace(4, 7, "TWO") }, 1, 1},
+		{"identity", func(b *Buffer) { b.Replace(4, 7, "two") }, 0, 0},
+		{"split line", func(b *Buffer) { b.Insert(6, "\n") }, 2, 1},
+		{"join lines", func(b *Buffer) { b.Delete(7, 8) }, 1, 2},
+		{"add final newline", func(b *Buffer) { b.Insert(18, "\n") }, 1, 1},
+		{"append line", func(b *Buffer) { b.Insert(18, "\nfive") }, 2, 1},
+		{"two regions", func(b *Buffer) {
+			b.Replace(0, 1, "O")
+			b.Delete(13, 18)
+		}, 2, 3},
+	}
+	for _, tt := range tests {
+		b := NewBufferString(in)
+		tt.run(b)
+		added, removed := b.LineStats()
+		if added != tt.added || removed != tt.removed {
+			t.Errorf("%s: LineStats() = +%d -%d, want +%d -%d", tt.name, added, removed, tt.added, tt.removed)
+		}
+	}
+}
+
+func TestOutputLineToOriginal(t *testing.T) {
+	b := NewBufferString("one\ntwo\nthree\nfour\n")
+	b.Insert(4, "inserted\n")
+	b.Replace(9, 12, "3\n3") // "hre" of three
+	b.Delete(14, 18)         // "four"
+	// Output: one\n inserted\n two\n t3\n 3e\n \n
+
+	tests := []struct {
+		line       int
+		start, end int
+		ok         bool
+	}{
+		{1, 0, 4, true},
+		{2, 0, 0, false},
+		{3, 4, 8, true},
+		{4, 8, 12, true},
+		{5, 9, 14, true},
+		{6, 18, 19, true},
+		{7, 0, 0, false},
+	}
+	for _, tt := range tests {
+		start, end, ok := b.OutputLineToOriginal(tt.line)
+		if start != tt.start || end != tt.end || ok != tt.ok {
+			t.Errorf("OutputLineToOriginal(%d) = %d, %d, %v; want %d, %d, %v", tt.line, start, end, ok, tt.start, tt.end, tt.ok)
+		}
+	}
+	for _, line := range []int{0, 8} {
+		t.Run(fmt.Sprint(line), func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("OutputLineToOriginal(%d) did not panic", line)
+				}
+			}()
+			b.OutputLineToOriginal(line)
+		})
+	}
+}
+
+func TestStringWithLineNumbers(t *testing.T) {
+	tests := []struct {
+		in    string
+		start int
+		want  string
+	}{
+		{"", 1, ""},
+		{"a\nb\n", 1, "1 a\n2 b\n"},
+		{"a\n\nc", 9, " 9 a\n10 \n11 c"},
+	}
+	for _, tt := range tests {
+		b := NewBufferString("")
+		b.Insert(0, tt.in)
+		if got := b.StringWithLineNumbers(tt.start); got != tt.want {
+			t.Errorf("StringWithLineNumbers(%d) for %q = %q, want %q", tt.start, tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestResultLines(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{"", []string{""}},
+		{"a", []string{"a"}},
+		{"a\n", []string{"a", ""}},
+		{"a\r\n\nb", []string{"a\r", "", "b"}},
+	}
+	for _, tt := range tests {
+		b := NewBufferString("x")
+		b.Replace(0, 1, tt.in)
+		if got := b.ResultLines(); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ResultLines() of %q = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestLineIndex(t *testing.T) {
+	b := NewBufferString("first\nsecond line\n\nlast")
+	x := b.Lines()
+	tests := []struct{ line, col, want int }{
+		{1, 0, 0},
+		{1, 3, 3},
+		{1, 5, 5},  // the newline
+		{1, 99, 5}, // clamped to the newline
+		{2, 0, 6},
+		{2, 7, 13},
+		{3, 0, 18},
+		{3, 1, 18},
+		{4, 2, 21},
+		{4, 4, 23},
+		{4, 99, 23}, // clamped to the end of the data
+	}
+	for _, tt := range tests {
+		if got := x.Offset(tt.line, tt.col); got != tt.want {
+			t.Errorf("Offset(%d, %d) = %d, want %d", tt.line, tt.col, got, tt.want)
+		}
+	}
+	crlf := NewBufferString("ab\r\n\r\nc").Lines()
+	for _, tt := range []struct{ line, col, want int }{
+		{1, 1, 1},
+		{1, 2, 2},  // the "\r"
+		{1, 99, 2}, // clamped to the "\r", not the "\n"
+		{2, 99, 4},
+		{3, 99, 7},
+	} {
+		if got := crlf.Offset(tt.line, tt.col); got != tt.want {
+			t.Errorf("CRLF Offset(%d, %d) = %d, want %d", tt.line, tt.col, got, tt.want)
+		}
+	}
+	b.Replace(x.Offset(2, 0), x.Offset(2, 6), "2nd")
+	b.Insert(x.Offset(4, 99), "!")
+	if got, want := b.String(), "first\n2nd line\n\nlast!"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+	for _, line := range []int{0, 5} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Offset(%d, 0) did not panic", line)
+				}
+			}()
+			x.Offset(line, 0)
+		}()
+	}
+}
+
+func TestLineColumnEdits(t *testing.T) {
+	b := NewBufferString("first\n\tsécond line\n\nlast")
+	b.InsertAt(1, 99, "!")
+	b.ReplaceRange(2, 1, 2, 8, "2nd") // "sécond" is 7 bytes
+	b.DeleteLines(3, 3)
+	b.InsertAt(4, 0, "the ")
+	if got, want := b.String(), "first!\n\t2nd line\nthe last"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+
+	b = NewBufferString("a\nb\nc")
+	b.DeleteLines(2, 3)
+	if got, want := b.String(), "a\n"; got != want {
+		t.Errorf("DeleteLines(2, 3) produced %q, want %q", got, want)
+	}
+	for _, r := range [][2]int{{0, 1}, {2, 1}, {1, 4}} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("DeleteLines(%d, %d) did not panic", r[0], r[1])
+				}
+			}()
+			b.DeleteLines(r[0], r[1])
+		}()
+	}
+}
+
+func TestLineEdits(t *testing.T) {
+	b := NewBufferString("[core]\nname = old\n\n[extra]\nlast = 1")
+	b.ReplaceLine(2, "name = new")
+	b.InsertLinesAfter(0, []string{"# generated", ""})
+	b.InsertLinesAfter(3, []string{"[added]", "x = y"})
+	b.InsertLinesAfter(5, []string{"end = true"})
+	b.InsertLinesAfter(4, nil)
+	if got, want := b.String(), "# generated\n\n[core]\nname = new\n\n[added]\nx = y\n[extra]\nlast = 1\nend = true"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+
+	b = NewBufferString("a\r\nb\r\n")
+	b.ReplaceLine(1, "x")
+	if got, want := b.String(), "x\r\nb\r\n"; got != want {
+		t.Errorf("ReplaceLine(1, \"x\") on CRLF data produced %q, want %q", got, want)
+	}
+
+	b = NewBufferString("a\n")
+	b.ReplaceLine(2, "b")
+	if got, want := b.String(), "a\nb"; got != want {
+		t.Errorf("ReplaceLine(2, \"b\") produced %q, want %q", got, want)
+	}
+	for _, n := range []int{0, 3} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("ReplaceLine(%d) did not panic", n)
+				}
+			}()
+			b.ReplaceLine(n, "")
+		}()
+	}
+	for _, n := range []int{-1, 3} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("InsertLinesAfter(%d) did not panic", n)
+				}
+			}()
+			b.InsertLinesAfter(n, []string{"x"})
+		}()
+	}
+}
+
+func TestVisualColumns(t *testing.T) {
+	const src = "a\tb\n\t\tx := \"é\"\n"
+	b := NewBufferString(src)
+	for _, tt := range []struct {
+		line, col int
+		off       int
+	}{
+		{1, 0, 0},
+		{1, 1, 1}, // the tab
+		{1, 7, 1},
+		{1, 8, 2},
+		{1, 9, 3}, // the newline
+		{1, 99, 3},
+		{2, 0, 4},
+		{2, 8, 5},
+		{2, 16, 6},
+		{2, 22, 12}, // é is one column and two bytes
+		{2, 23, 14},
+		{3, 5, len(src)},
+	} {
+		if got := b.VisualOffset(tt.line, tt.col); got != tt.off {
+			t.Errorf("VisualOffset(%d, %d) = %d, want %d", tt.line, tt.col, got, tt.off)
+		}
+	}
+	for _, tt := range []struct {
+		off       int
+		line, col int
+	}{
+		{0, 1, 0}, {2, 1, 8}, {3, 1, 9}, {6, 2, 16}, {14, 2, 23}, {len(src), 3, 0},
+	} {
+		if line, col := b.VisualColumn(tt.off); line != tt.line || col != tt.col {
+			t.Errorf("VisualColumn(%d) = %d, %d, want %d, %d", tt.off, line, col, tt.line, tt.col)
+		}
+	}
+
+	b.SetTabWidth(4)
+	if got, want := b.VisualOffset(2, 8), 6; got != want {
+		t.Errorf("with tab width 4, VisualOffset(2, 8) = %d, want %d", got, want)
+	}
+	b.ReplaceAtColumn(2, 8, 9, "y")
+	b.ReplaceAtColumn(1, 2, 3, " ") // inside the tab
+	if got, want := b.String(), "a b\n\t\ty := \"é\"\n"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+	for _, f := range []func(){
+		func() { b.VisualOffset(4, 0) },
+		func() { b.VisualOffset(1, -1) },
+		func() { b.VisualColumn(len(src) + 1) },
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("invalid position did not panic")
+				}
+			}()
+			f()
+		}()
+	}
+}
+
+func TestLineMap(t *testing.T) {
+	b := NewBufferString("package p\n\nfunc f() {\n\tg()\n}\n")
+	b.Insert(22, "\tcount()\n")       // before line 4
+	b.Replace(23, 26, "h(1,\n\t\t2)") // line 4 becomes two lines
+	b.Delete(0, 11)                   // lines 1 and 2
+	// Output:
+	//	func f() {
+	//		count()
+	//		h(1,
+	//			2)
+	//	}
+	want := []int{3, 4, 4, 4, 5}
+	if got := b.LineMap(); !reflect.DeepEqual(got, want) {
+		t.Errorf("LineMap() = %v, want %v", got, want)
+	}
+	wantSrc := "//line p.go:3\nfunc f() {\n\tcount()\n//line p.go:4\n\th(1,\n//line p.go:4\n\t\t2)\n}\n"
+	if got := b.StringWithLineDirectives("p.go"); got != wantSrc {
+		t.Errorf("StringWithLineDirectives() =\n%s\nwant:\n%s", got, wantSrc)
+	}
+}
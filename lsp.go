@@ -0,0 +1,129 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package edit
+
+import (
+	"fmt"
+	"sort"
+	"unicode/utf8"
+)
+
+// A Position is a position in a text document as used by the Language Server
+// Protocol: a 0-based line and a 0-based character offset within that line,
+// counted in UTF-16 code units. Lines are separated by "\n"; a "\r" before
+// the "\n" is part of the line terminator.
+type Position struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+// A Range is a range in a text document as used by the Language Server Protocol.
+// The End position is exclusive.
+type Range struct {
+	Start Position `json:"start"`
+	End   Position `json:"end"`
+}
+
+// A TextEdit is an edit in the form used by the Language Server Protocol:
+// replace the text in Range with NewText.
+type TextEdit struct {
+	Range   Range  `json:"range"`
+	NewText string `json:"newText"`
+}
+
+// TextEdits returns the normalized edits (see EditsHash) as LSP text edits,
+// with positions in the original data. The edits are in increasing order and
+// do not overlap, as the protocol requires of the edits to a single document.
+func (b *Buffer) TextEdits() []TextEdit {
+	specs := b.normalized()
+	tes := make([]TextEdit, len(specs))
+	for i, s := range specs {
+		tes[i] = TextEdit{
+			Range:   Range{Start: b.position(s.Start), End: b.position(s.End)},
+			NewText: s.New,
+		}
+	}
+	return tes
+}
+
+// AddTextEdits queues the LSP text edits tes, whose positions are in the original data.
+// As the protocol specifies, a line past the last line refers to the end of the data,
+// and a character past the end of a line refers to the end of the line.
+// If a position is negative, falls inside a character encoded as a UTF-16
+// surrogate pair, or a range is inverted, AddTextEdits returns an error and queues nothing.
+func (b *Buffer) AddTextEdits(tes []TextEdit) error {
+	specs := make([]Edit, len(tes))
+	for i, te := range tes {
+		start, err := b.lspOffset(te.Range.Start)
+		if err != nil {
+			return err
+		}
+		end, err := b.lspOffset(te.Range.End)
+		if err != nil {
+			return err
+		}
+		if end < start {
+			return fmt.Errorf("edit: inverted text edit range %v", te.Range)
+		}
+		specs[i] = Edit{Start: start, End: end, New: te.NewText}
+	}
+	for _, s := range specs {
+		b.Replace(s.Start, s.End, s.New)
+	}
+	return nil
+}
+
+// position returns the LSP position of the offset off in the original data.
+func (b *Buffer) position(off int) Position {
+	starts := b.lineIndex().starts
+	line := sort.Search(len(starts), func(i int) bool { return starts[i] > off }) - 1
+	return Position{Line: line, Character: utf16Len(b.text(starts[line], off))}
+}
+
+// lspOffset returns the offset in the original data of the LSP position p.
+func (b *Buffer) lspOffset(p Position) (int, error) {
+	if p.Line < 0 || p.Character < 0 {
+		return 0, fmt.Errorf("edit: invalid position %d:%d", p.Line, p.Character)
+	}
+	x := b.lineIndex()
+	if p.Line >= len(x.starts) {
+		return x.n, nil
+	}
+	start, end := x.starts[p.Line], x.n
+	if p.Line+1 < len(x.starts) {
+		end = x.starts[p.Line+1] - 1 // the newline
+		if end > start && b.byteAt(end-1) == '\r' {
+			end--
+		}
+	}
+	off, units := start, 0
+	line := b.text(start, end)
+	for units < p.Character && off < end {
+		r, size := utf8.DecodeRuneInString(line[off-start:])
+		w := 1
+		if r >= 0x10000 {
+			w = 2
+		}
+		if units+w > p.Character {
+			return 0, fmt.Errorf("edit: position %d:%d splits a UTF-16 surrogate pair", p.Line, p.Character)
+		}
+		units += w
+		off += size
+	}
+	return off, nil
+}
+
+// utf16Len returns the number of UTF-16 code units needed to encode s,
+// counting each invalid UTF-8 byte as one, as if it were U+FFFD.
+func utf16Len(s string) int {
+	n := 0
+	for _, r := range s {
+		n++
+		if r >= 0x10000 {
+			n++
+		}
+	}
+	return n
+}
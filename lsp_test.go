@@ -0,0 +1,61 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package edit
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTextEdits(t *testing.T) {
+	const src = "héllo 😀 world\r\nsecond\n"
+	b := NewBufferString(src)
+	b.Replace(12, 17, "there") // "world": after é (2 bytes) and 😀 (4 bytes)
+	b.Insert(19, ">")          // start of "second"
+	b.Insert(len(src), "end")
+	want := []TextEdit{
+		{Range{Position{0, 9}, Position{0, 14}}, "there"},
+		{Range{Position{1, 0}, Position{1, 0}}, ">"},
+		{Range{Position{2, 0}, Position{2, 0}}, "end"},
+	}
+	got := b.TextEdits()
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("TextEdits() = %v, want %v", got, want)
+	}
+
+	nb := NewBufferString(src)
+	if err := nb.AddTextEdits(got); err != nil {
+		t.Fatal(err)
+	}
+	if nb.String() != b.String() {
+		t.Errorf("AddTextEdits(TextEdits()) produced %q, want %q", nb.String(), b.String())
+	}
+
+	nb = NewBufferString(src)
+	err := nb.AddTextEdits([]TextEdit{
+		{Range{Position{0, 99}, Position{0, 99}}, "!"}, // end of line, before \r\n
+		{Range{Position{9, 0}, Position{9, 5}}, "?"},   // end of data
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := nb.String(), "héllo 😀 world!\r\nsecond\n?"; got != want {
+		t.Errorf("AddTextEdits with clamped positions produced %q, want %q", got, want)
+	}
+
+	for _, bad := range []Range{
+		{Position{0, 7}, Position{0, 7}},  // inside 😀
+		{Position{-1, 0}, Position{0, 0}}, // negative
+		{Position{1, 2}, Position{1, 1}},  // inverted
+	} {
+		nb := NewBufferString(src)
+		if err := nb.AddTextEdits([]TextEdit{{Range{}, "ok"}, {bad, "x"}}); err == nil {
+			t.Errorf("AddTextEdits accepted range %v", bad)
+		}
+		if nb.Len() != 0 {
+			t.Errorf("AddTextEdits queued edits despite error for range %v", bad)
+		}
+	}
+}
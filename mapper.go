@@ -0,0 +1,83 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package edit
+
+import "sort"
+
+// An OffsetMapper translates offsets between the original data of a Buffer
+// and the edited data, for translating many offsets without walking
+// the queued edits for each one. It reflects the edits queued when
+// it was created; later edits to the Buffer do not affect it.
+type OffsetMapper struct {
+	pieces []mapPiece // in output order
+	oldLen int
+	newLen int
+}
+
+// A mapPiece is a kept span of original data or an applied edit,
+// occupying [start, end) of the original data and [out, outEnd) of the edited data.
+type mapPiece struct {
+	start, end  int
+	out, outEnd int
+	kept        bool // a kept span, rather than an edit
+}
+
+// NewOffsetMapper returns an OffsetMapper for the edits queued in b.
+// It panics if the queued edits overlap.
+func (b *Buffer) NewOffsetMapper() *OffsetMapper {
+	m := &OffsetMapper{oldLen: b.contentsLen()}
+	out := 0
+	b.walk(func(start, end int) error {
+		m.pieces = append(m.pieces, mapPiece{start, end, out, out + end - start, true})
+		out += end - start
+		return nil
+	}, func(start, end int, new string) error {
+		m.pieces = append(m.pieces, mapPiece{start, end, out, out + len(new), false})
+		out += len(new)
+		return nil
+	})
+	m.newLen = out
+	return m
+}
+
+// Map returns the offset in the edited data corresponding to the offset pos
+// in the original data. It agrees with Buffer.Offset: insertions at pos
+// shift it forward, and a position inside a replaced or deleted range,
+// including at its start, maps to the start of its replacement text.
+// Map panics if pos is not in [0, len(original)].
+func (m *OffsetMapper) Map(pos int) int {
+	if pos < 0 || pos > m.oldLen {
+		panic("invalid offset")
+	}
+	i := sort.Search(len(m.pieces), func(i int) bool { return m.pieces[i].end > pos })
+	if i == len(m.pieces) {
+		return m.newLen
+	}
+	p := m.pieces[i]
+	if p.kept {
+		return p.out + pos - p.start
+	}
+	return p.out
+}
+
+// Unmap returns the offset in the original data corresponding to the offset pos
+// in the edited data. It is the inverse of Map for offsets in unchanged data.
+// An offset inside inserted or replacement text, including at its start,
+// maps to the start of the original range the text replaced.
+// Unmap panics if pos is not in [0, len(edited)].
+func (m *OffsetMapper) Unmap(pos int) int {
+	if pos < 0 || pos > m.newLen {
+		panic("invalid offset")
+	}
+	i := sort.Search(len(m.pieces), func(i int) bool { return m.pieces[i].outEnd > pos })
+	if i == len(m.pieces) {
+		return m.oldLen
+	}
+	p := m.pieces[i]
+	if p.kept {
+		return p.start + pos - p.out
+	}
+	return p.start
+}
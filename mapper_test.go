@@ -0,0 +1,44 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package edit
+
+import "testing"
+
+func TestOffsetMapper(t *testing.T) {
+	b := NewBufferString("0123456789")
+	b.Insert(2, "ab")
+	b.Replace(4, 6, "R")
+	b.Delete(7, 8)
+	b.Insert(10, "!")
+	// Edited: "01ab23R689!"
+	m := b.NewOffsetMapper()
+	for pos := 0; pos <= 10; pos++ {
+		if got, want := m.Map(pos), b.Offset(pos); got != want {
+			t.Errorf("Map(%d) = %d, want %d", pos, got, want)
+		}
+	}
+	unmap := []int{0, 1, 2, 2, 2, 3, 4, 6, 8, 9, 10, 10}
+	for pos, want := range unmap {
+		if got := m.Unmap(pos); got != want {
+			t.Errorf("Unmap(%d) = %d, want %d", pos, got, want)
+		}
+	}
+	for _, pos := range []int{-1, 12} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Unmap(%d) did not panic", pos)
+				}
+			}()
+			m.Unmap(pos)
+		}()
+	}
+
+	// The mapper is a snapshot.
+	b.Insert(0, "xyz")
+	if got := m.Map(1); got != 1 {
+		t.Errorf("Map(1) after a later edit = %d, want 1", got)
+	}
+}
@@ -0,0 +1,40 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package edit
+
+// NewBufferStringMarkers returns a new buffer to accumulate changes to an
+// initial string, such as the output of a template, along with named offsets
+// into it, such as positions the template recorded while rendering.
+// Edits can then be addressed by marker name using InsertAtMarker.
+// NewBufferStringMarkers panics if a marker offset is outside old.
+// The buffer keeps its own copy of markers.
+func NewBufferStringMarkers(old string, markers map[string]int) *Buffer {
+	b := NewBufferString(old)
+	b.markers = make(map[string]int, len(markers))
+	for name, off := range markers {
+		if off < 0 || off > len(old) {
+			panic("invalid marker position for " + name)
+		}
+		b.markers[name] = off
+	}
+	return b
+}
+
+// MarkerOffset returns the original offset of the named marker,
+// and reports whether the marker exists.
+func (b *Buffer) MarkerOffset(name string) (int, bool) {
+	off, ok := b.markers[name]
+	return off, ok
+}
+
+// InsertAtMarker inserts the new string at the offset of the named marker.
+// It panics if there is no such marker.
+func (b *Buffer) InsertAtMarker(name, new string) {
+	off, ok := b.markers[name]
+	if !ok {
+		panic("unknown marker " + name)
+	}
+	b.Insert(off, new)
+}
@@ -0,0 +1,44 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package edit
+
+import (
+	"strings"
+	"testing"
+	"text/template"
+)
+
+func TestInsertAtMarker(t *testing.T) {
+	// The template records the offset of each marker as it renders.
+	var sb strings.Builder
+	markers := make(map[string]int)
+	tmpl := template.Must(template.New("").Funcs(template.FuncMap{
+		"marker": func(name string) string {
+			markers[name] = sb.Len()
+			return ""
+		},
+	}).Parse("package {{.}}\n\nimport ({{marker \"imports\"}}\n)\n{{marker \"end\"}}"))
+	if err := tmpl.Execute(&sb, "p"); err != nil {
+		t.Fatal(err)
+	}
+
+	b := NewBufferStringMarkers(sb.String(), markers)
+	b.InsertAtMarker("imports", "\n\t\"fmt\"")
+	b.InsertAtMarker("end", "\nvar _ = fmt.Println\n")
+	want := "package p\n\nimport (\n\t\"fmt\"\n)\n\nvar _ = fmt.Println\n"
+	if got := b.String(); got != want {
+		t.Errorf("b.String() = %q, want %q", got, want)
+	}
+	if _, ok := b.MarkerOffset("missing"); ok {
+		t.Errorf("MarkerOffset(missing) reported ok")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("InsertAtMarker with unknown marker did not panic")
+		}
+	}()
+	b.InsertAtMarker("missing", "x")
+}
@@ -0,0 +1,121 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package edit
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Merge adds the edits queued in other to b, after those already queued in b,
+// as when combining the edits produced by separate passes over the same data.
+// The two buffers must have the same original data; Merge panics if they do not.
+// Overlapping edits are detected when the edits are applied, as usual.
+func (b *Buffer) Merge(other *Buffer) {
+	if err := b.TryMerge(other); err != nil {
+		panic("merged buffers have different original data")
+	}
+}
+
+// TryMerge is like Merge but returns an error instead of panicking
+// if the buffers have different original data.
+func (b *Buffer) TryMerge(other *Buffer) error {
+	if !b.sameContents(other) {
+		return fmt.Errorf("edit: cannot merge buffers with different original data (lengths %d and %d)", b.contentsLen(), other.contentsLen())
+	}
+	// Give other's edits source ids distinct from those already in b.
+	base := b.sources + 1
+	for _, e := range other.q {
+		e.source += base
+		b.q = append(b.q, e)
+	}
+	b.sources = base + other.sources
+	b.invalidate()
+	return nil
+}
+
+// Merge returns a new buffer over the original data of a and b holding the
+// edits of both, as for combining the edits of two independent analyzers.
+// The new buffer is a clone of a (see Clone) with b's edits added, except that
+// an edit of b identical to one of a is added only once, and an edit of b that
+// conflicts with one of a is not added but reported, paired with that edit
+// (Conflict.A is a's edit). Merge returns an error if a and b have different
+// original data. Conflicts among the edits of a single buffer are not reported.
+func Merge(a, b *Buffer) (*Buffer, []Conflict, error) {
+	if !a.sameContents(b) {
+		return nil, nil, fmt.Errorf("edit: cannot merge buffers with different original data (lengths %d and %d)", a.contentsLen(), b.contentsLen())
+	}
+	c := a.Clone()
+	var conflicts []Conflict
+	base := c.sources + 1
+Edits:
+	for _, f := range b.q {
+		for _, e := range a.q {
+			if e.start == f.start && e.end == f.end && e.new == f.new && e.lazy == nil && f.lazy == nil {
+				continue Edits
+			}
+			if e.conflicts(f) {
+				conflicts = append(conflicts, Conflict{A: e.spec(), B: f.spec()})
+				continue Edits
+			}
+		}
+		f.source += base
+		c.q = append(c.q, f)
+	}
+	c.sources = base + b.sources
+	c.invalidate()
+	return c, conflicts, nil
+}
+
+// An InsertCollision describes insertions at the same position and priority
+// that were queued in different buffers and combined by Merge.
+type InsertCollision struct {
+	Pos      int // original offset of the insertions
+	Priority int // priority of the insertions; see InsertWithPriority
+	Count    int // number of insertions at Pos with Priority
+}
+
+// AmbiguousInsertPoints reports the positions at which insertions that
+// originated in different buffers combined by Merge collide, in increasing order.
+// Insertions at the same position and priority are applied in the order they were queued,
+// which after a merge reflects the order of the Merge calls rather than any
+// intent of the passes that produced them, so callers may wish to order them explicitly.
+// Insertions already ordered by differing priorities are not ambiguous.
+func (b *Buffer) AmbiguousInsertPoints() []InsertCollision {
+	type key struct {
+		pos, priority int
+	}
+	type point struct {
+		count   int
+		sources map[int]bool
+	}
+	points := make(map[key]*point)
+	for _, e := range b.q {
+		if e.start != e.end || e.new == "" {
+			continue
+		}
+		k := key{e.start, e.priority}
+		p := points[k]
+		if p == nil {
+			p = &point{sources: make(map[int]bool)}
+			points[k] = p
+		}
+		p.sources[e.source] = true
+		p.count++
+	}
+	var collisions []InsertCollision
+	for k, p := range points {
+		if len(p.sources) > 1 {
+			collisions = append(collisions, InsertCollision{Pos: k.pos, Priority: k.priority, Count: p.count})
+		}
+	}
+	sort.Slice(collisions, func(i, j int) bool {
+		if collisions[i].Pos != collisions[j].Pos {
+			return collisions[i].Pos < collisions[j].Pos
+		}
+		return collisions[i].Priority < collisions[j].Priority
+	})
+	return collisions
+}
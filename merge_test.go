@@ -0,0 +1,130 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package edit
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMerge(t *testing.T) {
+	const in = "0123456789"
+	addA := func(b *Buffer) {
+		b.Replace(1, 2, "one")
+		b.Insert(5, "a")
+	}
+	addB := func(b *Buffer) {
+		b.Insert(5, "b")
+		b.Delete(7, 9)
+	}
+	a, b := NewBufferString(in), NewBuffer([]byte(in))
+	addA(a)
+	addB(b)
+	a.Merge(b)
+	all := NewBufferString(in)
+	addA(all)
+	addB(all)
+	if got, want := a.String(), all.String(); got != want {
+		t.Errorf("merged String() = %q, want %q", got, want)
+	}
+	if got := b.String(); got != "01234b569" {
+		t.Errorf("Merge changed the merged buffer: String() = %q", got)
+	}
+
+	// Conflicts between merged edits are reported when the edits are applied.
+	c := NewBufferString(in)
+	c.Replace(6, 8, "x")
+	a.Merge(c)
+	if _, err := a.Apply(); err == nil {
+		t.Errorf("Apply() succeeded with conflicting merged edits")
+	}
+
+	if err := a.TryMerge(NewBufferString("0123")); err == nil {
+		t.Errorf("TryMerge of buffers with different data succeeded")
+	}
+}
+
+func TestMergeThreeWay(t *testing.T) {
+	a := NewBufferString("0123456789")
+	a.Replace(1, 2, "one")
+	a.Insert(5, "!")
+	a.Replace(7, 9, "78")
+	b := NewBufferString("0123456789")
+	b.Insert(5, "!")      // identical to a's
+	b.Replace(8, 10, "x") // conflicts with a's
+	b.Delete(3, 4)
+	m, conflicts, err := Merge(a, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := m.String(), "0one24!56789"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+	want := []Conflict{{A: Edit{7, 9, "78"}, B: Edit{8, 10, "x"}}}
+	if !reflect.DeepEqual(conflicts, want) {
+		t.Errorf("conflicts = %v, want %v", conflicts, want)
+	}
+	if got, want := a.String(), "0one234!56789"; got != want {
+		t.Errorf("a.String() = %q, want %q (unchanged)", got, want)
+	}
+	if _, _, err := Merge(a, NewBufferString("x")); err == nil {
+		t.Errorf("Merge of buffers with different data succeeded")
+	}
+}
+
+func TestAmbiguousInsertPoints(t *testing.T) {
+	const in = "0123456789"
+	b := NewBufferString(in)
+	b.Insert(2, "a")
+	b.Insert(2, "b") // same source: not ambiguous
+	b.Insert(5, "c")
+
+	other := NewBufferString(in)
+	other.Insert(5, "d")
+	other.Insert(5, "e")
+	other.Insert(8, "f")
+	b.Merge(other)
+
+	third := NewBufferString(in)
+	third.Insert(8, "g")
+	b.Merge(third)
+
+	want := []InsertCollision{{Pos: 5, Count: 3}, {Pos: 8, Count: 2}}
+	if got := b.AmbiguousInsertPoints(); !reflect.DeepEqual(got, want) {
+		t.Errorf("AmbiguousInsertPoints() = %v, want %v", got, want)
+	}
+	if got, want := b.String(), "01ab234cde567fg89"; got != want {
+		t.Errorf("b.String() = %q, want %q", got, want)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Merge of buffers with different data did not panic")
+		}
+	}()
+	b.Merge(NewBufferString("x"))
+}
+
+func TestAmbiguousInsertPointsSources(t *testing.T) {
+	const in = "0123456789"
+	b := NewBufferString(in)
+	b.Insert(3, "a")
+
+	other := NewBufferString(in)
+	other.Insert(3, "b")
+	other.Insert(3, "c") // same source as b: still two sources
+	other.InsertBefore(6, "d")
+	other.InsertAfter(6, "e")
+	b.Merge(other)
+
+	third := NewBufferString(in)
+	third.InsertAfter(6, "f") // collides only with e
+	b.Merge(third)
+
+	want := []InsertCollision{{Pos: 3, Count: 3}, {Pos: 6, Priority: 1, Count: 2}}
+	if got := b.AmbiguousInsertPoints(); !reflect.DeepEqual(got, want) {
+		t.Errorf("AmbiguousInsertPoints() = %v, want %v", got, want)
+	}
+}
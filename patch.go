@@ -0,0 +1,267 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package edit
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// MergePatch decodes the edits in patch, a JSON array of Edit objects,
+// and queues each one that does not conflict with an edit already queued in b,
+// including the edits from patch queued before it.
+// It returns the conflicting edits from patch, which are not queued,
+// each paired with the queued edit it conflicts with (Conflict.A is the queued edit).
+// Edits are queued as by Replace. If patch is malformed or contains an edit
+// outside the original data, or one that splits a UTF-8 sequence while
+// UTF-8 checking is on, MergePatch returns an error and queues nothing.
+func (b *Buffer) MergePatch(patch []byte) (conflicts []Conflict, err error) {
+	var specs []Edit
+	if err := json.Unmarshal(patch, &specs); err != nil {
+		return nil, fmt.Errorf("edit: malformed patch: %v", err)
+	}
+	n := b.contentsLen()
+	for _, s := range specs {
+		if s.End < s.Start || s.Start < 0 || s.End > n {
+			return nil, fmt.Errorf("edit: patch edit [%d,%d) outside data of length %d", s.Start, s.End, n)
+		}
+		if err := b.checkRange(s.Start, s.End); err != nil {
+			return nil, err // splits a UTF-8 sequence
+		}
+	}
+	for _, s := range specs {
+		r := edit{start: s.Start, end: s.End, new: s.New}
+		ok := true
+		for _, e := range b.q {
+			if e.conflicts(r) {
+				conflicts = append(conflicts, Conflict{A: e.spec(), B: s})
+				ok = false
+				break
+			}
+		}
+		if ok {
+			b.Replace(s.Start, s.End, s.New)
+		}
+	}
+	return conflicts, nil
+}
+
+// RebaseOnto returns a new buffer over formatted, a reformatted version of
+// b's original data, holding b's queued edits translated by mapped.
+// Mapped reports the offset in formatted corresponding to an offset in b's original data,
+// or false if the offset has no counterpart there.
+// RebaseOnto returns an error if an edit's start or end has no counterpart,
+// or if the translated edit would be inverted or outside formatted.
+// The edits are queued in the new buffer in the same order as in b.
+func (b *Buffer) RebaseOnto(formatted []byte, mapped func(rawOffset int) (int, bool)) (*Buffer, error) {
+	nb := NewBuffer(formatted)
+	nb.q = make(edits, 0, len(b.q))
+	for _, e := range b.q {
+		start, ok1 := mapped(e.start)
+		end, ok2 := mapped(e.end)
+		if !ok1 || !ok2 {
+			return nil, fmt.Errorf("edit: cannot rebase edit [%d,%d): no counterpart in formatted data", e.start, e.end)
+		}
+		if end < start || start < 0 || end > len(formatted) {
+			return nil, fmt.Errorf("edit: cannot rebase edit [%d,%d): maps to invalid range [%d,%d)", e.start, e.end, start, end)
+		}
+		e.start, e.end = start, end
+		nb.q = append(nb.q, e)
+	}
+	return nb, nil
+}
+
+// Rebase returns a new buffer over the edited data of applied, holding b's
+// queued edits translated through applied's edits, as when an edit script
+// computed against the original data must still apply after an earlier
+// rewrite, such as formatting, has been committed. b and applied must have
+// the same original data. An edit of b next to text inserted or replaced by
+// applied leaves that text alone: an insertion at the same position as one of
+// applied's goes after it. Rebase returns an error if the original data
+// differ, if applied's edits overlap, or if an edit of b changes or falls
+// inside text that applied replaces or deletes,
+// or replaces text around one of applied's insertions.
+// The edits are queued in the new buffer in the same order as in b.
+func (b *Buffer) Rebase(applied *Buffer) (*Buffer, error) {
+	if !b.sameContents(applied) {
+		return nil, fmt.Errorf("edit: cannot rebase onto buffer with different original data (lengths %d and %d)", b.contentsLen(), applied.contentsLen())
+	}
+	out, err := applied.Apply()
+	if err != nil {
+		return nil, err
+	}
+	var done []Edit
+	applied.walk(nopSpan, func(start, end int, new string) error {
+		if start < end || new != "" {
+			done = append(done, Edit{start, end, new})
+		}
+		return nil
+	})
+	nb := NewBuffer(out)
+	nb.q = make(edits, 0, len(b.q))
+	for _, e := range b.q {
+		for _, d := range done {
+			// This also catches an insertion of either buffer strictly inside an edit of the other.
+			if e.start < d.End && d.Start < e.end {
+				return nil, fmt.Errorf("edit: cannot rebase edit [%d,%d): overlaps applied edit [%d,%d)", e.start, e.end, d.Start, d.End)
+			}
+		}
+		start := applied.offset(e.start, GravityRight)
+		end := start
+		if e.end > e.start {
+			end = applied.offset(e.end, GravityLeft)
+		}
+		e.start, e.end = start, end
+		nb.q = append(nb.q, e)
+	}
+	return nb, nil
+}
+
+// A Script is a serializable edit script: a list of edits together with the
+// length and SHA-256 checksum of the original data they apply to, so that
+// edits computed in one process can be checked and applied in another.
+// A Script encodes as a JSON object such as
+//
+//	{"len": 10, "sha256": "84d8...", "edits": [{"start": 1, "end": 2, "new": "x"}]}
+type Script struct {
+	Len    int    `json:"len"`
+	SHA256 string `json:"sha256"` // hex-encoded
+	Edits  []Edit `json:"edits"`
+}
+
+// Script returns the queued edits of b, in the order they are applied,
+// as a Script for b's original data. For a Buffer over an io.ReaderAt,
+// it returns an error if the original data cannot be read to compute its checksum.
+func (b *Buffer) Script() (Script, error) {
+	h := sha256.New()
+	if _, err := b.writeSpan(h, 0, b.contentsLen()); err != nil {
+		return Script{}, err
+	}
+	return Script{
+		Len:    b.contentsLen(),
+		SHA256: hex.EncodeToString(h.Sum(nil)),
+		Edits:  b.Edits(),
+	}, nil
+}
+
+// AddScript queues the edits of s, in order, as if by Add.
+// It returns an error and queues nothing if s was made for data of
+// a different length or checksum than b's original data,
+// or if any of its edits is outside the original data.
+func (b *Buffer) AddScript(s Script) error {
+	if n := b.contentsLen(); s.Len != n {
+		return fmt.Errorf("edit: script is for data of length %d, not %d", s.Len, n)
+	}
+	d, err := hex.DecodeString(s.SHA256)
+	if err != nil || len(d) != sha256.Size {
+		return fmt.Errorf("edit: malformed script checksum %q", s.SHA256)
+	}
+	var sum [sha256.Size]byte
+	copy(sum[:], d)
+	if err := b.AssertBaseHash(sum); err != nil {
+		return err
+	}
+	for _, e := range s.Edits {
+		if err := b.checkRange(e.Start, e.End); err != nil {
+			return err
+		}
+	}
+	b.Add(s.Edits...)
+	return nil
+}
+
+// Binary patch opcodes. Each is followed by a uvarint length n.
+const (
+	opCopy   = 'c' // copy the next n bytes of the original data
+	opSkip   = 's' // skip the next n bytes of the original data
+	opInsert = 'i' // insert the n bytes that follow
+)
+
+// BinaryPatch returns a compact binary encoding of the queued edits,
+// for use with ApplyBinaryPatch. Unlike the JSON encodings, it represents
+// arbitrary replacement bytes efficiently, and it does not include the
+// unchanged data. The patch begins with the length of the original data,
+// as a uvarint, followed by a sequence of copy, skip, and insert operations
+// that together consume the original data exactly.
+// Overlapping edits cause a panic, as with Bytes.
+func (b *Buffer) BinaryPatch() []byte {
+	patch := appendUvarint(nil, uint64(b.contentsLen()))
+	b.walk(func(start, end int) error {
+		patch = append(patch, opCopy)
+		patch = appendUvarint(patch, uint64(end-start))
+		return nil
+	}, func(start, end int, new string) error {
+		if start < end {
+			patch = append(patch, opSkip)
+			patch = appendUvarint(patch, uint64(end-start))
+		}
+		if new != "" {
+			patch = append(patch, opInsert)
+			patch = appendUvarint(patch, uint64(len(new)))
+			patch = append(patch, new...)
+		}
+		return nil
+	})
+	return patch
+}
+
+// ApplyBinaryPatch returns a new byte slice holding old with the edits
+// encoded in patch, as returned by BinaryPatch, applied.
+// It returns an error if patch is malformed or was made for data
+// of a different length than old.
+func ApplyBinaryPatch(old, patch []byte) ([]byte, error) {
+	errMalformed := errors.New("edit: malformed binary patch")
+	n, k := binary.Uvarint(patch)
+	if k <= 0 {
+		return nil, errMalformed
+	}
+	if n != uint64(len(old)) {
+		return nil, fmt.Errorf("edit: binary patch is for data of length %d, not %d", n, len(old))
+	}
+	patch = patch[k:]
+	var out []byte
+	off := 0
+	for len(patch) > 0 {
+		op := patch[0]
+		n, k := binary.Uvarint(patch[1:])
+		if k <= 0 {
+			return nil, errMalformed
+		}
+		patch = patch[1+k:]
+		switch op {
+		case opCopy, opSkip:
+			if n > uint64(len(old)-off) {
+				return nil, errMalformed
+			}
+			if op == opCopy {
+				out = append(out, old[off:off+int(n)]...)
+			}
+			off += int(n)
+		case opInsert:
+			if n > uint64(len(patch)) {
+				return nil, errMalformed
+			}
+			out = append(out, patch[:n]...)
+			patch = patch[n:]
+		default:
+			return nil, errMalformed
+		}
+	}
+	if off != len(old) {
+		return nil, errMalformed
+	}
+	return out, nil
+}
+
+// appendUvarint appends the uvarint encoding of v to b.
+func appendUvarint(b []byte, v uint64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(buf[:], v)
+	return append(b, buf[:n]...)
+}
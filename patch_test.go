@@ -0,0 +1,222 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package edit
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMergePatch(t *testing.T) {
+	b := NewBufferString("0123456789")
+	b.Replace(2, 5, "abc")
+	b.Delete(7, 8)
+	patch := []byte(`[
+		{"start": 0, "end": 1, "new": "zero"},
+		{"start": 3, "end": 3, "new": "x"},
+		{"start": 2, "end": 2, "new": "<"},
+		{"start": 6, "end": 9, "new": ""},
+		{"start": 9, "end": 9, "new": "!"}
+	]`)
+	conflicts, err := b.MergePatch(patch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Conflict{
+		{A: Edit{2, 5, "abc"}, B: Edit{3, 3, "x"}},
+	}
+	if !reflect.DeepEqual(conflicts, want) {
+		t.Errorf("MergePatch conflicts = %v, want %v", conflicts, want)
+	}
+	if got, want := b.String(), "zero1<abc5!9"; got != want {
+		t.Errorf("after MergePatch, b.String() = %q, want %q", got, want)
+	}
+
+	// Overlapping edits within the patch conflict with each other.
+	b = NewBufferString("0123456789")
+	conflicts, err = b.MergePatch([]byte(`[{"start": 1, "end": 3, "new": "X"}, {"start": 2, "end": 4, "new": "Y"}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = []Conflict{{A: Edit{1, 3, "X"}, B: Edit{2, 4, "Y"}}}
+	if !reflect.DeepEqual(conflicts, want) {
+		t.Errorf("MergePatch of overlapping patch edits: conflicts = %v, want %v", conflicts, want)
+	}
+	if got, err := b.Apply(); err != nil || string(got) != "0X3456789" {
+		t.Errorf("after MergePatch of overlapping patch edits, Apply() = %q, %v; want %q, nil", got, err, "0X3456789")
+	}
+
+	for _, bad := range []string{`{`, `[{"start": 5, "end": 11}]`, `[{"start": 5, "end": 4}]`} {
+		n := len(b.q)
+		if _, err := b.MergePatch([]byte(bad)); err == nil {
+			t.Errorf("MergePatch(%s) succeeded", bad)
+		}
+		if len(b.q) != n {
+			t.Errorf("MergePatch(%s) queued edits", bad)
+		}
+	}
+}
+
+func TestMergePatchSettings(t *testing.T) {
+	b := NewBufferString("a\r\nb\r\n")
+	b.MatchLineEndings(true)
+	if _, err := b.MergePatch([]byte(`[{"start": 3, "end": 4, "new": "x\ny"}]`)); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := b.String(), "a\r\nx\r\ny\r\n"; got != want {
+		t.Errorf("MergePatch with MatchLineEndings: String() = %q, want %q", got, want)
+	}
+
+	b = NewBufferUTF8([]byte("héllo"))
+	if _, err := b.MergePatch([]byte(`[{"start": 2, "end": 3, "new": "x"}]`)); err == nil {
+		t.Errorf("MergePatch splitting a UTF-8 sequence succeeded")
+	}
+	if len(b.q) != 0 {
+		t.Errorf("MergePatch splitting a UTF-8 sequence queued edits")
+	}
+}
+
+func TestRebaseOnto(t *testing.T) {
+	// The formatted version collapses the double space after "a".
+	raw := "a  b c"
+	formatted := []byte("a b c")
+	mapped := func(raw int) (int, bool) {
+		switch {
+		case raw <= 1:
+			return raw, true
+		case raw == 2:
+			return 0, false
+		default:
+			return raw - 1, true
+		}
+	}
+	b := NewBufferString(raw)
+	b.Replace(3, 4, "B")
+	b.Insert(6, "!")
+	nb, err := b.RebaseOnto(formatted, mapped)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := nb.String(), "a B c!"; got != want {
+		t.Errorf("rebased String() = %q, want %q", got, want)
+	}
+
+	b.Insert(2, "x")
+	if _, err := b.RebaseOnto(formatted, mapped); err == nil {
+		t.Errorf("RebaseOnto succeeded with an edit in a region with no counterpart")
+	}
+}
+
+func TestRebase(t *testing.T) {
+	const in = "func f( x int ){return x}"
+	fmtr := NewBufferString(in)
+	fmtr.Delete(7, 8)
+	fmtr.Delete(13, 14)
+	fmtr.Insert(15, " ")
+	fmtr.Replace(15, 16, "{\n\t")
+	fmtr.Insert(24, "\n")
+	fix := NewBufferString(in)
+	fix.Replace(8, 9, "y")
+	fix.Replace(23, 24, "y")
+	fix.Insert(24, " // fixed")
+	fix.Insert(0, "// f\n")
+	nb, err := fix.Rebase(fmtr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := nb.String(), "// f\nfunc f(y int) {\n\treturn y\n // fixed}"; got != want {
+		t.Errorf("rebased String() = %q, want %q", got, want)
+	}
+
+	fix.Delete(12, 14)
+	if _, err := fix.Rebase(fmtr); err == nil {
+		t.Errorf("Rebase succeeded with an edit overlapping an applied edit")
+	}
+	if _, err := fix.Rebase(NewBufferString("x")); err == nil {
+		t.Errorf("Rebase succeeded with different original data")
+	}
+}
+
+func TestScript(t *testing.T) {
+	b := NewBufferString("0123456789")
+	b.Replace(1, 2, "one")
+	b.Insert(5, "!")
+	b.Delete(8, 9)
+	script, err := b.Script()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(script)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var s Script
+	if err := json.Unmarshal(data, &s); err != nil {
+		t.Fatal(err)
+	}
+	nb := NewBufferString("0123456789")
+	if err := nb.AddScript(s); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := nb.String(), b.String(); got != want {
+		t.Errorf("script %s produced %q, want %q", data, got, want)
+	}
+
+	for _, other := range []string{"012345678", "0123456788"} {
+		ob := NewBufferString(other)
+		if err := ob.AddScript(s); err == nil {
+			t.Errorf("AddScript succeeded on %q", other)
+		}
+	}
+	bad := s
+	bad.Edits = append([]Edit{{0, 1, "ok"}}, Edit{9, 11, "x"})
+	nb = NewBufferString("0123456789")
+	if err := nb.AddScript(bad); err == nil || nb.Len() != 0 {
+		t.Errorf("AddScript with invalid edit = %v and queued %d edits, want error and none", err, nb.Len())
+	}
+
+	ra := &countingReaderAt{r: strings.NewReader("0123456789"), fail: 5}
+	if _, err := NewBufferFromReaderAt(ra, 10).Script(); err == nil {
+		t.Errorf("Script succeeded with a failing reader")
+	}
+}
+
+func TestBinaryPatch(t *testing.T) {
+	old := []byte("\x00\x01\x02\x03\x04\x05\x06\x07\x08\x09")
+	b := NewBuffer(old)
+	b.Replace(1, 3, "\xff\xfe\x00")
+	b.Delete(5, 6)
+	b.Insert(10, "\x80")
+	patch := b.BinaryPatch()
+	got, err := ApplyBinaryPatch(old, patch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := b.Bytes(); !bytes.Equal(got, want) {
+		t.Errorf("ApplyBinaryPatch = %q, want %q", got, want)
+	}
+	if got, err := ApplyBinaryPatch(old, NewBuffer(old).BinaryPatch()); err != nil || !bytes.Equal(got, old) {
+		t.Errorf("ApplyBinaryPatch of empty patch = %q, %v; want %q, nil", got, err, old)
+	}
+
+	if _, err := ApplyBinaryPatch(old[:9], patch); err == nil {
+		t.Errorf("ApplyBinaryPatch to data of the wrong length succeeded")
+	}
+	for _, bad := range [][]byte{
+		nil,
+		patch[:len(patch)-1], // truncated insertion
+		append(patch[:len(patch):len(patch)], 'x', 1), // unknown opcode
+		{10, 'c', 5},  // does not consume all of old
+		{10, 'c', 11}, // past the end of old
+	} {
+		if _, err := ApplyBinaryPatch(old, bad); err == nil {
+			t.Errorf("ApplyBinaryPatch(%q) succeeded, want error", bad)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package edit
+
+import (
+	"fmt"
+	"strings"
+)
+
+// An Op is a set of kinds of edit operation.
+type Op uint8
+
+const (
+	OpInsert  Op = 1 << iota // edits with an empty range
+	OpDelete                 // edits with a non-empty range and no replacement text
+	OpReplace                // edits with a non-empty range and replacement text
+)
+
+func (op Op) String() string {
+	var names []string
+	for _, x := range []struct {
+		op   Op
+		name string
+	}{{OpInsert, "insert"}, {OpDelete, "delete"}, {OpReplace, "replace"}} {
+		if op&x.op != 0 {
+			names = append(names, x.name)
+		}
+	}
+	if len(names) == 0 {
+		return "none"
+	}
+	return strings.Join(names, "|")
+}
+
+// op returns the kind of operation e performs.
+func (e edit) op() Op {
+	switch {
+	case e.start == e.end:
+		return OpInsert
+	case e.new == "":
+		return OpDelete
+	}
+	return OpReplace
+}
+
+// A Policy restricts the edits that may be queued in a buffer.
+// The zero Policy allows everything.
+type Policy struct {
+	// Allowed is the set of allowed operations. Zero allows all operations.
+	Allowed Op
+
+	// MaxRemove is the largest number of original bytes a single delete or
+	// replace may remove. Zero means no limit.
+	MaxRemove int
+
+	// Forbidden lists ranges [start, end) of the original data that no edit
+	// may delete, replace, or insert into. Insertions at either end of a
+	// forbidden range are allowed, since they leave it intact.
+	Forbidden [][2]int
+}
+
+// EnforcePolicy checks the queued edits against p, in the order they were queued,
+// and returns an error describing the first edit that violates it, or nil if none do.
+func (b *Buffer) EnforcePolicy(p Policy) error {
+	for _, e := range b.q {
+		if err := p.check(e); err != nil {
+			return fmt.Errorf("edit: [%d,%d)->%q violates policy: %v", e.start, e.end, e.new, err)
+		}
+	}
+	return nil
+}
+
+// check returns an error describing the rule of p that e violates, if any.
+func (p Policy) check(e edit) error {
+	if p.Allowed != 0 && p.Allowed&e.op() == 0 {
+		return fmt.Errorf("%v not allowed (allowed: %v)", e.op(), p.Allowed)
+	}
+	if p.MaxRemove > 0 && e.end-e.start > p.MaxRemove {
+		return fmt.Errorf("removes %d bytes, more than the limit of %d", e.end-e.start, p.MaxRemove)
+	}
+	for _, r := range p.Forbidden {
+		var hit bool
+		if e.start == e.end {
+			hit = r[0] < e.start && e.start < r[1]
+		} else {
+			hit = e.start < r[1] && e.end > r[0]
+		}
+		if hit {
+			return fmt.Errorf("touches forbidden range [%d,%d)", r[0], r[1])
+		}
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package edit
+
+import "testing"
+
+func TestEnforcePolicy(t *testing.T) {
+	tests := []struct {
+		name string
+		p    Policy
+		run  func(b *Buffer)
+		want string
+	}{
+		{"zero policy", Policy{}, func(b *Buffer) {
+			b.Insert(1, "x")
+			b.Delete(2, 9)
+			b.Replace(9, 10, "y")
+		}, ""},
+		{"inserts only", Policy{Allowed: OpInsert}, func(b *Buffer) {
+			b.Insert(1, "x")
+			b.Delete(2, 3)
+		}, `edit: [2,3)->"" violates policy: delete not allowed (allowed: insert)`},
+		{"max remove", Policy{MaxRemove: 2}, func(b *Buffer) {
+			b.Replace(0, 2, "ab")
+			b.Replace(5, 8, "x")
+		}, `edit: [5,8)->"x" violates policy: removes 3 bytes, more than the limit of 2`},
+		{"forbidden boundary", Policy{Forbidden: [][2]int{{3, 6}}}, func(b *Buffer) {
+			b.Insert(3, "x")
+			b.Insert(6, "y")
+			b.Delete(1, 3)
+		}, ""},
+		{"forbidden", Policy{Forbidden: [][2]int{{3, 6}}}, func(b *Buffer) {
+			b.Insert(4, "x")
+		}, `edit: [4,4)->"x" violates policy: touches forbidden range [3,6)`},
+	}
+	for _, tt := range tests {
+		b := NewBufferString("0123456789")
+		tt.run(b)
+		err := b.EnforcePolicy(tt.p)
+		var got string
+		if err != nil {
+			got = err.Error()
+		}
+		if got != tt.want {
+			t.Errorf("%s: EnforcePolicy() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,649 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package edit
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// An Edit describes an edit: replace the original data in [Start, End) with New.
+// An insertion has Start == End; a deletion has New == "".
+type Edit struct {
+	Start int    `json:"start"`
+	End   int    `json:"end"`
+	New   string `json:"new"`
+}
+
+// A Conflict describes two edits that overlap, so that they cannot both be applied.
+type Conflict struct {
+	A, B Edit
+}
+
+func (c Conflict) String() string {
+	return fmt.Sprintf("[%d,%d)->%q conflicts with [%d,%d)->%q", c.A.Start, c.A.End, c.A.New, c.B.Start, c.B.End, c.B.New)
+}
+
+// Conflicts returns every pair of queued edits that overlap in a way that
+// cannot be merged, so that Bytes would panic, ordered by the order in which
+// the edits are applied. Validate reports only the first such pair.
+// Soft edits that would be dropped are not reported, nor are duplicates
+// ignored by DedupeEdits. Conflicts reports conflicts regardless of the
+// policy set by OnConflict.
+func (b *Buffer) Conflicts() []Conflict {
+	q := b.sorted()
+	if b.dedupe {
+		q = dedupe(q)
+	}
+	q, _ = resolveSoft(q)
+	var cs []Conflict
+	for i, e := range q {
+		for _, f := range q[i+1:] {
+			if f.start >= e.end {
+				break
+			}
+			if e.conflicts(f) {
+				cs = append(cs, Conflict{A: e.spec(), B: f.spec()})
+			}
+		}
+	}
+	return cs
+}
+
+// spec returns e as an Edit.
+func (e edit) spec() Edit {
+	return Edit{Start: e.start, End: e.end, New: e.new}
+}
+
+// conflicts reports whether e and f overlap such that they cannot both be applied,
+// using the same rules as WriteTo: overlapping deletions can be merged,
+// and insertions at the boundary of another edit are not overlaps.
+func (e edit) conflicts(f edit) bool {
+	if e.new == "" && f.new == "" {
+		return false
+	}
+	if edits([]edit{e, f}).Less(1, 0) {
+		e, f = f, e
+	}
+	return f.start < e.end
+}
+
+// touches reports whether e touches the original range [start, end).
+// An insertion touches the range if it is at start or strictly inside it.
+// If closed is set, the range also includes end itself, so that an insertion
+// at the very end of the data can be attributed to a range.
+func (e edit) touches(start, end int, closed bool) bool {
+	if e.start == e.end {
+		return start <= e.start && (e.start < end || closed && e.start == end)
+	}
+	return e.start < end && e.end > start
+}
+
+// Edits returns a copy of the queued edits, in the order they are applied.
+// Soft edits are included, even those that will be dropped (see DroppedSoftEdits).
+func (b *Buffer) Edits() []Edit {
+	q := b.sorted()
+	specs := make([]Edit, len(q))
+	for i, e := range q {
+		specs[i] = e.spec()
+	}
+	return specs
+}
+
+// EditsOnLine returns the queued edits that touch the given 1-based line
+// of the original data, in the order they are applied.
+// An edit that spans several lines touches each of them.
+// The line terminator belongs to the line it ends. EditsOnLine panics if
+// the original data has no such line.
+func (b *Buffer) EditsOnLine(line int) []Edit {
+	starts := b.lineStarts()
+	if line < 1 || line > len(starts) {
+		panic("invalid line number")
+	}
+	start := starts[line-1]
+	end := b.contentsLen()
+	if line < len(starts) {
+		end = starts[line]
+	}
+	last := line == len(starts)
+	var specs []Edit
+	for _, e := range b.sorted() {
+		if e.touches(start, end, last) {
+			specs = append(specs, e.spec())
+		}
+	}
+	return specs
+}
+
+// EditsIn returns the queued edits that touch the original range [start, end),
+// in the order they are applied, as for a rewrite pass that must check whether
+// an earlier pass already changed a region. A deletion or replacement touches
+// the range if it overlaps it; an insertion touches it if it is at start or
+// strictly inside it. For an empty range, the edits that touch it are those
+// that strictly contain start and the insertions at start.
+// EditsIn panics if [start, end) is not a range of the original data.
+func (b *Buffer) EditsIn(start, end int) []Edit {
+	if end < start || start < 0 || end > b.contentsLen() {
+		panic("invalid edit position")
+	}
+	var specs []Edit
+	for _, e := range b.sorted() {
+		if e.touches(start, end, start == end) {
+			specs = append(specs, e.spec())
+		}
+	}
+	return specs
+}
+
+// Overlaps reports whether any queued edit touches the original range
+// [start, end), as defined by EditsIn.
+func (b *Buffer) Overlaps(start, end int) bool {
+	if end < start || start < 0 || end > b.contentsLen() {
+		panic("invalid edit position")
+	}
+	for _, e := range b.q {
+		if e.touches(start, end, start == end) {
+			return true
+		}
+	}
+	return false
+}
+
+// AsOverwrites returns the queued edits rewritten as a minimal set of
+// same-length replacements, one for each run of original bytes
+// that differs in the edited data, in increasing offset order.
+// Applying the returned edits to the original produces the same result as the queued edits.
+// This is possible if and only if the edits preserve the length of the data;
+// otherwise AsOverwrites returns an error.
+func (b *Buffer) AsOverwrites() ([]Edit, error) {
+	if d := b.ResultLen() - b.contentsLen(); d > 0 {
+		return nil, fmt.Errorf("edit: cannot express edits as overwrites: they grow the data by %d bytes", d)
+	} else if d < 0 {
+		return nil, fmt.Errorf("edit: cannot express edits as overwrites: they shrink the data by %d bytes", -d)
+	}
+
+	// Group consecutive edits until their net length change returns to zero.
+	// Each group then covers a same-length original and output range,
+	// which are compared byte by byte.
+	var specs []Edit
+	var out strings.Builder
+	groupStart := -1
+	delta := 0
+	b.walk(func(start, end int) error {
+		if groupStart >= 0 {
+			out.WriteString(b.text(start, end))
+		}
+		return nil
+	}, func(start, end int, new string) error {
+		if groupStart < 0 {
+			groupStart = start
+			out.Reset()
+		}
+		out.WriteString(new)
+		delta += len(new) - (end - start)
+		if delta == 0 {
+			specs = appendOverwrites(specs, groupStart, b.text(groupStart, end), out.String())
+			groupStart = -1
+		}
+		return nil
+	})
+	return specs, nil
+}
+
+// appendOverwrites appends to specs a same-length replacement for each run of
+// bytes that differs between old and new, which start at original offset off.
+func appendOverwrites(specs []Edit, off int, old, new string) []Edit {
+	for i := 0; i < len(old); {
+		if old[i] == new[i] {
+			i++
+			continue
+		}
+		j := i + 1
+		for j < len(old) && old[j] != new[j] {
+			j++
+		}
+		specs = append(specs, Edit{Start: off + i, End: off + j, New: new[i:j]})
+		i = j
+	}
+	return specs
+}
+
+// DeletedRanges returns the ranges [start, end) of original data that do not
+// appear in the edited data, because they are deleted or replaced.
+// The ranges are in increasing order; overlapping and adjacent ranges are merged.
+func (b *Buffer) DeletedRanges() [][2]int {
+	var ranges [][2]int
+	b.walk(func(start, end int) error {
+		return nil
+	}, func(start, end int, new string) error {
+		if start == end {
+			return nil
+		}
+		if n := len(ranges); n > 0 && ranges[n-1][1] == start {
+			ranges[n-1][1] = end
+		} else {
+			ranges = append(ranges, [2]int{start, end})
+		}
+		return nil
+	})
+	return ranges
+}
+
+// AuditRanges returns a description of each queued edit whose range is
+// malformed: it ends before it starts or lies outside the original data.
+// The edits are reported in the order they were queued; AuditRanges returns
+// nil if all edits are well formed.
+//
+// AuditRanges matters only inside the function passed to Batch, which defers
+// checking edit positions until it returns; there AuditRanges reports the
+// edits that Batch will reject. Otherwise every way of queueing edits,
+// including Add, NewBufferFromEdits, and AddScript, rejects malformed ones,
+// so AuditRanges reports nothing.
+func (b *Buffer) AuditRanges() []string {
+	var problems []string
+	n := b.contentsLen()
+	for i, e := range b.q {
+		var why string
+		switch {
+		case e.end < e.start:
+			why = "end before start"
+		case e.start < 0:
+			why = "start before beginning of data"
+		case e.end > n:
+			why = fmt.Sprintf("end past end of data (length %d)", n)
+		default:
+			continue
+		}
+		problems = append(problems, fmt.Sprintf("edit %d: [%d,%d)->%q%s: %s", i, e.start, e.end, e.new, labelSuffix(e.label), why))
+	}
+	return problems
+}
+
+// debugTextLimit is the number of bytes of replacement text shown per edit by Debug.
+const debugTextLimit = 40
+
+// Debug returns a description of the queued edits, one per line, in the order
+// they were queued, such as:
+//
+//	Replace[3,4) => "three,"
+//	Insert@4 => "π,"
+//	Delete[5,7)
+//	InsertSoft@9 => "hint"
+//	InsertAfter@9 => "!"
+//	ReplaceLazy[9,10)
+//
+// Replacement text longer than a few dozen bytes is truncated with an ellipsis,
+// and the label of a labeled edit follows it in parentheses.
+func (b *Buffer) Debug() string {
+	var sb strings.Builder
+	for _, e := range b.q {
+		sb.WriteString(e.debug())
+		sb.WriteString(labelSuffix(e.label))
+		sb.WriteByte('\n')
+	}
+	return sb.String()
+}
+
+// debug returns a short description of e for Debug.
+func (e edit) debug() string {
+	if e.lazy != nil {
+		return fmt.Sprintf("ReplaceLazy[%d,%d)", e.start, e.end) // its text is not yet known
+	}
+	if e.new == "" && e.start != e.end {
+		return fmt.Sprintf("Delete[%d,%d)", e.start, e.end)
+	}
+	text := e.new
+	ellipsis := ""
+	if len(text) > debugTextLimit {
+		i := debugTextLimit
+		for i > 0 && !utf8.RuneStart(text[i]) {
+			i--
+		}
+		text, ellipsis = text[:i], "..."
+	}
+	variant := ""
+	switch {
+	case e.soft:
+		variant = "Soft"
+	case e.priority == -1:
+		variant = "Before"
+	case e.priority == 1:
+		variant = "After"
+	case e.priority != 0:
+		variant = fmt.Sprintf("WithPriority(%d)", e.priority)
+	}
+	if e.start == e.end {
+		return fmt.Sprintf("Insert%s@%d => %s%s", variant, e.start, strconv.Quote(text), ellipsis)
+	}
+	return fmt.Sprintf("Replace%s[%d,%d) => %s%s", variant, e.start, e.end, strconv.Quote(text), ellipsis)
+}
+
+// Changed reports whether applying the queued edits would change the data.
+// Edits that replace text with identical text, and empty insertions,
+// are not changes. Changed does not materialize the edited data: it first
+// compares each edit's replacement text with the text it replaces,
+// and only if some edit differs but the length of the data is unchanged,
+// compares the edited data with the original piece by piece.
+func (b *Buffer) Changed() bool {
+	identity := true
+	b.walk(nopSpan, func(start, end int, new string) error {
+		if end-start != len(new) || !b.hasText(start, new) {
+			identity = false
+			return errStopWalk
+		}
+		return nil
+	})
+	if identity {
+		return false
+	}
+	if b.ResultLen() != b.contentsLen() {
+		return true
+	}
+	// The edits might still cancel out, as with deleting
+	// a byte and inserting a copy of it nearby.
+	changed := false
+	out := 0
+	b.walk(func(start, end int) error {
+		if !b.sameSpans(out, start, end) {
+			changed = true
+			return errStopWalk
+		}
+		out += end - start
+		return nil
+	}, func(start, end int, new string) error {
+		if !b.hasText(out, new) {
+			changed = true
+			return errStopWalk
+		}
+		out += len(new)
+		return nil
+	})
+	return changed
+}
+
+// sameSpans reports whether the original data in [start, end)
+// also appears at offset off.
+func (b *Buffer) sameSpans(off, start, end int) bool {
+	if b.old != nil {
+		return bytes.Equal(b.old[off:off+end-start], b.old[start:end])
+	}
+	if b.src != nil {
+		return b.text(off, off+end-start) == b.text(start, end)
+	}
+	return b.str[off:off+end-start] == b.str[start:end]
+}
+
+// keeps reports whether e leaves the original data as it is,
+// replacing it with a copy of itself, as an empty insertion does.
+func (b *Buffer) keeps(e edit) bool {
+	return e.end-e.start == len(e.new) && b.hasText(e.start, e.new)
+}
+
+// hasText reports whether the original data contains s at offset off.
+func (b *Buffer) hasText(off int, s string) bool {
+	if off+len(s) > b.contentsLen() {
+		return false
+	}
+	if b.old != nil {
+		return string(b.old[off:off+len(s)]) == s
+	}
+	if b.src != nil {
+		return b.text(off, off+len(s)) == s
+	}
+	return b.str[off:off+len(s)] == s
+}
+
+// IsTailRewrite reports whether the queued edits only rewrite a suffix of the
+// original data, and if so, the offset from at which that suffix begins:
+// the smallest original offset touched by an edit. The edited data then
+// consists of old[:from] followed by new content, so it can be produced by
+// truncating the original at from and appending output[from:].
+// It reports false if no queued edit changes anything: edits that replace
+// original data with a copy of it, as Changed considers them, are ignored.
+func (b *Buffer) IsTailRewrite() (from int, ok bool) {
+	from = b.contentsLen()
+	for _, e := range b.sorted() {
+		if b.keeps(e) {
+			continue
+		}
+		ok = true
+		if e.start < from {
+			from = e.start
+		}
+	}
+	return from, ok
+}
+
+// IsHeadRewrite reports whether the queued edits only rewrite a prefix of the
+// original data, and if so, the offset to at which that prefix ends:
+// the largest original offset touched by an edit. The edited data then
+// consists of new content followed by old[to:].
+// As with IsTailRewrite, it reports false if no queued edit changes anything.
+func (b *Buffer) IsHeadRewrite() (to int, ok bool) {
+	for _, e := range b.sorted() {
+		if b.keeps(e) {
+			continue
+		}
+		ok = true
+		if e.end > to {
+			to = e.end
+		}
+	}
+	return to, ok
+}
+
+// A PlacedEdit is an edit together with the range of the edited data
+// occupied by its replacement text.
+type PlacedEdit struct {
+	Edit
+	OutStart, OutEnd int
+}
+
+// placed returns the queued edits in the order they are applied,
+// with the positions of their replacement text in the edited data.
+// A deletion subsumed by another is placed where that deletion is.
+func (b *Buffer) placed() []PlacedEdit {
+	return b.placedQueue(b.applied())
+}
+
+// placedQueue is placed for the sorted edits q.
+func (b *Buffer) placedQueue(q edits) []PlacedEdit {
+	panicOnOverlap(b.walkQueue(q, nopSpan, nopRepl))
+	var ps []PlacedEdit
+	out, offset := 0, 0
+	for _, e := range q {
+		start := e.start
+		if start < offset {
+			start = offset
+		}
+		if e.end < start {
+			ps = append(ps, PlacedEdit{e.spec(), out, out})
+			continue
+		}
+		out += start - offset
+		ps = append(ps, PlacedEdit{e.spec(), out, out + len(e.new)})
+		out += len(e.new)
+		offset = e.end
+	}
+	return ps
+}
+
+// A Change describes an applied edit, for reporting: "replaced Old with New at ...".
+type Change struct {
+	Start, End       int    // the range of original data the edit replaces
+	OutStart, OutEnd int    // the range of the edited data holding its replacement text
+	Old, New         string // the original data in [Start, End) and its replacement text
+	Label            string // the edit's label, if any; see ReplaceLabeled
+}
+
+// Changes returns a Change for each queued edit, in the order they are applied,
+// omitting empty insertions. The output ranges are as for PlacedEdit: a deletion
+// within a range already deleted by another edit has an empty output range
+// where that deletion is. To report line numbers, see Lines.
+// Changes panics if queued edits overlap.
+func (b *Buffer) Changes() []Change {
+	q := b.applied()
+	var changes []Change
+	for i, p := range b.placedQueue(q) {
+		if p.Start == p.End && p.New == "" {
+			continue
+		}
+		changes = append(changes, Change{
+			Start:    p.Start,
+			End:      p.End,
+			OutStart: p.OutStart,
+			OutEnd:   p.OutEnd,
+			Old:      b.text(p.Start, p.End),
+			New:      p.New,
+			Label:    q[i].label,
+		})
+	}
+	return changes
+}
+
+// A QueueDelta describes how the edits queued in one buffer differ from
+// those queued in another over the same original data.
+type QueueDelta struct {
+	Added   []PlacedEdit // edits queued only in the newer buffer, placed in its output
+	Removed []PlacedEdit // edits queued only in the older buffer, placed in its output
+}
+
+// QueueDelta returns the edits queued in b but not prev, and those queued in
+// prev but not b, each in the order they are applied. Edits are compared by
+// their range and replacement text; an edit queued twice in b and once in prev
+// is added once. The output positions of added edits refer to b's edited data,
+// and those of removed edits to prev's. QueueDelta panics if b and prev have
+// different original data.
+func (b *Buffer) QueueDelta(prev *Buffer) QueueDelta {
+	if !b.sameContents(prev) {
+		panic("buffers have different original data")
+	}
+	cur, old := b.placed(), prev.placed()
+	return QueueDelta{
+		Added:   placedDiff(cur, old),
+		Removed: placedDiff(old, cur),
+	}
+}
+
+// placedDiff returns the edits in x that are not in y, counting multiplicity.
+func placedDiff(x, y []PlacedEdit) []PlacedEdit {
+	count := make(map[Edit]int)
+	for _, p := range y {
+		count[p.Edit]++
+	}
+	var diff []PlacedEdit
+	for _, p := range x {
+		if count[p.Edit] > 0 {
+			count[p.Edit]--
+			continue
+		}
+		diff = append(diff, p)
+	}
+	return diff
+}
+
+// normalized returns the queued edits in the order they are applied,
+// in a canonical form that depends only on the effect of the edits:
+// overlapping deletions are merged, empty insertions are dropped,
+// and edits with no unchanged data between them are combined into one.
+func (b *Buffer) normalized() []Edit {
+	var specs []Edit
+	b.walk(nopSpan, func(start, end int, new string) error {
+		if start == end && new == "" {
+			return nil
+		}
+		if n := len(specs); n > 0 && specs[n-1].End == start {
+			specs[n-1].End = end
+			specs[n-1].New += new
+			return nil
+		}
+		specs = append(specs, Edit{start, end, new})
+		return nil
+	})
+	return specs
+}
+
+// EditsHash returns a hash of the queued edits. It hashes the edits only,
+// not the original or edited data. The hash does not depend on
+// the order in which edits were queued, except where that order affects
+// the result (as with several insertions at the same position),
+// nor on how they were split up: for example Delete(2, 4) followed by
+// Delete(4, 6) hashes the same as Delete(2, 6).
+func (b *Buffer) EditsHash() uint64 {
+	h := fnv.New64a()
+	var buf [3 * binary.MaxVarintLen64]byte
+	for _, s := range b.normalized() {
+		n := binary.PutUvarint(buf[:], uint64(s.Start))
+		n += binary.PutUvarint(buf[n:], uint64(s.End))
+		n += binary.PutUvarint(buf[n:], uint64(len(s.New)))
+		h.Write(buf[:n])
+		h.Write([]byte(s.New))
+	}
+	return h.Sum64()
+}
+
+// NextEditFrom returns the first normalized edit (see EditsHash) that starts
+// at or after the original offset pos. An edit starting exactly at pos counts.
+// It reports false if there is no such edit.
+func (b *Buffer) NextEditFrom(pos int) (Edit, bool) {
+	specs := b.normalized()
+	i := sort.Search(len(specs), func(i int) bool { return specs[i].Start >= pos })
+	if i == len(specs) {
+		return Edit{}, false
+	}
+	return specs[i], true
+}
+
+// PrevEditFrom returns the last normalized edit (see EditsHash) that starts
+// before the original offset pos. An edit starting exactly at pos does not count.
+// It reports false if there is no such edit.
+func (b *Buffer) PrevEditFrom(pos int) (Edit, bool) {
+	specs := b.normalized()
+	i := sort.Search(len(specs), func(i int) bool { return specs[i].Start >= pos })
+	if i == 0 {
+		return Edit{}, false
+	}
+	return specs[i-1], true
+}
+
+// EditsBeyond returns the indexes, in call order, of the queued edits that
+// reach past offset length of the original data: those whose end, or
+// insertion position, is greater than length.
+func (b *Buffer) EditsBeyond(length int) []int {
+	var idx []int
+	for i, e := range b.q {
+		if e.end > length {
+			idx = append(idx, i)
+		}
+	}
+	return idx
+}
+
+// An EditorChange is an edit in the form used by web-based editors such as
+// CodeMirror and Monaco: replace the original bytes [From, To) with Insert.
+type EditorChange struct {
+	From   int    `json:"from"`
+	To     int    `json:"to"`
+	Insert string `json:"insert"`
+}
+
+// EditorChanges returns the normalized edits (see EditsHash) as editor changes.
+// From and To are byte offsets into the original data, not offsets into the
+// edited data and not character counts; the changes are in increasing order
+// and do not overlap, so they can be applied together as a single transaction.
+func (b *Buffer) EditorChanges() []EditorChange {
+	specs := b.normalized()
+	changes := make([]EditorChange, len(specs))
+	for i, s := range specs {
+		changes[i] = EditorChange{From: s.Start, To: s.End, Insert: s.New}
+	}
+	return changes
+}
@@ -0,0 +1,412 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package edit
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestEdits(t *testing.T) {
+	b := NewBufferString("0123456789")
+	b.Replace(6, 7, "six")
+	b.Insert(2, "two")
+	b.Delete(3, 5)
+	b.Insert(2, "2")
+	want := []Edit{{2, 2, "two"}, {2, 2, "2"}, {3, 5, ""}, {6, 7, "six"}}
+	edits := b.Edits()
+	if !reflect.DeepEqual(edits, want) {
+		t.Errorf("Edits() = %v, want %v", edits, want)
+	}
+	edits[0].New = "changed"
+	if got := b.Edits(); !reflect.DeepEqual(got, want) {
+		t.Errorf("after changing result, Edits() = %v, want %v", got, want)
+	}
+	if got, want := b.String(), "01two225six789"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+}
+
+func TestEditsOnLine(t *testing.T) {
+	b := NewBufferString("one\ntwo\nthree\n")
+	b.Replace(5, 6, "W")   // line 2
+	b.Insert(4, "zero\n")  // start of line 2
+	b.Delete(2, 9)         // lines 1-3
+	b.Insert(14, "four\n") // empty line 4
+	b.Insert(8, "2.5\n")   // start of line 3
+
+	tests := []struct {
+		line int
+		want []Edit
+	}{
+		{1, []Edit{{2, 9, ""}}},
+		{2, []Edit{{2, 9, ""}, {4, 4, "zero\n"}, {5, 6, "W"}}},
+		{3, []Edit{{2, 9, ""}, {8, 8, "2.5\n"}}},
+		{4, []Edit{{14, 14, "four\n"}}},
+	}
+	for _, tt := range tests {
+		if got := b.EditsOnLine(tt.line); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("EditsOnLine(%d) = %v, want %v", tt.line, got, tt.want)
+		}
+	}
+
+	for _, line := range []int{0, 5} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("EditsOnLine(%d) did not panic", line)
+				}
+			}()
+			b.EditsOnLine(line)
+		}()
+	}
+}
+
+func TestEditsIn(t *testing.T) {
+	b := NewBufferString("0123456789")
+	b.Replace(2, 4, "x")
+	b.Insert(6, "y")
+	b.Delete(8, 9)
+	tests := []struct {
+		start, end int
+		want       []Edit
+	}{
+		{0, 2, nil},
+		{0, 3, []Edit{{2, 4, "x"}}},
+		{3, 3, []Edit{{2, 4, "x"}}},
+		{4, 6, nil},
+		{4, 7, []Edit{{6, 6, "y"}}},
+		{6, 6, []Edit{{6, 6, "y"}}},
+		{5, 10, []Edit{{6, 6, "y"}, {8, 9, ""}}},
+		{9, 10, nil},
+	}
+	for _, tt := range tests {
+		if got := b.EditsIn(tt.start, tt.end); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("EditsIn(%d, %d) = %v, want %v", tt.start, tt.end, got, tt.want)
+		}
+		if got, want := b.Overlaps(tt.start, tt.end), tt.want != nil; got != want {
+			t.Errorf("Overlaps(%d, %d) = %v, want %v", tt.start, tt.end, got, want)
+		}
+	}
+}
+
+func TestAsOverwrites(t *testing.T) {
+	b := NewBufferString("0123456789")
+	b.Insert(1, "ab")
+	b.Delete(3, 5)
+	b.Replace(6, 7, "6")
+	b.Replace(8, 9, "X")
+	specs, err := b.AsOverwrites()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Edit{{1, 5, "ab12"}, {8, 9, "X"}}
+	if !reflect.DeepEqual(specs, want) {
+		t.Errorf("AsOverwrites() = %v, want %v", specs, want)
+	}
+	o := NewBufferString("0123456789")
+	for _, s := range specs {
+		o.Replace(s.Start, s.End, s.New)
+	}
+	if got, want := o.String(), b.String(); got != want {
+		t.Errorf("overwrites produce %q, want %q", got, want)
+	}
+
+	b.Insert(0, "!")
+	if _, err := b.AsOverwrites(); err == nil {
+		t.Errorf("AsOverwrites() succeeded for edits that grow the data")
+	}
+}
+
+func TestDeletedRanges(t *testing.T) {
+	b := NewBufferString("0123456789")
+	b.Delete(2, 4)
+	b.Delete(3, 5)
+	b.Replace(5, 6, "five")
+	b.Insert(7, "x")
+	b.Replace(8, 9, "")
+	want := [][2]int{{2, 6}, {8, 9}}
+	if got := b.DeletedRanges(); !reflect.DeepEqual(got, want) {
+		t.Errorf("DeletedRanges() = %v, want %v", got, want)
+	}
+}
+
+func TestAuditRanges(t *testing.T) {
+	b := NewBufferString("0123456789")
+	b.Replace(1, 2, "x")
+	if got := b.AuditRanges(); got != nil {
+		t.Errorf("AuditRanges() = %q for valid edits", got)
+	}
+	b.q = append(b.q, edit{start: 5, end: 3, new: "y"}, edit{start: -1, end: 2}, edit{start: 8, end: 11, new: "z"})
+	want := []string{
+		`edit 1: [5,3)->"y": end before start`,
+		`edit 2: [-1,2)->"": start before beginning of data`,
+		`edit 3: [8,11)->"z": end past end of data (length 10)`,
+	}
+	if got := b.AuditRanges(); !reflect.DeepEqual(got, want) {
+		t.Errorf("AuditRanges() = %q, want %q", got, want)
+	}
+
+	// Inside Batch, edit positions are not yet checked.
+	b = NewBufferString("0123456789")
+	var got []string
+	err := b.Batch(func(b *Buffer) {
+		b.Replace(1, 2, "x")
+		b.Replace(6, 4, "y")
+		got = b.AuditRanges()
+	})
+	if want := []string{`edit 1: [6,4)->"y": end before start`}; err == nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("AuditRanges() in Batch = %q (Batch error %v), want %q and an error", got, err, want)
+	}
+}
+
+func TestDebug(t *testing.T) {
+	b := NewBufferString("0123456789")
+	b.Replace(3, 4, "three,")
+	b.Insert(4, "π,")
+	b.Delete(5, 7)
+	b.Insert(9, strings.Repeat("π", 30))
+	b.InsertWithPriority(10, "!", 2)
+	b.ReplaceLazy(9, 10, bytes.ToUpper)
+	want := `Replace[3,4) => "three,"
+Insert@4 => "π,"
+Delete[5,7)
+Insert@9 => "` + strings.Repeat("π", 20) + `"...
+InsertWithPriority(2)@10 => "!"
+ReplaceLazy[9,10)
+`
+	if got := b.Debug(); got != want {
+		t.Errorf("Debug() = \n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestIsTailHeadRewrite(t *testing.T) {
+	const in = "0123456789"
+	b := NewBufferString(in)
+	if _, ok := b.IsTailRewrite(); ok {
+		t.Errorf("IsTailRewrite() ok for unedited buffer")
+	}
+	if _, ok := b.IsHeadRewrite(); ok {
+		t.Errorf("IsHeadRewrite() ok for unedited buffer")
+	}
+	b.Replace(1, 2, "1") // changes nothing
+	b.ReplaceLazy(2, 3, func(old []byte) []byte { return old })
+	if _, ok := b.IsTailRewrite(); ok {
+		t.Errorf("IsTailRewrite() ok for edits that change nothing")
+	}
+	if _, ok := b.IsHeadRewrite(); ok {
+		t.Errorf("IsHeadRewrite() ok for edits that change nothing")
+	}
+	b.Insert(8, "x")
+	b.Replace(6, 7, "six")
+	b.Insert(3, "")
+	from, ok := b.IsTailRewrite()
+	if !ok || from != 6 {
+		t.Errorf("IsTailRewrite() = %d, %v; want 6, true", from, ok)
+	}
+	if out := b.String(); out[:from] != in[:from] {
+		t.Errorf("output prefix %q differs from original %q", out[:from], in[:from])
+	}
+	to, ok := b.IsHeadRewrite()
+	if !ok || to != 8 {
+		t.Errorf("IsHeadRewrite() = %d, %v; want 8, true", to, ok)
+	}
+	if out := b.String(); !strings.HasSuffix(out, in[to:]) {
+		t.Errorf("output %q does not end with original suffix %q", out, in[to:])
+	}
+}
+
+func TestQueueDelta(t *testing.T) {
+	prev := NewBufferString("0123456789")
+	prev.Insert(2, "ab")
+	prev.Replace(5, 6, "five")
+	prev.Delete(8, 9)
+
+	b := NewBuffer([]byte("0123456789"))
+	b.Insert(2, "ab")
+	b.Replace(5, 6, "FIVE!")
+	b.Insert(0, "<")
+	b.Delete(8, 9)
+
+	got := b.QueueDelta(prev)
+	want := QueueDelta{
+		Added: []PlacedEdit{
+			{Edit{0, 0, "<"}, 0, 1},
+			{Edit{5, 6, "FIVE!"}, 8, 13},
+		},
+		Removed: []PlacedEdit{
+			{Edit{5, 6, "five"}, 7, 11},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("QueueDelta() = %+v, want %+v", got, want)
+	}
+	if s := b.String(); s[8:13] != "FIVE!" {
+		t.Errorf("b.String()[8:13] = %q, want %q", s[8:13], "FIVE!")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("QueueDelta did not panic for different originals")
+		}
+	}()
+	b.QueueDelta(NewBufferString("012345678"))
+}
+
+func TestChanges(t *testing.T) {
+	b := NewBufferString("0123456789")
+	b.ReplaceLabeled(5, 6, "five", "spell")
+	b.Insert(2, "ab")
+	b.Insert(3, "")
+	b.Delete(7, 9)
+	b.Delete(8, 9)
+	got := b.Changes()
+	want := []Change{
+		{Start: 2, End: 2, OutStart: 2, OutEnd: 4, New: "ab"},
+		{Start: 5, End: 6, OutStart: 7, OutEnd: 11, Old: "5", New: "five", Label: "spell"},
+		{Start: 7, End: 9, OutStart: 12, OutEnd: 12, Old: "78"},
+		{Start: 8, End: 9, OutStart: 12, OutEnd: 12, Old: "8"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Changes() = %+v, want %+v", got, want)
+	}
+	out := b.String()
+	for _, c := range got {
+		if s := out[c.OutStart:c.OutEnd]; s != c.New {
+			t.Errorf("edited data at [%d,%d) is %q, want %q", c.OutStart, c.OutEnd, s, c.New)
+		}
+	}
+}
+
+func TestEditsHash(t *testing.T) {
+	b1 := NewBufferString("0123456789")
+	b1.Replace(1, 2, "one")
+	b1.Delete(2, 4)
+	b1.Delete(4, 6)
+	b1.Insert(8, "x")
+	b1.Insert(8, "y")
+
+	b2 := NewBuffer([]byte("0123456789"))
+	b2.Insert(8, "x")
+	b2.Insert(3, "")
+	b2.Delete(2, 6)
+	b2.Delete(3, 5)
+	b2.Replace(1, 2, "one")
+	b2.Insert(8, "y")
+
+	if b1.EditsHash() != b2.EditsHash() {
+		t.Errorf("equivalent edits hash differently: %v vs %v", b1.normalized(), b2.normalized())
+	}
+
+	b3 := NewBufferString("0123456789")
+	b3.Replace(1, 2, "one")
+	b3.Delete(2, 6)
+	b3.Insert(8, "y")
+	b3.Insert(8, "x")
+	if b1.EditsHash() == b3.EditsHash() {
+		t.Errorf("edits with different results hash the same")
+	}
+}
+
+func TestNextPrevEditFrom(t *testing.T) {
+	b := NewBufferString("0123456789")
+	b.Replace(6, 7, "six")
+	b.Insert(2, "two")
+	tests := []struct {
+		pos        int
+		next, prev Edit
+		nok, pok   bool
+	}{
+		{0, Edit{2, 2, "two"}, Edit{}, true, false},
+		{2, Edit{2, 2, "two"}, Edit{}, true, false},
+		{3, Edit{6, 7, "six"}, Edit{2, 2, "two"}, true, true},
+		{6, Edit{6, 7, "six"}, Edit{2, 2, "two"}, true, true},
+		{7, Edit{}, Edit{6, 7, "six"}, false, true},
+	}
+	for _, tt := range tests {
+		if got, ok := b.NextEditFrom(tt.pos); got != tt.next || ok != tt.nok {
+			t.Errorf("NextEditFrom(%d) = %v, %v; want %v, %v", tt.pos, got, ok, tt.next, tt.nok)
+		}
+		if got, ok := b.PrevEditFrom(tt.pos); got != tt.prev || ok != tt.pok {
+			t.Errorf("PrevEditFrom(%d) = %v, %v; want %v, %v", tt.pos, got, ok, tt.prev, tt.pok)
+		}
+	}
+}
+
+func TestEditorChanges(t *testing.T) {
+	b := NewBufferString("0123456789")
+	b.Replace(6, 7, "six")
+	b.Insert(2, "two")
+	b.Delete(3, 4)
+	b.Delete(4, 5)
+	b.Insert(9, "")
+	want := []EditorChange{{2, 2, "two"}, {3, 5, ""}, {6, 7, "six"}}
+	if got := b.EditorChanges(); !reflect.DeepEqual(got, want) {
+		t.Errorf("EditorChanges() = %v, want %v", got, want)
+	}
+}
+
+func TestChanged(t *testing.T) {
+	tests := []struct {
+		name string
+		edit func(b *Buffer)
+		want bool
+	}{
+		{"none", func(b *Buffer) {}, false},
+		{"identity replace", func(b *Buffer) { b.Replace(3, 4, "3") }, false},
+		{"empty insert", func(b *Buffer) { b.Insert(5, "") }, false},
+		{"empty delete", func(b *Buffer) { b.Delete(5, 5) }, false},
+		{"delete and reinsert", func(b *Buffer) {
+			b.Delete(2, 4)
+			b.Insert(2, "23")
+		}, false},
+		{"replace", func(b *Buffer) { b.Replace(3, 4, "x") }, true},
+		{"insert", func(b *Buffer) { b.Insert(5, "x") }, true},
+		{"delete", func(b *Buffer) { b.Delete(5, 6) }, true},
+		{"swap", func(b *Buffer) {
+			b.Replace(1, 2, "2")
+			b.Replace(2, 3, "1")
+		}, true},
+	}
+	for _, tt := range tests {
+		b := NewBuffer([]byte("0123456789"))
+		tt.edit(b)
+		if got := b.Changed(); got != tt.want {
+			t.Errorf("%s: Changed() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	// Edits that move identical text do not change the data.
+	b := NewBufferString("aa")
+	b.Delete(0, 1)
+	b.Insert(2, "a")
+	if b.Changed() {
+		t.Errorf("Changed() = true for %q -> %q", "aa", b.String())
+	}
+}
+
+func TestConflicts(t *testing.T) {
+	b := NewBufferString("0123456789")
+	b.Replace(3, 4, "three")
+	b.Insert(4, "four")
+	b.Replace(4, 6, "five")
+	b.Delete(0, 2)
+	b.Delete(1, 3) // overlapping deletions merge
+	if got := b.Conflicts(); got != nil {
+		t.Errorf("Conflicts() = %v, want none", got)
+	}
+	b.Replace(5, 8, "six")
+	b.Insert(7, "!")
+	b.ReplaceSoft(5, 6, "soft") // dropped, so not reported
+	want := []Conflict{
+		{A: Edit{4, 6, "five"}, B: Edit{5, 8, "six"}},
+		{A: Edit{5, 8, "six"}, B: Edit{7, 7, "!"}},
+	}
+	if got := b.Conflicts(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Conflicts() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,159 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package edit
+
+import (
+	"fmt"
+	"io"
+)
+
+// ApplyReader copies r to w, applying edits to the data as it is copied,
+// and returns the number of bytes written. Unlike a Buffer, it does not hold
+// the data in memory, which is read in a single forward pass, so the edits
+// must be sorted by offset: each edit must start at or after the end of the
+// one before it. Insertions at the same offset are applied in order.
+// ApplyReader returns an error if an edit is out of order or extends past
+// the end of the data, or if reading from r or writing to w fails.
+func ApplyReader(r io.Reader, edits []Edit, w io.Writer) (int64, error) {
+	edits64 := make([]Edit64, len(edits))
+	for i, e := range edits {
+		edits64[i] = Edit64{int64(e.Start), int64(e.End), e.New}
+	}
+	return ApplyReader64(r, edits64, w)
+}
+
+// An Edit64 is like an Edit, but with 64-bit offsets, for edits to streams
+// longer than an int can address, as on 32-bit platforms.
+type Edit64 struct {
+	Start int64  `json:"start"`
+	End   int64  `json:"end"`
+	New   string `json:"new"`
+}
+
+// ApplyReader64 is like ApplyReader but takes edits with 64-bit offsets,
+// so that it can edit streams of any length, even on 32-bit platforms.
+func ApplyReader64(r io.Reader, edits []Edit64, w io.Writer) (int64, error) {
+	var n int64
+	var pos int64 // offset in r of the next byte to read
+	for _, e := range edits {
+		if e.End < e.Start {
+			return n, fmt.Errorf("edit: invalid edit position [%d,%d)", e.Start, e.End)
+		}
+		if e.Start < pos {
+			return n, fmt.Errorf("edit: edit [%d,%d) starts before the end of the previous edit at %d", e.Start, e.End, pos)
+		}
+		m, err := io.CopyN(w, r, e.Start-pos)
+		n += m
+		if err != nil {
+			return n, readerError(err, e, pos+m)
+		}
+		k, err := io.WriteString(w, e.New)
+		n += int64(k)
+		if err != nil {
+			return n, err
+		}
+		if m, err := io.CopyN(io.Discard, r, e.End-e.Start); err != nil {
+			return n, readerError(err, e, e.Start+m)
+		}
+		pos = e.End
+	}
+	m, err := io.Copy(w, r)
+	return n + m, err
+}
+
+// readerError returns the error for err from copying the data for e,
+// which ended at offset off.
+func readerError(err error, e Edit64, off int64) error {
+	if err == io.EOF {
+		return fmt.Errorf("edit: edit [%d,%d) past end of data at %d", e.Start, e.End, off)
+	}
+	return err
+}
+
+// Reader returns a reader of the data with queued edits applied.
+// The reader copies unchanged data and replacement text as they are read,
+// rather than materializing the edited data. It reflects the edits queued
+// when Reader was called; b must not be changed while the reader is in use,
+// nor its original data modified. If two edits overlap, reading returns the
+// edited data through the first of them and then a *ConflictError.
+func (b *Buffer) Reader() io.Reader {
+	r := new(editReader)
+	r.err = b.walkErr(func(start, end int) error {
+		r.pieces = append(r.pieces, readPiece{start: start, end: end, span: true})
+		return nil
+	}, func(start, end int, new string) error {
+		if new != "" {
+			r.pieces = append(r.pieces, readPiece{new: new})
+		}
+		return nil
+	})
+	if r.err == nil {
+		r.err = io.EOF
+	}
+	r.b = b
+	return r
+}
+
+// An editReader reads the pieces of the edited data of b in turn.
+type editReader struct {
+	b      *Buffer
+	pieces []readPiece
+	off    int   // bytes of pieces[0] already read
+	err    error // returned after the pieces are read
+}
+
+// A readPiece is a span of original data, or a replacement text.
+type readPiece struct {
+	start, end int
+	new        string
+	span       bool
+}
+
+// len returns the length of the piece.
+func (pc *readPiece) len() int {
+	if pc.span {
+		return pc.end - pc.start
+	}
+	return len(pc.new)
+}
+
+func (r *editReader) Read(p []byte) (int, error) {
+	n := 0
+	for n < len(p) && len(r.pieces) > 0 {
+		pc := &r.pieces[0]
+		var m int
+		switch {
+		case !pc.span:
+			m = copy(p[n:], pc.new[r.off:])
+		case r.b.old != nil:
+			m = copy(p[n:], r.b.old[pc.start+r.off:pc.end])
+		case r.b.src != nil:
+			k := pc.len() - r.off
+			if k > len(p)-n {
+				k = len(p) - n
+			}
+			var err error
+			if m, err = r.b.src.ReadAt(p[n:n+k], int64(pc.start+r.off)); m < k {
+				if err == io.EOF {
+					// The source is shorter than the length given for it.
+					err = io.ErrUnexpectedEOF
+				}
+				r.pieces, r.err = nil, err
+			}
+		default:
+			m = copy(p[n:], r.b.str[pc.start+r.off:pc.end])
+		}
+		n += m
+		r.off += m
+		if r.off == pc.len() {
+			r.pieces = r.pieces[1:]
+			r.off = 0
+		}
+	}
+	if n == 0 && len(p) > 0 {
+		return 0, r.err
+	}
+	return n, nil
+}
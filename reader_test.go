@@ -0,0 +1,142 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package edit
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestApplyReader(t *testing.T) {
+	const in = "0123456789"
+	edits := []Edit{
+		{Start: 0, End: 0, New: "<"},
+		{Start: 3, End: 4, New: "three"},
+		{Start: 4, End: 4, New: "!"},
+		{Start: 4, End: 4, New: "?"},
+		{Start: 6, End: 8, New: ""},
+		{Start: 10, End: 10, New: ">"},
+	}
+	var sb strings.Builder
+	n, err := ApplyReader(strings.NewReader(in), edits, &sb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := NewBufferString(in)
+	for _, e := range edits {
+		b.Replace(e.Start, e.End, e.New)
+	}
+	if want := b.String(); sb.String() != want || n != int64(len(want)) {
+		t.Errorf("ApplyReader wrote %q (n=%d), want %q", sb.String(), n, want)
+	}
+
+	for _, bad := range [][]Edit{
+		{{Start: 3, End: 5}, {Start: 4, End: 6}}, // out of order
+		{{Start: 5, End: 4}},                     // malformed
+		{{Start: 11, End: 11, New: "x"}},         // past end
+		{{Start: 8, End: 12}},                    // past end
+	} {
+		if _, err := ApplyReader(strings.NewReader(in), bad, io.Discard); err == nil {
+			t.Errorf("ApplyReader(%v) succeeded", bad)
+		}
+	}
+}
+
+func TestApplyReader64(t *testing.T) {
+	var sb strings.Builder
+	edits := []Edit64{{1, 3, "x"}, {5, 5, "y"}}
+	if n, err := ApplyReader64(strings.NewReader("0123456"), edits, &sb); err != nil || sb.String() != "0x34y56" || n != 7 {
+		t.Errorf("ApplyReader64 wrote %q (n=%d), %v; want %q (n=7), nil", sb.String(), n, err, "0x34y56")
+	}
+	if _, err := ApplyReader64(strings.NewReader("0123456"), []Edit64{{1 << 33, 1 << 33, "x"}}, io.Discard); err == nil {
+		t.Errorf("ApplyReader64 with an edit past the end succeeded")
+	}
+}
+
+// benchmarkEdits returns edits to data of length n, for BenchmarkApplyReader.
+func benchmarkEdits(n int) []Edit {
+	var edits []Edit
+	for off := 0; off+4 <= n; off += 4096 {
+		edits = append(edits, Edit{Start: off, End: off + 4, New: "edit"})
+	}
+	return edits
+}
+
+func TestBufferReader(t *testing.T) {
+	for _, b := range []*Buffer{NewBufferString("0123456789"), NewBuffer([]byte("0123456789"))} {
+		b.Insert(8, ",7½,")
+		b.Replace(3, 4, "three,")
+		b.Delete(0, 1)
+		want := b.String()
+		for _, size := range []int{1, 2, 5, 100} {
+			r := b.Reader()
+			var got []byte
+			buf := make([]byte, size)
+			for {
+				n, err := r.Read(buf)
+				got = append(got, buf[:n]...)
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			if string(got) != want {
+				t.Errorf("reading with %d-byte reads got %q, want %q", size, got, want)
+			}
+		}
+	}
+
+	b := NewBufferString("0123456789")
+	b.Replace(1, 2, "one")
+	b.Replace(5, 7, "x")
+	b.Replace(6, 8, "y")
+	got, err := io.ReadAll(b.Reader())
+	if string(got) != "0one234x" || !errors.As(err, new(*ConflictError)) {
+		t.Errorf("reading overlapping edits = %q, %v, want %q and *ConflictError", got, err, "0one234x")
+	}
+
+	// A source shorter than its given length is an error, not the end of the data.
+	b = NewBufferFromReaderAt(strings.NewReader("01234"), 10)
+	b.Replace(1, 2, "one")
+	got, err = io.ReadAll(b.Reader())
+	if string(got) != "0one234" || err != io.ErrUnexpectedEOF {
+		t.Errorf("reading short source = %q, %v, want %q, io.ErrUnexpectedEOF", got, err, "0one234")
+	}
+}
+
+func BenchmarkApplyReader(b *testing.B) {
+	data := bytes.Repeat([]byte("0123456789abcdef"), 1<<16)
+	edits := benchmarkEdits(len(data))
+	b.ReportAllocs()
+	b.SetBytes(int64(len(data)))
+	for i := 0; i < b.N; i++ {
+		if _, err := ApplyReader(bytes.NewReader(data), edits, io.Discard); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkApplyMaterialized(b *testing.B) {
+	data := bytes.Repeat([]byte("0123456789abcdef"), 1<<16)
+	edits := benchmarkEdits(len(data))
+	b.ReportAllocs()
+	b.SetBytes(int64(len(data)))
+	for i := 0; i < b.N; i++ {
+		old, err := io.ReadAll(bytes.NewReader(data))
+		if err != nil {
+			b.Fatal(err)
+		}
+		buf := NewBuffer(old)
+		for _, e := range edits {
+			buf.Replace(e.Start, e.End, e.New)
+		}
+		buf.WriteTo(io.Discard)
+	}
+}
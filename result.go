@@ -0,0 +1,773 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package edit
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha1"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"strconv"
+	"unicode/utf8"
+)
+
+// GitBlob returns the data with queued edits applied, prefixed with a git
+// blob object header ("blob <len>\x00"), along with the object's SHA-1 id.
+// The id matches what git hash-object reports for the edited data.
+func (b *Buffer) GitBlob() ([]byte, [20]byte) {
+	n := b.ResultLen()
+	hdr := "blob " + strconv.Itoa(n) + "\x00"
+	buf := bytes.NewBuffer(make([]byte, 0, len(hdr)+n))
+	buf.WriteString(hdr)
+	b.writeAll(buf)
+	obj := buf.Bytes()
+	return obj, sha1.Sum(obj)
+}
+
+// ConcatResults writes the edited data of each buffer to w, in argument order.
+// Each buffer's edits are applied independently of the others;
+// overlaps are only checked within a buffer, not across buffers.
+func ConcatResults(w io.Writer, bs ...*Buffer) (int64, error) {
+	var total int64
+	for _, b := range bs {
+		n, err := b.WriteTo(w)
+		total += n
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+// WritePadded writes the data with queued edits applied to w as a record
+// of exactly size bytes. If the edited data is shorter than size,
+// it is followed by copies of pad; if it is longer, it is cut off after size
+// bytes and truncated is true. Truncated is false if the edited data fits
+// exactly. The returned n counts all bytes written, including padding.
+// WritePadded panics if size is negative.
+func (b *Buffer) WritePadded(w io.Writer, size int, pad byte) (n int64, truncated bool, err error) {
+	if size < 0 {
+		panic("invalid size")
+	}
+	room := int64(size)
+	err = b.walkErr(func(start, end int) error {
+		if int64(end-start) > room {
+			end = start + int(room)
+			truncated = true
+		}
+		m, err := b.writeSpan(w, start, end)
+		n += int64(m)
+		room -= int64(m)
+		if err == nil && truncated {
+			err = errStopWalk
+		}
+		return err
+	}, func(start, end int, new string) error {
+		if int64(len(new)) > room {
+			new = new[:room]
+			truncated = true
+		}
+		m, err := io.WriteString(w, new)
+		n += int64(m)
+		room -= int64(m)
+		if err == nil && truncated {
+			err = errStopWalk
+		}
+		return err
+	})
+	if err == errStopWalk {
+		err = nil
+	}
+	if err != nil || room <= 0 {
+		return n, truncated, b.overlapErr(err)
+	}
+	m, err := w.Write(bytes.Repeat([]byte{pad}, int(room)))
+	n += int64(m)
+	return n, truncated, err
+}
+
+// ErrLimitReached is returned by WriteToLimit when the edited data
+// does not fit in the limit.
+var ErrLimitReached = errors.New("edit: output limit reached")
+
+// ErrOutputTooLarge is returned by WriteTo, Apply, and other methods that return
+// an error when the edited data is longer than allowed by SetMaxOutputSize.
+var ErrOutputTooLarge = errors.New("edit: output exceeds maximum size")
+
+// SetMaxOutputSize limits the length of the data with queued edits applied
+// to n bytes, as a defense against untrusted edits that insert huge amounts
+// of text. When the edited data would be longer, WriteTo, Apply, and other
+// methods that return an error return ErrOutputTooLarge before writing any of it,
+// and Bytes, String, and other methods that cannot return an error panic.
+// Methods that only measure the data, such as ResultLen, are not limited,
+// nor is WriteToLimit. A size of 0 or less removes the limit, as by default.
+func (b *Buffer) SetMaxOutputSize(n int) {
+	b.maxOutput = n
+	b.invalidate()
+}
+
+// tooLarge reports whether the original data with the sorted edits q applied
+// is longer than the maximum output size, stopping as soon as it is.
+func (b *Buffer) tooLarge(q edits) bool {
+	if b.maxOutput <= 0 {
+		return false
+	}
+	n := 0
+	b.walkQueue(q, func(start, end int) error {
+		n += end - start
+		if n > b.maxOutput {
+			return errStopWalk
+		}
+		return nil
+	}, func(start, end int, new string) error {
+		n += len(new)
+		if n > b.maxOutput {
+			return errStopWalk
+		}
+		return nil
+	})
+	return n > b.maxOutput
+}
+
+// WriteToLimit is like WriteTo but writes at most limit bytes to w.
+// If the edited data is longer than limit, WriteToLimit writes its first
+// limit bytes, cutting short whichever original text or replacement text
+// the limit falls inside, and returns ErrLimitReached.
+// WriteToLimit panics if limit is negative.
+func (b *Buffer) WriteToLimit(w io.Writer, limit int64) (n int64, err error) {
+	if limit < 0 {
+		panic("invalid limit")
+	}
+	room := limit
+	cut := false
+	err = b.walkErr(func(start, end int) error {
+		if int64(end-start) > room {
+			end = start + int(room)
+			cut = true
+		}
+		m, err := b.writeSpan(w, start, end)
+		n += int64(m)
+		room -= int64(m)
+		if err == nil && cut {
+			err = ErrLimitReached
+		}
+		return err
+	}, func(start, end int, new string) error {
+		if int64(len(new)) > room {
+			new = new[:room]
+			cut = true
+		}
+		m, err := io.WriteString(w, new)
+		n += int64(m)
+		room -= int64(m)
+		if err == nil && cut {
+			err = ErrLimitReached
+		}
+		return err
+	})
+	return n, b.overlapErr(err)
+}
+
+// WriteToBuffered writes the data with queued edits applied to bw.
+// It does not flush bw; the caller must call bw.Flush when done writing.
+func (b *Buffer) WriteToBuffered(bw *bufio.Writer) (int64, error) {
+	return b.WriteTo(bw)
+}
+
+// ForEach walks the data with queued edits applied, in order, without
+// building it. For each unchanged region of the original data, ForEach calls
+// fn with its original offsets, its text, and isOriginal set to true.
+// For each edit, ForEach calls fn with the offsets of the original data it
+// replaces, its replacement text, and isOriginal set to false; a deletion has
+// empty text. The concatenated texts are the edited data.
+// If fn returns an error, ForEach stops and returns that error.
+// Like WriteTo, ForEach returns a *ConflictError if queued edits overlap.
+func (b *Buffer) ForEach(fn func(origStart, origEnd int, text string, isOriginal bool) error) error {
+	return b.overlapErr(b.walkErr(func(start, end int) error {
+		return fn(start, end, b.text(start, end), true)
+	}, func(start, end int, new string) error {
+		return fn(start, end, new, false)
+	}))
+}
+
+// A Segment is a piece of the data with queued edits applied: either
+// unchanged original data, or the replacement text of an edit.
+type Segment struct {
+	Start, End int    // the range of original data the segment keeps or replaces
+	New        string // the replacement text, if not Original
+	Original   bool   // the segment is the original data in [Start, End)
+}
+
+// Segments calls yield with each segment of the data with queued edits applied,
+// in order, until yield returns false. Original segments refer to the original
+// data by offset rather than copying it. Deletions are included, with empty New.
+// Segments panics if queued edits overlap.
+//
+// Segments has the form of an iterator, so that with Go 1.23 or later, callers
+// can range over it: for s := range b.Segments { ... }.
+func (b *Buffer) Segments(yield func(Segment) bool) {
+	b.walk(func(start, end int) error {
+		if !yield(Segment{Start: start, End: end, Original: true}) {
+			return errStopWalk
+		}
+		return nil
+	}, func(start, end int, new string) error {
+		if !yield(Segment{Start: start, End: end, New: new}) {
+			return errStopWalk
+		}
+		return nil
+	})
+}
+
+// BytesFromPool returns the data with queued edits applied, stored in a slice
+// obtained by calling get with the exact length of the result.
+// The slice returned by get should have at least that capacity;
+// its contents are overwritten. If it is too small, a larger slice is allocated.
+// The caller owns the returned slice and may return it to its pool when done.
+func (b *Buffer) BytesFromPool(get func(n int) []byte) []byte {
+	return b.appendTo(get(b.ResultLen())[:0])
+}
+
+// StreamBlocks calls fn with the data with queued edits applied, split into
+// consecutive blocks of blockSize bytes. The last block may be shorter.
+// If fn returns an error, StreamBlocks stops and returns that error.
+// The block passed to fn is reused for every call; fn must not retain it.
+// StreamBlocks panics if blockSize is not positive.
+func (b *Buffer) StreamBlocks(blockSize int, fn func(block []byte) error) error {
+	if blockSize <= 0 {
+		panic("invalid block size")
+	}
+	w := &blockWriter{buf: make([]byte, 0, blockSize), fn: fn}
+	if _, err := b.WriteTo(w); err != nil {
+		return err
+	}
+	if len(w.buf) > 0 {
+		return fn(w.buf)
+	}
+	return nil
+}
+
+// A blockWriter accumulates writes into buf and passes each full buf to fn.
+type blockWriter struct {
+	buf []byte
+	fn  func([]byte) error
+}
+
+func (w *blockWriter) Write(p []byte) (int, error) {
+	n := 0
+	for len(p) > 0 {
+		m := copy(w.buf[len(w.buf):cap(w.buf)], p)
+		w.buf = w.buf[:len(w.buf)+m]
+		p = p[m:]
+		n += m
+		if len(w.buf) == cap(w.buf) {
+			if err := w.fn(w.buf); err != nil {
+				return n, err
+			}
+			w.buf = w.buf[:0]
+		}
+	}
+	return n, nil
+}
+
+func (w *blockWriter) WriteString(s string) (int, error) {
+	n := 0
+	for len(s) > 0 {
+		m := copy(w.buf[len(w.buf):cap(w.buf)], s)
+		w.buf = w.buf[:len(w.buf)+m]
+		s = s[m:]
+		n += m
+		if len(w.buf) == cap(w.buf) {
+			if err := w.fn(w.buf); err != nil {
+				return n, err
+			}
+			w.buf = w.buf[:0]
+		}
+	}
+	return n, nil
+}
+
+// Index calls fn for each contiguous run of the data with queued edits applied,
+// in order, with the run's offset in the edited data.
+// Inserted is true for replacement text and false for unchanged original data.
+// Together the runs cover the edited data exactly once.
+// For a buffer created by NewBuffer, unchanged runs alias the original data;
+// fn must not modify or retain them.
+func (b *Buffer) Index(fn func(outOffset int, data []byte, inserted bool)) {
+	out := 0
+	b.walk(func(start, end int) error {
+		if b.old != nil {
+			fn(out, b.old[start:end], false)
+		} else if b.src != nil {
+			fn(out, b.readSrc(start, end), false)
+		} else {
+			fn(out, []byte(b.str[start:end]), false)
+		}
+		out += end - start
+		return nil
+	}, func(start, end int, new string) error {
+		if new != "" {
+			fn(out, []byte(new), true)
+			out += len(new)
+		}
+		return nil
+	})
+}
+
+// rollingPrime is the multiplier of the polynomial rolling hash used by RollingChunks.
+const rollingPrime = 16777619
+
+// RollingChunks splits the data with queued edits applied into content-defined
+// chunks and returns their ranges [start, end) in the edited data.
+// A rolling hash is computed over each window of window consecutive bytes;
+// a chunk ends after any byte at which the hash of the window ending there
+// satisfies hash&mask == 0. Larger masks (more bits set) give larger chunks,
+// about mask+1 bytes on average for a mask of the form 2^k-1.
+// Because boundaries depend only on nearby content, an edit moves only the
+// boundaries near it. The result is deterministic for identical output.
+// RollingChunks panics if window is not positive.
+func (b *Buffer) RollingChunks(window int, mask uint32) [][2]int {
+	if window <= 0 {
+		panic("invalid window size")
+	}
+	c := &chunker{window: make([]byte, window), mask: mask, pow: 1}
+	for i := 0; i < window; i++ {
+		c.pow *= rollingPrime
+	}
+	b.writeAll(c)
+	if c.start < c.n {
+		c.chunks = append(c.chunks, [2]int{c.start, c.n})
+	}
+	return c.chunks
+}
+
+// A chunker computes content-defined chunk boundaries of the data written to it.
+type chunker struct {
+	window []byte // ring buffer of the last len(window) bytes
+	mask   uint32
+	pow    uint32 // rollingPrime^len(window)
+	hash   uint32
+	n      int // bytes written so far
+	start  int // start of the current chunk
+	chunks [][2]int
+}
+
+func (c *chunker) add(x byte) {
+	i := c.n % len(c.window)
+	c.hash = c.hash*rollingPrime + uint32(x) - c.pow*uint32(c.window[i])
+	c.window[i] = x
+	c.n++
+	if c.n >= len(c.window) && c.hash&c.mask == 0 {
+		c.chunks = append(c.chunks, [2]int{c.start, c.n})
+		c.start = c.n
+	}
+}
+
+func (c *chunker) Write(p []byte) (int, error) {
+	for _, x := range p {
+		c.add(x)
+	}
+	return len(p), nil
+}
+
+func (c *chunker) WriteString(s string) (int, error) {
+	for i := 0; i < len(s); i++ {
+		c.add(s[i])
+	}
+	return len(s), nil
+}
+
+// WriteFirstN writes the original data to w with only the first n queued edits
+// applied, counting in the order edits are applied (by position, not call order).
+// The remaining edits are ignored, as if they had never been queued,
+// and are not considered when checking for overlapping edits.
+// If n is at least the number of queued edits, WriteFirstN is equivalent to WriteTo.
+func (b *Buffer) WriteFirstN(w io.Writer, n int) (int64, error) {
+	q := b.applied()
+	if n < 0 {
+		n = 0
+	}
+	if n < len(q) {
+		q = q[:n]
+	}
+	written, err := b.writeQueue(w, q)
+	return written, b.overlapErr(err)
+}
+
+// Slice returns a new byte slice holding bytes [start, end) of the data
+// with queued edits applied, equivalent to b.Bytes()[start:end]
+// but without building the rest of the result.
+// It panics if start > end or the range is not within [0, ResultLen()].
+func (b *Buffer) Slice(start, end int) []byte {
+	if start < 0 || end < start {
+		panic("invalid offset")
+	}
+	buf := make([]byte, 0, end-start)
+	out := 0
+	// piece appends the part of the output [out, out+n) within [start, end),
+	// reading it with text.
+	piece := func(n int, text func(i, j int) string) error {
+		lo, hi := start-out, end-out
+		if lo < 0 {
+			lo = 0
+		}
+		if hi > n {
+			hi = n
+		}
+		if lo < hi {
+			buf = append(buf, text(lo, hi)...)
+		}
+		out += n
+		if out >= end {
+			return errStopWalk
+		}
+		return nil
+	}
+	b.walk(func(s, e int) error {
+		return piece(e-s, func(i, j int) string { return b.text(s+i, s+j) })
+	}, func(s, e int, new string) error {
+		return piece(len(new), func(i, j int) string { return new[i:j] })
+	})
+	if out < end {
+		panic("invalid offset")
+	}
+	return buf
+}
+
+// WriteGzipTo writes the data with queued edits applied to w, gzip-compressed
+// at the given compression level (see compress/gzip), in a single pass.
+// It returns the number of compressed bytes written to w.
+// The uncompressed size is ResultLen.
+func (b *Buffer) WriteGzipTo(w io.Writer, level int) (int64, error) {
+	cw := &countingWriter{w: w}
+	zw, err := gzip.NewWriterLevel(cw, level)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := b.WriteTo(zw); err != nil {
+		zw.Close()
+		return cw.n, err
+	}
+	err = zw.Close()
+	return cw.n, err
+}
+
+// A countingWriter counts the bytes written to w.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.n += int64(n)
+	return n, err
+}
+
+// WriteToContext is like WriteTo but stops early if ctx is done,
+// returning ctx.Err(). It checks ctx before writing each piece of unchanged
+// data or replacement text, and between chunks of data read from an
+// io.ReaderAt (see NewBufferFromReaderAt), so that a huge write can be
+// abandoned promptly, though a single write to w is not interrupted.
+func (b *Buffer) WriteToContext(ctx context.Context, w io.Writer) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	n, err := b.writeQueue(&contextWriter{ctx: ctx, w: w}, b.applied())
+	return n, b.overlapErr(err)
+}
+
+// A contextWriter writes to w until ctx is done.
+type contextWriter struct {
+	ctx context.Context
+	w   io.Writer
+}
+
+func (w *contextWriter) Write(p []byte) (int, error) {
+	if err := w.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return w.w.Write(p)
+}
+
+func (w *contextWriter) WriteString(s string) (int, error) {
+	if err := w.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return io.WriteString(w.w, s)
+}
+
+// ApplyWithLog returns the data with queued edits applied, along with a
+// description of each change made, in the order applied, such as
+//
+//	deleted "foo" at 3-6
+//	inserted "bar" at 10
+//	replaced "x" with "y" at 12-13
+//
+// Offsets refer to the original data. The changes are those of the
+// normalized edits, as used by EditsHash: overlapping deletions are merged,
+// adjacent edits are combined, and empty insertions are omitted.
+func (b *Buffer) ApplyWithLog() (result []byte, log []string) {
+	for _, s := range b.normalized() {
+		var entry string
+		switch {
+		case s.Start == s.End:
+			entry = fmt.Sprintf("inserted %q at %d", s.New, s.Start)
+		case s.New == "":
+			entry = fmt.Sprintf("deleted %q at %d-%d", b.text(s.Start, s.End), s.Start, s.End)
+		default:
+			entry = fmt.Sprintf("replaced %q with %q at %d-%d", b.text(s.Start, s.End), s.New, s.Start, s.End)
+		}
+		log = append(log, entry)
+	}
+	return b.Bytes(), log
+}
+
+// ResultWithChecksum returns the data with queued edits applied along with
+// its SHA-256 checksum, which always equals sha256.Sum256(data).
+// It is a convenience for storing edited data with a digest
+// guaranteed to have been computed from that same data.
+func (b *Buffer) ResultWithChecksum() (data []byte, sum [32]byte) {
+	data = b.Bytes()
+	return data, sha256.Sum256(data)
+}
+
+// AssertBaseHash returns an error if the SHA-256 checksum of the original
+// data is not want. It is a quick check, before applying edits, that they were
+// computed against the expected version of the data. The queued edits are not consulted.
+// For a Buffer over an io.ReaderAt, AssertBaseHash also returns any error reading the data.
+func (b *Buffer) AssertBaseHash(want [32]byte) error {
+	h := sha256.New()
+	if _, err := b.writeSpan(h, 0, b.contentsLen()); err != nil {
+		return err
+	}
+	var got [32]byte
+	h.Sum(got[:0])
+	if got != want {
+		return fmt.Errorf("edit: original data has SHA-256 %x, want %x", got, want)
+	}
+	return nil
+}
+
+// Equal reports whether the data with queued edits applied is other.
+// It is equivalent to bytes.Equal(b.Bytes(), other), but compares span by span
+// without materializing the edited data, stopping at the first difference.
+// Overlapping edits cause a panic, as with Bytes.
+func (b *Buffer) Equal(other []byte) bool {
+	out := 0
+	// piece reports whether the output continues with other[out:out+n] and advances past it.
+	piece := func(n int, eq func([]byte) bool) error {
+		if n > len(other)-out || !eq(other[out:out+n]) {
+			return errStopWalk
+		}
+		out += n
+		return nil
+	}
+	err := b.walk(func(start, end int) error {
+		return piece(end-start, func(p []byte) bool {
+			if b.old != nil {
+				return bytes.Equal(p, b.old[start:end])
+			}
+			if b.src != nil {
+				return bytes.Equal(p, b.readSrc(start, end))
+			}
+			return string(p) == b.str[start:end]
+		})
+	}, func(start, end int, new string) error {
+		return piece(len(new), func(p []byte) bool { return string(p) == new })
+	})
+	return err == nil && out == len(other)
+}
+
+// Sum writes the data with queued edits applied to h, span by span
+// without materializing it, and returns the resulting digest, h.Sum(nil).
+// The data is added to whatever h has already been written;
+// call h.Reset first to hash only the edited data.
+// Overlapping edits cause a panic, as with Bytes.
+func (b *Buffer) Sum(h hash.Hash) []byte {
+	b.writeAll(h)
+	return h.Sum(nil)
+}
+
+// ResultContains reports whether sub appears in the data with queued edits applied.
+// It is equivalent to bytes.Contains(b.Bytes(), sub), but searches span by span
+// without materializing the edited data, stopping at the first match.
+func (b *Buffer) ResultContains(sub []byte) bool {
+	return len(sub) == 0 || b.resultCount(sub, 1) > 0
+}
+
+// ResultCount returns the number of non-overlapping instances of sub
+// in the data with queued edits applied. It is equivalent to
+// bytes.Count(b.Bytes(), sub), but searches span by span without
+// materializing the edited data, unless sub is empty.
+func (b *Buffer) ResultCount(sub []byte) int {
+	if len(sub) == 0 {
+		return utf8.RuneCount(b.Bytes()) + 1
+	}
+	return b.resultCount(sub, -1)
+}
+
+// resultCount counts the instances of the non-empty sub in the edited data,
+// stopping once it has found limit of them, if limit is non-negative.
+func (b *Buffer) resultCount(sub []byte, limit int) int {
+	m := &matcher{sub: sub}
+	stop := func() error {
+		if limit >= 0 && m.n >= limit {
+			return errStopWalk
+		}
+		return nil
+	}
+	b.walk(func(start, end int) error {
+		if b.old != nil {
+			m.write(b.old[start:end])
+		} else if b.src != nil {
+			m.write(b.readSrc(start, end))
+		} else {
+			m.writeString(b.str[start:end])
+		}
+		return stop()
+	}, func(start, end int, new string) error {
+		m.writeString(new)
+		return stop()
+	})
+	return m.n
+}
+
+// A matcher counts non-overlapping instances of sub in data written to it in pieces,
+// including instances that straddle pieces.
+type matcher struct {
+	sub     []byte
+	n       int    // instances found
+	carry   []byte // unmatched end of the data so far that might start an instance
+	scratch []byte // buffer for writeString
+}
+
+// matcherChunk is the size of the pieces in which writeString searches strings.
+const matcherChunk = 4096
+
+func (m *matcher) writeString(s string) {
+	for len(s) > 0 {
+		n := len(s)
+		if n > matcherChunk {
+			n = matcherChunk
+		}
+		m.scratch = append(m.scratch[:0], s[:n]...)
+		m.write(m.scratch)
+		s = s[n:]
+	}
+}
+
+func (m *matcher) write(p []byte) {
+	k := len(m.sub) - 1 // longest carry
+	if len(p) < k {
+		w := append(m.carry, p...)
+		m.carry = append(m.carry[:0:0], w[m.search(w, 0, k):]...)
+		return
+	}
+	// Search for instances that start in the carry in a window
+	// just long enough to hold them, then in the rest of p.
+	w := append(m.carry, p[:k]...)
+	skip := m.search(w, 0, len(w)) - len(m.carry)
+	if skip < 0 {
+		skip = 0
+	}
+	m.carry = append(m.carry[:0], p[m.search(p, skip, k):]...)
+}
+
+// search counts the instances in p at or after offset from,
+// and returns the offset at which to resume searching later data:
+// the end of the last instance, or len(p)-keep if that is later.
+func (m *matcher) search(p []byte, from, keep int) int {
+	for {
+		i := bytes.Index(p[from:], m.sub)
+		if i < 0 {
+			break
+		}
+		m.n++
+		from += i + len(m.sub)
+	}
+	if tail := len(p) - keep; tail > from {
+		from = tail
+	}
+	return from
+}
+
+// ApplyInPlace returns the data with queued edits applied, like Bytes, but if
+// the edited data is no longer than the original, ApplyInPlace writes it over
+// the original byte slice passed to NewBuffer and returns a prefix of that slice,
+// rather than allocating. The original data is destroyed, so b must not be used
+// afterward, nor the original slice except through the result. If the edited data
+// is longer, or b holds a string, ApplyInPlace returns a new slice, like Bytes.
+// Like Bytes, it panics if the edited data is longer than allowed by SetMaxOutputSize.
+func (b *Buffer) ApplyInPlace() []byte {
+	n := b.OutputLen()
+	if b.old == nil || n > len(b.old) {
+		return b.Bytes()
+	}
+	if b.maxOutput > 0 && n > b.maxOutput {
+		panic("output exceeds maximum size")
+	}
+	type piece struct {
+		start, end int    // original data consumed
+		out        int    // offset of the piece in the edited data
+		new        string // replacement text, if not a span of original data
+		span       bool
+	}
+	ps := make([]piece, 0, 2*len(b.q)+1)
+	out := 0
+	b.walk(func(start, end int) error {
+		ps = append(ps, piece{start: start, end: end, out: out, span: true})
+		out += end - start
+		return nil
+	}, func(start, end int, new string) error {
+		ps = append(ps, piece{start: start, end: end, out: out, new: new})
+		out += len(new)
+		return nil
+	})
+	put := func(p piece) {
+		if p.span {
+			copy(b.old[p.out:], b.old[p.start:p.end])
+		} else {
+			copy(b.old[p.out:], p.new)
+		}
+	}
+	// ahead reports whether writing piece i would overwrite original
+	// data after it, which later pieces have yet to copy.
+	ahead := func(i int) bool {
+		p := ps[i]
+		n := len(p.new)
+		if p.span {
+			n = p.end - p.start
+		}
+		return p.out+n > p.end
+	}
+	for i := 0; i < len(ps); {
+		if !ahead(i) {
+			put(ps[i])
+			i++
+			continue
+		}
+		// Pieces i through j-1 are ahead, but j is not, since the edited data
+		// is no longer than the original. Piece j's original data is
+		// overwritten by the pieces before it, so copy it first,
+		// then copy those pieces from last to first.
+		j := i
+		for ahead(j) {
+			j++
+		}
+		put(ps[j])
+		for k := j - 1; k >= i; k-- {
+			put(ps[k])
+		}
+		i = j + 1
+	}
+	return b.old[:n]
+}
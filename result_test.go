@@ -0,0 +1,747 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package edit
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestResultLen(t *testing.T) {
+	b := NewBufferString("0123456789")
+	b.Insert(8, ",7½,")
+	b.Replace(9, 10, "the-end")
+	b.Delete(2, 4)
+	b.Delete(3, 5)
+	if got, want := b.ResultLen(), len(b.Bytes()); got != want {
+		t.Errorf("b.ResultLen() = %d, want %d", got, want)
+	}
+	if got, err := b.TryResultLen(); got != len(b.Bytes()) || err != nil {
+		t.Errorf("b.TryResultLen() = %d, %v, want %d, nil", got, err, len(b.Bytes()))
+	}
+	b.Replace(8, 10, "x")
+	if got, err := b.TryResultLen(); !errors.As(err, new(*ConflictError)) {
+		t.Errorf("b.TryResultLen() with overlapping edits = %d, %v, want *ConflictError", got, err)
+	}
+}
+
+func TestResultEmpty(t *testing.T) {
+	b := NewBufferString("0123456789")
+	if b.ResultEmpty() {
+		t.Errorf("ResultEmpty() = true for unedited buffer")
+	}
+	b.Delete(0, 6)
+	b.Delete(4, 10)
+	if !b.ResultEmpty() {
+		t.Errorf("ResultEmpty() = false after deleting everything, output %q", b.String())
+	}
+	b.Insert(10, "x")
+	if b.ResultEmpty() {
+		t.Errorf("ResultEmpty() = true with pending insert")
+	}
+	if e := NewBufferString(""); !e.ResultEmpty() {
+		t.Errorf("ResultEmpty() = false for empty buffer")
+	}
+}
+
+func TestGitBlob(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		// Ids computed with git hash-object.
+		{"hello, world\n", "4b5fa63702dd96796042e92787f464e28f09f17d"},
+		{"", "e69de29bb2d1d6434b8b29ae775ad8c2e48c5391"},
+	}
+	for _, tt := range tests {
+		b := NewBufferString("hello\n")
+		b.Replace(0, 6, tt.in)
+		obj, id := b.GitBlob()
+		if got := hex.EncodeToString(id[:]); got != tt.want {
+			t.Errorf("GitBlob id for %q = %s, want %s", tt.in, got, tt.want)
+		}
+		if want := fmt.Sprintf("blob %d\x00%s", len(tt.in), tt.in); string(obj) != want {
+			t.Errorf("GitBlob object = %q, want %q", obj, want)
+		}
+	}
+}
+
+func TestConcatResults(t *testing.T) {
+	data := []byte("0123456789")
+	b1 := NewBuffer(data[:5])
+	b1.Replace(1, 3, "X")
+	b2 := NewBuffer(data[3:])
+	b2.Insert(0, "Y")
+	b2.Delete(5, 7)
+
+	var sb strings.Builder
+	n, err := ConcatResults(&sb, b1, b2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := b1.String() + b2.String()
+	if got := sb.String(); got != want {
+		t.Errorf("ConcatResults wrote %q, want %q", got, want)
+	}
+	if n != int64(len(want)) {
+		t.Errorf("ConcatResults returned %d, want %d", n, len(want))
+	}
+}
+
+func TestWritePadded(t *testing.T) {
+	tests := []struct {
+		size      int
+		want      string
+		truncated bool
+	}{
+		{12, "0ab3456789..", false},
+		{10, "0ab3456789", false},
+		{4, "0ab3", true},
+		{2, "0a", true},
+		{0, "", true},
+	}
+	for _, tt := range tests {
+		b := NewBufferString("0123456789")
+		b.Replace(1, 3, "ab")
+		b.Delete(4, 5)
+		b.Insert(5, "4")
+		var sb strings.Builder
+		n, truncated, err := b.WritePadded(&sb, tt.size, '.')
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := sb.String(); got != tt.want || truncated != tt.truncated || n != int64(len(tt.want)) {
+			t.Errorf("WritePadded(%d) = %q, %d, %v; want %q, %d, %v", tt.size, got, n, truncated, tt.want, len(tt.want), tt.truncated)
+		}
+	}
+
+	defer func() {
+		if r := recover(); r != "invalid size" {
+			t.Errorf("WritePadded(-1) panicked with %v, want %q", r, "invalid size")
+		}
+	}()
+	NewBufferString("0123456789").WritePadded(io.Discard, -1, '.')
+}
+
+func TestWriteToBuffered(t *testing.T) {
+	b := NewBufferString("0123456789")
+	b.Replace(3, 4, "three,")
+	var sb strings.Builder
+	bw := bufio.NewWriterSize(&sb, 64)
+	n, err := b.WriteToBuffered(bw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sb.Len() != 0 {
+		t.Errorf("WriteToBuffered flushed %q", sb.String())
+	}
+	if err := bw.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := sb.String(), b.String(); got != want || n != int64(len(want)) {
+		t.Errorf("WriteToBuffered wrote %q (n=%d), want %q", got, n, want)
+	}
+}
+
+func TestBytesFromPool(t *testing.T) {
+	b := NewBufferString("0123456789")
+	b.Insert(8, ",7½,")
+	b.Replace(3, 4, "three,")
+	want := b.String()
+	scratch := make([]byte, 0, 64)
+	var asked int
+	got := b.BytesFromPool(func(n int) []byte {
+		asked = n
+		return scratch
+	})
+	if string(got) != want {
+		t.Errorf("BytesFromPool() = %q, want %q", got, want)
+	}
+	if asked != len(want) {
+		t.Errorf("BytesFromPool asked for %d bytes, want %d", asked, len(want))
+	}
+	if &got[0] != &scratch[:1][0] {
+		t.Errorf("BytesFromPool did not use the pooled slice")
+	}
+}
+
+func TestStreamBlocks(t *testing.T) {
+	b := NewBufferString("0123456789")
+	b.Insert(8, ",7½,")
+	b.Replace(3, 4, "three,")
+	want := b.String()
+	for _, size := range []int{1, 3, 4, len(want), 100} {
+		var blocks []string
+		err := b.StreamBlocks(size, func(block []byte) error {
+			blocks = append(blocks, string(block))
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, blk := range blocks {
+			if i < len(blocks)-1 && len(blk) != size || len(blk) == 0 || len(blk) > size {
+				t.Errorf("StreamBlocks(%d): block %d has length %d", size, i, len(blk))
+			}
+		}
+		if got := strings.Join(blocks, ""); got != want {
+			t.Errorf("StreamBlocks(%d) produced %q, want %q", size, got, want)
+		}
+	}
+
+	stop := errors.New("stop")
+	calls := 0
+	err := b.StreamBlocks(2, func(block []byte) error {
+		calls++
+		return stop
+	})
+	if err != stop || calls != 1 {
+		t.Errorf("StreamBlocks returned %v after %d calls, want %v after 1", err, calls, stop)
+	}
+}
+
+func TestForEach(t *testing.T) {
+	b := NewBufferString("0123456789")
+	b.Insert(8, ",7½,")
+	b.Replace(3, 4, "three,")
+	b.Delete(5, 6)
+	var got strings.Builder
+	var calls []string
+	err := b.ForEach(func(origStart, origEnd int, text string, isOriginal bool) error {
+		got.WriteString(text)
+		calls = append(calls, fmt.Sprintf("%d:%d %q %v", origStart, origEnd, text, isOriginal))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.String() != b.String() {
+		t.Errorf("ForEach produced %q, want %q", got.String(), b.String())
+	}
+	want := []string{
+		`0:3 "012" true`,
+		`3:4 "three," false`,
+		`4:5 "4" true`,
+		`5:6 "" false`,
+		`6:8 "67" true`,
+		`8:8 ",7½," false`,
+		`8:10 "89" true`,
+	}
+	if !reflect.DeepEqual(calls, want) {
+		t.Errorf("ForEach calls:\n%s\nwant:\n%s", strings.Join(calls, "\n"), strings.Join(want, "\n"))
+	}
+
+	stop := errors.New("stop")
+	n := 0
+	err = b.ForEach(func(origStart, origEnd int, text string, isOriginal bool) error {
+		n++
+		return stop
+	})
+	if err != stop || n != 1 {
+		t.Errorf("ForEach returned %v after %d calls, want %v after 1", err, n, stop)
+	}
+}
+
+func TestSegments(t *testing.T) {
+	old := []byte("0123456789")
+	b := NewBuffer(old)
+	b.Insert(8, ",7½,")
+	b.Replace(3, 4, "three,")
+	b.Delete(5, 6)
+	var got []byte
+	var segs []Segment
+	b.Segments(func(s Segment) bool {
+		segs = append(segs, s)
+		if s.Original {
+			got = append(got, old[s.Start:s.End]...)
+		} else {
+			got = append(got, s.New...)
+		}
+		return true
+	})
+	if string(got) != b.String() {
+		t.Errorf("Segments produced %q, want %q", got, b.String())
+	}
+	want := []Segment{
+		{0, 3, "", true},
+		{3, 4, "three,", false},
+		{4, 5, "", true},
+		{5, 6, "", false},
+		{6, 8, "", true},
+		{8, 8, ",7½,", false},
+		{8, 10, "", true},
+	}
+	if !reflect.DeepEqual(segs, want) {
+		t.Errorf("Segments yielded %v, want %v", segs, want)
+	}
+
+	n := 0
+	b.Segments(func(Segment) bool {
+		n++
+		return n < 2
+	})
+	if n != 2 {
+		t.Errorf("Segments continued after yield returned false: %d calls, want 2", n)
+	}
+}
+
+func TestIndex(t *testing.T) {
+	b := NewBuffer([]byte("0123456789"))
+	b.Insert(8, ",7½,")
+	b.Replace(9, 10, "the-end")
+	b.Delete(1, 2)
+	var sb strings.Builder
+	var runs []string
+	b.Index(func(outOffset int, data []byte, inserted bool) {
+		if outOffset != sb.Len() {
+			t.Errorf("run %q at offset %d, want %d", data, outOffset, sb.Len())
+		}
+		sb.Write(data)
+		runs = append(runs, fmt.Sprintf("%q:%v", data, inserted))
+	})
+	if got, want := sb.String(), b.String(); got != want {
+		t.Errorf("Index covered %q, want %q", got, want)
+	}
+	want := []string{`"0":false`, `"234567":false`, `",7½,":true`, `"8":false`, `"the-end":true`}
+	if strings.Join(runs, " ") != strings.Join(want, " ") {
+		t.Errorf("Index runs = %v, want %v", runs, want)
+	}
+}
+
+func TestRollingChunks(t *testing.T) {
+	data := make([]byte, 1<<16)
+	rand.New(rand.NewSource(1)).Read(data)
+	const window, mask = 16, 1<<8 - 1
+
+	b := NewBuffer(data)
+	chunks := b.RollingChunks(window, mask)
+	if len(chunks) < 2 {
+		t.Fatalf("RollingChunks returned %d chunks", len(chunks))
+	}
+	off := 0
+	for _, c := range chunks {
+		if c[0] != off || c[1] <= c[0] {
+			t.Fatalf("chunk %v does not follow offset %d", c, off)
+		}
+		off = c[1]
+	}
+	if off != len(data) {
+		t.Fatalf("chunks end at %d, want %d", off, len(data))
+	}
+
+	// Inserting near the front only moves later boundaries by the inserted length.
+	const ins = "inserted text"
+	b.Insert(10, ins)
+	edited := b.RollingChunks(window, mask)
+	want := make(map[int]bool)
+	for _, c := range chunks {
+		if c[1] > 10+window {
+			want[c[1]+len(ins)] = true
+		}
+	}
+	for _, c := range edited {
+		delete(want, c[1])
+	}
+	if len(want) > 0 {
+		t.Errorf("%d chunk boundaries moved after an insertion near the front", len(want))
+	}
+}
+
+func TestWriteFirstN(t *testing.T) {
+	b := NewBufferString("0123456789")
+	b.Replace(8, 9, "eight")
+	b.Insert(2, "two")
+	b.Delete(4, 6)
+	b.Replace(5, 8, "x") // overlaps the deletion, so never reached
+	want := []string{
+		"0123456789",
+		"01two23456789",
+		"01two236789",
+	}
+	for n, w := range want {
+		var sb strings.Builder
+		if _, err := b.WriteFirstN(&sb, n); err != nil {
+			t.Fatal(err)
+		}
+		if got := sb.String(); got != w {
+			t.Errorf("WriteFirstN(%d) = %q, want %q", n, got, w)
+		}
+	}
+	if _, err := b.WriteFirstN(new(strings.Builder), 10); !errors.As(err, new(*ConflictError)) {
+		t.Errorf("WriteFirstN(10) = %v, want *ConflictError for overlapping edits", err)
+	}
+	b.OnConflict(ConflictPanic, nil)
+	defer func() {
+		if recover() == nil {
+			t.Errorf("WriteFirstN(10) did not panic on overlapping edits with ConflictPanic")
+		}
+	}()
+	b.WriteFirstN(new(strings.Builder), 10)
+}
+
+func TestWriteGzipTo(t *testing.T) {
+	b := NewBufferString(strings.Repeat("0123456789", 100))
+	b.Insert(8, ",7½,")
+	b.Replace(3, 4, "three,")
+	var buf bytes.Buffer
+	n, err := b.WriteGzipTo(&buf, gzip.BestCompression)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(buf.Len()) {
+		t.Errorf("WriteGzipTo returned %d, wrote %d bytes", n, buf.Len())
+	}
+	zr, err := gzip.NewReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != b.String() {
+		t.Errorf("decompressed %q, want %q", got, b.String())
+	}
+
+	if _, err := b.WriteGzipTo(&buf, 42); err == nil {
+		t.Errorf("WriteGzipTo with invalid level succeeded")
+	}
+}
+
+func TestApplyWithLog(t *testing.T) {
+	b := NewBufferString("0123456789")
+	b.Insert(8, "bar")
+	b.Delete(3, 5)
+	b.Delete(4, 6)
+	b.Replace(9, 10, "nine")
+	b.Insert(1, "")
+	result, log := b.ApplyWithLog()
+	if got, want := string(result), b.String(); got != want {
+		t.Errorf("ApplyWithLog result = %q, want %q", got, want)
+	}
+	want := []string{
+		`deleted "345" at 3-6`,
+		`inserted "bar" at 8`,
+		`replaced "9" with "nine" at 9-10`,
+	}
+	if !reflect.DeepEqual(log, want) {
+		t.Errorf("ApplyWithLog log = %q, want %q", log, want)
+	}
+}
+
+func TestResultWithChecksum(t *testing.T) {
+	b := NewBufferString("0123456789")
+	b.Replace(3, 4, "three,")
+	data, sum := b.ResultWithChecksum()
+	if string(data) != b.String() {
+		t.Errorf("ResultWithChecksum data = %q, want %q", data, b.String())
+	}
+	if sum != sha256.Sum256(data) {
+		t.Errorf("ResultWithChecksum sum = %x, want %x", sum, sha256.Sum256(data))
+	}
+}
+
+func TestAssertBaseHash(t *testing.T) {
+	const in = "0123456789"
+	b := NewBufferString(in)
+	b.Replace(3, 4, "three,")
+	if err := b.AssertBaseHash(sha256.Sum256([]byte(in))); err != nil {
+		t.Errorf("AssertBaseHash(original) = %v", err)
+	}
+	if err := b.AssertBaseHash(sha256.Sum256([]byte(b.String()))); err == nil {
+		t.Errorf("AssertBaseHash(edited) succeeded")
+	}
+
+	ra := &countingReaderAt{r: strings.NewReader(in), fail: 5}
+	b = NewBufferFromReaderAt(ra, int64(len(in)))
+	if err := b.AssertBaseHash(sha256.Sum256([]byte(in))); err == nil || err.Error() != "read failed" {
+		t.Errorf("AssertBaseHash with a failing reader = %v, want read error", err)
+	}
+}
+
+func TestResultCount(t *testing.T) {
+	const in = "abababab"
+	tests := []struct {
+		sub  string
+		want int
+	}{
+		{"ab", 3},
+		{"aab", 1},  // straddles an original span and an insertion
+		{"XYb", 1},  // straddles a replacement, an insertion, and a span
+		{"abba", 1}, // straddles an insertion and two spans
+		{"b", 5},
+		{"aba", 0},
+		{"", 12},
+	}
+	for _, newBuf := range []func(string) *Buffer{
+		NewBufferString,
+		func(s string) *Buffer { return NewBuffer([]byte(s)) },
+	} {
+		b := newBuf(in)
+		b.Replace(2, 3, "X")
+		b.Insert(3, "Y")
+		b.Insert(5, "ab")
+		out := b.String()
+		for _, tt := range tests {
+			if want := strings.Count(out, tt.sub); want != tt.want {
+				t.Fatalf("bad test: %q contains %q %d times, not %d", out, tt.sub, want, tt.want)
+			}
+			if got := b.ResultCount([]byte(tt.sub)); got != tt.want {
+				t.Errorf("ResultCount(%q) in %q = %d, want %d", tt.sub, out, got, tt.want)
+			}
+			if got := b.ResultContains([]byte(tt.sub)); got != (tt.want > 0) {
+				t.Errorf("ResultContains(%q) in %q = %v, want %v", tt.sub, out, got, tt.want > 0)
+			}
+		}
+	}
+
+	// Instances do not overlap, even across pieces.
+	b := NewBufferString("aa")
+	b.Insert(1, "a")
+	b.Insert(2, "a")
+	if got, want := b.ResultCount([]byte("aa")), 2; got != want {
+		t.Errorf("ResultCount(%q) in %q = %d, want %d", "aa", b.String(), got, want)
+	}
+
+	// Long replacements are searched in pieces.
+	b = NewBufferString("x")
+	b.Replace(0, 1, strings.Repeat("ab", matcherChunk))
+	if got, want := b.ResultCount([]byte("ba")), matcherChunk-1; got != want {
+		t.Errorf("ResultCount(%q) = %d, want %d", "ba", got, want)
+	}
+}
+
+func TestWriteToLimit(t *testing.T) {
+	b := NewBufferString("0123456789")
+	b.Replace(3, 4, "three")
+	b.Insert(10, "!")
+	const out = "012three456789!"
+	for limit := 0; limit <= len(out)+1; limit++ {
+		// Limits 0-3 and 8-14 fall in original text, 3-8 in
+		// a replacement, and 14-15 in an insertion.
+		var sb strings.Builder
+		n, err := b.WriteToLimit(&sb, int64(limit))
+		want := out
+		wantErr := error(nil)
+		if limit < len(out) {
+			want = out[:limit]
+			wantErr = ErrLimitReached
+		}
+		if sb.String() != want || n != int64(len(want)) || err != wantErr {
+			t.Errorf("WriteToLimit(%d) wrote %q (n=%d), %v; want %q, %v", limit, sb.String(), n, err, want, wantErr)
+		}
+	}
+
+	n, err := b.WriteToLimit(&limitedWriter{n: 2}, 5)
+	if n != 2 || err != errFull {
+		t.Errorf("WriteToLimit to full writer = %d, %v; want 2, %v", n, err, errFull)
+	}
+}
+
+func TestApplyInPlace(t *testing.T) {
+	tests := []struct {
+		edit    func(b *Buffer)
+		want    string
+		inPlace bool
+	}{
+		{func(b *Buffer) { b.Delete(2, 4) }, "01456789", true},
+		{func(b *Buffer) {
+			// The insertion runs ahead of the original data until the deletion.
+			b.Insert(1, "ab")
+			b.Replace(3, 4, "c")
+			b.Delete(6, 9)
+		}, "0ab12c459", true},
+		{func(b *Buffer) { b.Insert(1, "ab") }, "0ab123456789", false},
+	}
+	for _, tt := range tests {
+		orig := []byte("0123456789")
+		b := NewBuffer(orig)
+		tt.edit(b)
+		got := b.ApplyInPlace()
+		if string(got) != tt.want {
+			t.Errorf("ApplyInPlace() = %q, want %q", got, tt.want)
+		}
+		if inPlace := &got[0] == &orig[0]; inPlace != tt.inPlace {
+			t.Errorf("ApplyInPlace() for %q reused original = %v, want %v", tt.want, inPlace, tt.inPlace)
+		}
+	}
+}
+
+// shrinkingEdits queues edits that shrink data of length n by a tenth.
+func shrinkingEdits(b *Buffer, n int) {
+	for off := 0; off+100 <= n; off += 100 {
+		b.Replace(off, off+20, "0123456789")
+	}
+}
+
+func BenchmarkApplyInPlace(b *testing.B) {
+	data := bytes.Repeat([]byte("0123456789abcdef"), 1<<16)
+	buf := make([]byte, len(data))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		copy(buf, data)
+		eb := NewBuffer(buf)
+		shrinkingEdits(eb, len(buf))
+		b.StartTimer()
+		sink = eb.ApplyInPlace()
+	}
+}
+
+func BenchmarkApplyBytes(b *testing.B) {
+	data := bytes.Repeat([]byte("0123456789abcdef"), 1<<16)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		eb := NewBuffer(data)
+		shrinkingEdits(eb, len(data))
+		b.StartTimer()
+		sink = eb.Bytes()
+	}
+}
+
+func TestSlice(t *testing.T) {
+	b := NewBufferString("0123456789")
+	b.Replace(1, 3, "onetwo")
+	b.Insert(5, "+")
+	b.Delete(7, 9)
+	b.Insert(10, "end")
+	want := b.String()
+	for start := 0; start <= len(want); start++ {
+		for end := start; end <= len(want); end++ {
+			if got := string(b.Slice(start, end)); got != want[start:end] {
+				t.Errorf("Slice(%d, %d) = %q, want %q", start, end, got, want[start:end])
+			}
+		}
+	}
+	for _, r := range [][2]int{{-1, 2}, {3, 2}, {0, len(want) + 1}} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Slice(%d, %d) did not panic", r[0], r[1])
+				}
+			}()
+			b.Slice(r[0], r[1])
+		}()
+	}
+}
+
+func TestEqualSum(t *testing.T) {
+	b := NewBufferString("0123456789")
+	b.Replace(1, 3, "onetwo")
+	b.Delete(7, 9)
+	b.Insert(10, "end")
+	want := b.String()
+	for _, other := range []string{want, "", want[:len(want)-1], want + "x", "0onetwo3456x9end"} {
+		if got := b.Equal([]byte(other)); got != (other == want) {
+			t.Errorf("Equal(%q) = %v, want %v", other, got, other == want)
+		}
+	}
+	if got, wantSum := b.Sum(sha256.New()), sha256.Sum256([]byte(want)); !bytes.Equal(got, wantSum[:]) {
+		t.Errorf("Sum = %x, want %x", got, wantSum)
+	}
+	if !NewBufferString("").Equal(nil) {
+		t.Errorf("Equal(nil) of empty buffer = false, want true")
+	}
+}
+
+func TestSetMaxOutputSize(t *testing.T) {
+	b := NewBufferString("0123456789")
+	b.Insert(5, strings.Repeat("x", 100))
+	b.SetMaxOutputSize(100)
+	var sb strings.Builder
+	if n, err := b.WriteTo(&sb); n != 0 || err != ErrOutputTooLarge || sb.Len() != 0 {
+		t.Errorf("WriteTo = %d, %v, wrote %d bytes; want 0, ErrOutputTooLarge, none", n, err, sb.Len())
+	}
+	if _, err := b.Apply(); err != ErrOutputTooLarge {
+		t.Errorf("Apply() error = %v, want ErrOutputTooLarge", err)
+	}
+	if got := b.ResultLen(); got != 110 {
+		t.Errorf("ResultLen() = %d, want 110", got)
+	}
+	for name, f := range map[string]func(){
+		"Bytes":    func() { b.Bytes() },
+		"String":   func() { _ = b.String() },
+		"AppendTo": func() { b.AppendTo(nil) },
+		"Sum":      func() { b.Sum(sha256.New()) },
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s did not panic with output over the maximum size", name)
+				}
+			}()
+			f()
+		}()
+	}
+
+	b.SetMaxOutputSize(110)
+	if got := b.String(); len(got) != 110 {
+		t.Errorf("len(String()) = %d with output at the maximum size, want 110", len(got))
+	}
+	b.SetMaxOutputSize(1)
+	b.SetMaxOutputSize(0)
+	if _, err := b.Apply(); err != nil {
+		t.Errorf("Apply() with no maximum size = %v", err)
+	}
+
+	// ApplyInPlace checks the maximum size even when the result fits in place.
+	orig := []byte("0123456789")
+	b = NewBuffer(orig)
+	b.Delete(0, 2)
+	b.SetMaxOutputSize(5)
+	defer func() {
+		if recover() == nil {
+			t.Errorf("ApplyInPlace did not panic with output over the maximum size")
+		}
+		if string(orig) != "0123456789" {
+			t.Errorf("ApplyInPlace overwrote the original data with output over the maximum size")
+		}
+	}()
+	b.ApplyInPlace()
+}
+
+func TestWriteToContext(t *testing.T) {
+	b := NewBufferString("0123456789")
+	b.Replace(3, 4, "three")
+	b.Insert(10, "!")
+	var sb strings.Builder
+	n, err := b.WriteToContext(context.Background(), &sb)
+	if want := "012three456789!"; sb.String() != want || n != int64(len(want)) || err != nil {
+		t.Errorf("WriteToContext = %d, %v, wrote %q; want %d, nil, %q", n, err, sb.String(), len(want), want)
+	}
+
+	// Cancel after the first piece is written.
+	ctx, cancel := context.WithCancel(context.Background())
+	w := &cancelWriter{cancel: cancel}
+	n, err = b.WriteToContext(ctx, w)
+	if w.buf.String() != "012" || n != 3 || err != context.Canceled {
+		t.Errorf("WriteToContext with cancellation = %d, %v, wrote %q; want 3, %v, %q", n, err, w.buf.String(), context.Canceled, "012")
+	}
+	if n, err := b.WriteToContext(ctx, w); n != 0 || err != context.Canceled {
+		t.Errorf("WriteToContext with done context = %d, %v; want 0, %v", n, err, context.Canceled)
+	}
+}
+
+// A cancelWriter calls cancel after each write.
+type cancelWriter struct {
+	buf    bytes.Buffer
+	cancel func()
+}
+
+func (w *cancelWriter) Write(p []byte) (int, error) {
+	defer w.cancel()
+	return w.buf.Write(p)
+}
@@ -0,0 +1,94 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package edit
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+)
+
+// ReplaceAll queues a replacement with new of each non-overlapping instance
+// of old in the original data, searching from the start, and returns the
+// number of replacements queued. It searches the original data, unaffected
+// by other queued edits. ReplaceAll panics if old is empty.
+func (b *Buffer) ReplaceAll(old, new string) int {
+	if old == "" {
+		panic("empty search string")
+	}
+	data, str := b.searchData()
+	n := 0
+	for off := 0; ; {
+		var i int
+		if data != nil {
+			i = bytes.Index(data[off:], []byte(old))
+		} else {
+			i = strings.Index(str[off:], old)
+		}
+		if i < 0 {
+			break
+		}
+		i += off
+		b.Replace(i, i+len(old), new)
+		n++
+		off = i + len(old)
+	}
+	return n
+}
+
+// ReplaceAllRegexp queues a replacement of each match of re in the original
+// data, found as by re.FindAllIndex, and returns the number of replacements
+// queued. Each match is replaced by repl with $1, ${name}, and so on expanded
+// against that match, as by re.Expand. As with re.ReplaceAll, the matches do
+// not overlap, and an empty match queues an insertion of the expanded text at
+// the match position; for example, with (?m)^ each line gets a prefix.
+// A match immediately after a preceding non-empty match cannot be empty.
+// The search is of the original data, unaffected by other queued edits.
+func (b *Buffer) ReplaceAllRegexp(re *regexp.Regexp, repl string) int {
+	data, str := b.searchData()
+	var matches [][]int
+	if data != nil {
+		matches = re.FindAllSubmatchIndex(data, -1)
+	} else {
+		matches = re.FindAllStringSubmatchIndex(str, -1)
+	}
+	var dst []byte
+	for _, m := range matches {
+		if data != nil {
+			dst = re.Expand(dst[:0], []byte(repl), data, m)
+		} else {
+			dst = re.ExpandString(dst[:0], repl, str, m)
+		}
+		b.Replace(m[0], m[1], string(dst))
+	}
+	return len(matches)
+}
+
+// ReplaceAllRegexpFunc is like ReplaceAllRegexp, but each match is replaced
+// by the result of calling repl with the matched text of the original data,
+// as by re.ReplaceAllStringFunc. The text is not expanded.
+func (b *Buffer) ReplaceAllRegexpFunc(re *regexp.Regexp, repl func(match string) string) int {
+	data, str := b.searchData()
+	var matches [][]int
+	if data != nil {
+		matches = re.FindAllIndex(data, -1)
+	} else {
+		matches = re.FindAllStringIndex(str, -1)
+	}
+	for _, m := range matches {
+		b.Replace(m[0], m[1], repl(b.text(m[0], m[1])))
+	}
+	return len(matches)
+}
+
+// searchData returns the original data for searching: either old, or if old
+// is nil, str. For a buffer created by NewBufferFromReaderAt, searchData reads
+// all the data into old.
+func (b *Buffer) searchData() (old []byte, str string) {
+	if b.src != nil {
+		return b.readSrc(0, b.srcLen), ""
+	}
+	return b.old, b.str
+}
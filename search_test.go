@@ -0,0 +1,94 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package edit
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestReplaceAll(t *testing.T) {
+	tests := []struct {
+		in, old, new string
+		want         string
+		n            int
+	}{
+		{"a.b.c", ".", "::", "a::b::c", 2},
+		{"aaaa", "aa", "b", "bb", 2},
+		{"aaaaa", "aa", "b", "bba", 2},
+		{"abc", "x", "y", "abc", 0},
+		{"abcabc", "abc", "", "", 2},
+	}
+	for _, tt := range tests {
+		for _, b := range []*Buffer{NewBufferString(tt.in), NewBuffer([]byte(tt.in))} {
+			if n := b.ReplaceAll(tt.old, tt.new); n != tt.n {
+				t.Errorf("ReplaceAll(%q, %q) in %q = %d, want %d", tt.old, tt.new, tt.in, n, tt.n)
+			}
+			if got := b.String(); got != tt.want {
+				t.Errorf("ReplaceAll(%q, %q) in %q produces %q, want %q", tt.old, tt.new, tt.in, got, tt.want)
+			}
+		}
+	}
+
+	// The search ignores other queued edits.
+	b := NewBufferString("x = x + 1")
+	b.Replace(0, 1, "y")
+	if n := b.ReplaceAll("x", "z"); n != 2 {
+		t.Errorf("ReplaceAll found %d instances, want 2", n)
+	}
+	if _, err := b.Apply(); err == nil {
+		t.Errorf("Apply() succeeded with a replacement overlapping an earlier edit")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("ReplaceAll with empty old did not panic")
+		}
+	}()
+	b.ReplaceAll("", "x")
+}
+
+func TestReplaceAllRegexp(t *testing.T) {
+	tests := []struct {
+		in, re, repl string
+		want         string
+		n            int
+	}{
+		{"f(a, b) f(c, d)", `f\((\w+), (\w+)\)`, "f($2, $1)", "f(b, a) f(d, c)", 2},
+		{"x=1 y=2", `(?P<key>\w)=(?P<val>\d)`, "${val}=${key}", "1=x 2=y", 2},
+		{"one\ntwo\n", `(?m)^`, "> ", "> one\n> two\n> ", 3},
+		{"abc", `x*`, "-", "-a-b-c-", 4},
+		{"aab", `a`, "[$0]", "[a][a]b", 2}, // adjacent matches
+		{"abc", `z`, "y", "abc", 0},
+	}
+	for _, tt := range tests {
+		re := regexp.MustCompile(tt.re)
+		for _, b := range []*Buffer{NewBufferString(tt.in), NewBuffer([]byte(tt.in))} {
+			if n := b.ReplaceAllRegexp(re, tt.repl); n != tt.n {
+				t.Errorf("ReplaceAllRegexp(%s, %q) in %q = %d, want %d", tt.re, tt.repl, tt.in, n, tt.n)
+			}
+			if got := b.String(); got != tt.want {
+				t.Errorf("ReplaceAllRegexp(%s, %q) in %q produces %q, want %q", tt.re, tt.repl, tt.in, got, tt.want)
+			}
+			if got := re.ReplaceAllString(tt.in, tt.repl); got != tt.want {
+				t.Errorf("bad test: regexp.ReplaceAllString produces %q, want %q", got, tt.want)
+			}
+		}
+	}
+}
+
+func TestReplaceAllRegexpFunc(t *testing.T) {
+	const in = "a1 b22 c333"
+	re := regexp.MustCompile(`\d+`)
+	for _, b := range []*Buffer{NewBufferString(in), NewBuffer([]byte(in))} {
+		b.Insert(0, "> ")
+		if n := b.ReplaceAllRegexpFunc(re, func(s string) string { return "<" + s + ">" }); n != 3 {
+			t.Errorf("ReplaceAllRegexpFunc = %d, want 3", n)
+		}
+		if got, want := b.String(), "> a<1> b<22> c<333>"; got != want {
+			t.Errorf("ReplaceAllRegexpFunc produces %q, want %q", got, want)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package edit
+
+import "sort"
+
+// Soft edits are best-effort: when the queued edits are applied,
+// a soft edit that overlaps a non-soft edit is silently dropped,
+// rather than causing a panic. Among soft edits that overlap each other,
+// the one applied first (the one that starts first, breaking ties by
+// ending first and then by call order) is kept and the others are dropped.
+// Overlaps between two non-soft edits are handled as usual.
+// Soft edits are only dropped for overlapping; insertions at the boundary
+// of another edit, which are never overlaps, are kept.
+
+// InsertSoft is like Insert but queues a soft edit, which is dropped
+// if it overlaps a non-soft edit.
+func (b *Buffer) InsertSoft(pos int, new string) {
+	b.Insert(pos, new)
+	b.q[len(b.q)-1].soft = true
+}
+
+// ReplaceSoft is like Replace but queues a soft edit, which is dropped
+// if it overlaps a non-soft edit.
+func (b *Buffer) ReplaceSoft(start, end int, new string) {
+	b.Replace(start, end, new)
+	b.q[len(b.q)-1].soft = true
+}
+
+// DroppedSoftEdits returns the queued soft edits that will be dropped
+// when the edits are applied, in the order they would have been applied.
+func (b *Buffer) DroppedSoftEdits() []Edit {
+	var specs []Edit
+	_, dropped := resolveSoft(b.sorted())
+	for _, e := range dropped {
+		specs = append(specs, e.spec())
+	}
+	return specs
+}
+
+// hasSoft reports whether x contains any soft edits.
+func (x edits) hasSoft() bool {
+	for _, e := range x {
+		if e.soft {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveSoft splits the sorted edits q into those to apply and the soft edits to drop,
+// preserving the order of each.
+func resolveSoft(q edits) (kept, dropped edits) {
+	var hard, soft edits
+	for _, e := range q {
+		if e.soft {
+			soft = append(soft, e)
+		} else {
+			hard = append(hard, e)
+		}
+	}
+	hardEnds := maxEnds(hard)
+	keep := make([]bool, len(soft))
+	var keptSoft edits
+	var keptEnds []int
+	for i, e := range soft {
+		if overlapsAny(hard, hardEnds, e) || overlapsAny(keptSoft, keptEnds, e) {
+			dropped = append(dropped, e)
+			continue
+		}
+		keep[i] = true
+		end := e.end
+		if n := len(keptEnds); n > 0 && keptEnds[n-1] > end {
+			end = keptEnds[n-1]
+		}
+		keptSoft = append(keptSoft, e)
+		keptEnds = append(keptEnds, end)
+	}
+	si := 0
+	for _, e := range q {
+		if e.soft {
+			if keep[si] {
+				kept = append(kept, e)
+			}
+			si++
+			continue
+		}
+		kept = append(kept, e)
+	}
+	return kept, dropped
+}
+
+// maxEnds returns, for each i, the largest end of the edits in q[:i+1].
+func maxEnds(q edits) []int {
+	ends := make([]int, len(q))
+	for i, e := range q {
+		ends[i] = e.end
+		if i > 0 && ends[i-1] > e.end {
+			ends[i] = ends[i-1]
+		}
+	}
+	return ends
+}
+
+// overlapsAny reports whether e conflicts with any of the sorted edits q,
+// where ends is maxEnds(q).
+func overlapsAny(q edits, ends []int, e edit) bool {
+	i := sort.Search(len(q), func(i int) bool { return q[i].start > e.end })
+	for i--; i >= 0 && ends[i] >= e.start; i-- {
+		if q[i].conflicts(e) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,38 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package edit
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSoftEdits(t *testing.T) {
+	b := NewBufferString("0123456789")
+	b.Replace(2, 5, "abc")
+	b.InsertSoft(3, "!")       // inside the replacement: dropped
+	b.InsertSoft(5, "^")       // at its boundary: kept
+	b.ReplaceSoft(4, 7, "xyz") // overlaps the replacement: dropped
+	b.ReplaceSoft(7, 9, "SS")  // kept
+	b.InsertSoft(8, "?")       // overlaps the earlier soft edit: dropped
+	b.Delete(6, 7)
+
+	if got, want := b.String(), "01abc^5SS9"; got != want {
+		t.Errorf("b.String() = %q, want %q", got, want)
+	}
+	want := []Edit{{3, 3, "!"}, {4, 7, "xyz"}, {8, 8, "?"}}
+	if got := b.DroppedSoftEdits(); !reflect.DeepEqual(got, want) {
+		t.Errorf("DroppedSoftEdits() = %v, want %v", got, want)
+	}
+
+	// Conflicts between non-soft edits still panic.
+	b.Replace(1, 3, "x")
+	defer func() {
+		if recover() == nil {
+			t.Errorf("overlapping non-soft edits did not panic")
+		}
+	}()
+	_ = b.String()
+}
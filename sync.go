@@ -0,0 +1,75 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package edit
+
+import (
+	"io"
+	"sync"
+)
+
+// A SyncBuffer is a Buffer whose Insert, Delete, and Replace methods
+// may be called concurrently, as when several goroutines discover edits
+// to the same data. Its WriteTo, Bytes, and String methods may be called
+// concurrently with them, and see the edits queued so far. Its other methods
+// are those of the embedded Buffer and must not be called concurrently
+// with each other or with the edit methods.
+type SyncBuffer struct {
+	*Buffer
+	mu sync.Mutex
+}
+
+// NewSyncBuffer returns a SyncBuffer that queues edits in b.
+func NewSyncBuffer(b *Buffer) *SyncBuffer {
+	return &SyncBuffer{Buffer: b}
+}
+
+// Concurrent returns a SyncBuffer that queues edits in b, for collecting
+// edits from several goroutines. It is shorthand for NewSyncBuffer(b).
+// While the SyncBuffer is in use, b itself must not be modified directly.
+func (b *Buffer) Concurrent() *SyncBuffer {
+	return NewSyncBuffer(b)
+}
+
+// Insert is like Buffer.Insert but may be called concurrently.
+func (b *SyncBuffer) Insert(pos int, new string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.Buffer.Insert(pos, new)
+}
+
+// Delete is like Buffer.Delete but may be called concurrently.
+func (b *SyncBuffer) Delete(start, end int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.Buffer.Delete(start, end)
+}
+
+// Replace is like Buffer.Replace but may be called concurrently.
+func (b *SyncBuffer) Replace(start, end int, new string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.Buffer.Replace(start, end, new)
+}
+
+// WriteTo is like Buffer.WriteTo but may be called concurrently with the edit methods.
+func (b *SyncBuffer) WriteTo(w io.Writer) (int64, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.Buffer.WriteTo(w)
+}
+
+// Bytes is like Buffer.Bytes but may be called concurrently with the edit methods.
+func (b *SyncBuffer) Bytes() []byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.Buffer.Bytes()
+}
+
+// String is like Buffer.String but may be called concurrently with the edit methods.
+func (b *SyncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.Buffer.String()
+}
@@ -0,0 +1,64 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package edit
+
+import (
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestSyncBuffer(t *testing.T) {
+	const n = 100
+	b := NewSyncBuffer(NewBufferString(strings.Repeat(".", n)))
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			switch i % 3 {
+			case 0:
+				b.Insert(i, "i")
+			case 1:
+				b.Replace(i, i+1, "r")
+			case 2:
+				b.Delete(i, i+1)
+			}
+		}(i)
+	}
+	wg.Wait()
+	want := strings.Repeat("i.r", n/3) + "i."
+	if got := b.String(); got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+}
+
+func TestConcurrent(t *testing.T) {
+	const n = 50
+	b := NewBufferString(strings.Repeat(".", n))
+	c := b.Concurrent()
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			c.Replace(i, i+1, "x")
+		}(i)
+		go func() {
+			defer wg.Done()
+			if s := c.String(); len(s) != n {
+				t.Errorf("len(String()) = %d while queueing, want %d", len(s), n)
+			}
+		}()
+	}
+	wg.Wait()
+	var sb strings.Builder
+	if _, err := c.WriteTo(&sb); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := sb.String(), strings.Repeat("x", n); got != want || b.String() != want {
+		t.Errorf("WriteTo wrote %q, b.String() = %q, want %q", got, b.String(), want)
+	}
+}
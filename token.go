@@ -0,0 +1,119 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package edit
+
+import (
+	"fmt"
+	"go/token"
+)
+
+// A FileBuffer is a Buffer for the source of a file parsed with go/parser or
+// otherwise recorded in a token.FileSet, with additional methods that take
+// edit positions as token.Pos values, such as those of go/ast nodes.
+type FileBuffer struct {
+	*Buffer
+	file *token.File
+}
+
+// NewFileBuffer returns a FileBuffer for src, the source of file.
+// It panics if the length of src is not the size of file.
+// As with NewBuffer, the caller must not modify src while the buffer is in use.
+func NewFileBuffer(file *token.File, src []byte) *FileBuffer {
+	if len(src) != file.Size() {
+		panic("source length does not match file size")
+	}
+	return &FileBuffer{Buffer: NewBuffer(src), file: file}
+}
+
+// File returns the file whose source b edits.
+func (b *FileBuffer) File() *token.File {
+	return b.file
+}
+
+// offset returns the offset in the source of pos, which must be in b's file.
+// The position just past the end of the file is valid, as for ast.File.End.
+func (b *FileBuffer) offset(pos token.Pos) int {
+	off, ok := b.tryOffset(pos)
+	if !ok {
+		panic("invalid edit position")
+	}
+	return off
+}
+
+// tryOffset is like offset but reports false instead of panicking.
+func (b *FileBuffer) tryOffset(pos token.Pos) (int, bool) {
+	off := int(pos) - b.file.Base()
+	if !pos.IsValid() || off < 0 || off > b.file.Size() {
+		return 0, false
+	}
+	return off, true
+}
+
+// InsertPos inserts new at pos.
+func (b *FileBuffer) InsertPos(pos token.Pos, new string) {
+	b.Insert(b.offset(pos), new)
+}
+
+// DeletePos deletes the source in [start, end), such as [n.Pos(), n.End())
+// for an ast.Node n.
+func (b *FileBuffer) DeletePos(start, end token.Pos) {
+	b.Delete(b.offset(start), b.offset(end))
+}
+
+// ReplacePos replaces the source in [start, end) with new.
+func (b *FileBuffer) ReplacePos(start, end token.Pos, new string) {
+	b.Replace(b.offset(start), b.offset(end), new)
+}
+
+// A PosEdit is an edit in terms of token.Pos values. It has the same
+// fields as the TextEdit type of golang.org/x/tools/go/analysis, so that
+// the TextEdits of a suggested fix convert directly to and from PosEdits,
+// as by edit.PosEdit(te) and analysis.TextEdit(pe).
+type PosEdit struct {
+	Pos     token.Pos // start of the replaced source
+	End     token.Pos // end of the replaced source; Pos for an insertion
+	NewText []byte
+}
+
+// PosEdits returns the queued edits of b as PosEdits in b's file,
+// in the order they are applied, as for the TextEdits of an
+// analysis.SuggestedFix.
+func (b *FileBuffer) PosEdits() []PosEdit {
+	specs := b.Edits()
+	pes := make([]PosEdit, len(specs))
+	for i, s := range specs {
+		pes[i] = PosEdit{
+			Pos:     b.file.Pos(s.Start),
+			End:     b.file.Pos(s.End),
+			NewText: []byte(s.New),
+		}
+	}
+	return pes
+}
+
+// AddPosEdits queues the edits pes, such as the converted TextEdits of the
+// suggested fixes of an analysis.Diagnostic for b's file, in order.
+// An End of token.NoPos means the edit is an insertion at Pos,
+// as in the analysis package. AddPosEdits returns an error and queues
+// nothing if an edit is not within b's file or ends before it starts.
+// Conflicts among the edits are reported when they are applied, as usual,
+// or earlier by Validate or Conflicts.
+func (b *FileBuffer) AddPosEdits(pes []PosEdit) error {
+	specs := make([]Edit, len(pes))
+	for i, pe := range pes {
+		end := pe.End
+		if !end.IsValid() {
+			end = pe.Pos
+		}
+		start, ok1 := b.tryOffset(pe.Pos)
+		stop, ok2 := b.tryOffset(end)
+		if !ok1 || !ok2 || stop < start {
+			return fmt.Errorf("edit: edit [%d,%d) is not a range of file %s", pe.Pos, pe.End, b.file.Name())
+		}
+		specs[i] = Edit{start, stop, string(pe.NewText)}
+	}
+	b.Add(specs...)
+	return nil
+}
@@ -0,0 +1,77 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package edit
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"reflect"
+	"testing"
+)
+
+func TestFileBuffer(t *testing.T) {
+	fset := token.NewFileSet()
+	fset.AddFile("other.go", -1, 100) // so that the file's base is not 1
+	src := []byte("package p\n\nfunc f() int { return 1 }\n")
+	f, err := parser.ParseFile(fset, "p.go", src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := NewFileBuffer(fset.File(f.Pos()), src)
+	fn := f.Decls[0].(*ast.FuncDecl)
+	b.ReplacePos(fn.Name.Pos(), fn.Name.End(), "g")
+	ret := fn.Body.List[0].(*ast.ReturnStmt)
+	b.DeletePos(ret.Results[0].Pos(), ret.Results[0].End())
+	b.InsertPos(ret.Results[0].Pos(), "2")
+	b.InsertPos(token.Pos(b.File().Base()+b.File().Size()), "// end\n")
+	if got, want := b.String(), "package p\n\nfunc g() int { return 2 }\n// end\n"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+
+	for _, pos := range []token.Pos{token.NoPos, 5, token.Pos(b.File().Base() + len(src) + 1)} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("InsertPos(%d) did not panic", pos)
+				}
+			}()
+			b.InsertPos(pos, "x")
+		}()
+	}
+}
+
+func TestPosEdits(t *testing.T) {
+	fset := token.NewFileSet()
+	fset.AddFile("other.go", -1, 100)
+	src := []byte("package p\n\nvar x = 1\n")
+	f, err := parser.ParseFile(fset, "p.go", src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := NewFileBuffer(fset.File(f.Pos()), src)
+	spec := f.Decls[0].(*ast.GenDecl).Specs[0].(*ast.ValueSpec)
+	pes := []PosEdit{
+		{Pos: spec.Names[0].Pos(), End: spec.Names[0].End(), NewText: []byte("y")},
+		{Pos: spec.Names[0].End(), NewText: []byte(" int")}, // insertion with no End
+	}
+	if err := b.AddPosEdits(pes); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := b.String(), "package p\n\nvar y int = 1\n"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+	pes[1].End = pes[1].Pos
+	if got := b.PosEdits(); !reflect.DeepEqual(got, pes) {
+		t.Errorf("PosEdits() = %v, want %v", got, pes)
+	}
+
+	if err := b.AddPosEdits([]PosEdit{{Pos: 5, End: 6}}); err == nil {
+		t.Errorf("AddPosEdits with a position outside the file succeeded")
+	}
+	if err := b.AddPosEdits([]PosEdit{{Pos: spec.End(), End: spec.Pos()}}); err == nil {
+		t.Errorf("AddPosEdits with an inverted range succeeded")
+	}
+}
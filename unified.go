@@ -0,0 +1,331 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package edit
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// A lineChange is a run of original lines replaced by the edited data.
+type lineChange struct {
+	line     int      // 0-based index of the first original line replaced
+	old, new []string // the replaced lines and their replacements, with newlines
+}
+
+// UnifiedDiff returns a unified diff, as produced by diff -u, from the
+// original data to the edited data, with the given number of lines of
+// context around each change. oldName and newName appear in the --- and +++
+// header lines. UnifiedDiff returns "" if the edits change nothing.
+//
+// The changes are taken from the normalized edits (see EditsHash), not
+// computed by diffing: each run of original lines touched by edits is shown
+// as removed and replaced by its edited lines, less any unchanged lines at
+// either end. Hunks whose context would overlap or touch are merged.
+// A final line without a newline is marked "\ No newline at end of file".
+// The labels of the edits in a hunk, if any, end its @@ header line;
+// see ReplaceLabeled.
+// UnifiedDiff panics if context is negative.
+func (b *Buffer) UnifiedDiff(oldName, newName string, context int) string {
+	var sb strings.Builder
+	b.StreamUnifiedDiff(&sb, oldName, newName, context)
+	return sb.String()
+}
+
+// labelsIn returns the distinct labels of the queued edits within the original
+// range [start, end], in the order queued and separated by commas.
+func (b *Buffer) labelsIn(start, end int) string {
+	var labels []string
+	seen := make(map[string]bool)
+	for _, e := range b.q {
+		if e.label != "" && !seen[e.label] && start <= e.start && e.end <= end {
+			seen[e.label] = true
+			labels = append(labels, e.label)
+		}
+	}
+	return strings.Join(labels, ", ")
+}
+
+// Diff returns a unified diff of the edits to the file named filename,
+// in the style of gofmt -d: the header names the original and edited data
+// a/filename and b/filename, and each hunk has three lines of context.
+// Diff returns nil if the edits change nothing.
+func (b *Buffer) Diff(filename string) []byte {
+	d := b.UnifiedDiff("a/"+filename, "b/"+filename, 3)
+	if d == "" {
+		return nil
+	}
+	return []byte(d)
+}
+
+// StreamUnifiedDiff is like UnifiedDiff but writes the diff to w.
+// Each hunk is written to w as soon as it is complete, so the memory used
+// is proportional to the largest hunk rather than to the whole diff.
+// StreamUnifiedDiff returns the first error returned by w.
+func (b *Buffer) StreamUnifiedDiff(w io.Writer, oldName, newName string, context int) error {
+	if context < 0 {
+		panic("invalid context")
+	}
+	n := b.contentsLen()
+	starts := b.lineStarts()
+	nlines := len(starts)
+	if starts[nlines-1] == n {
+		nlines-- // the empty line after a final newline, or in empty data
+	}
+	lineOf := func(off int) int { return sort.SearchInts(starts, off+1) - 1 }
+	lineEnd := func(i int) int {
+		if i+1 < len(starts) {
+			return starts[i+1]
+		}
+		return n
+	}
+
+	var hunk []lineChange
+	header := false
+	delta := 0 // edited line number minus original line number, before hunk
+	flush := func() error {
+		first, last := hunk[0], hunk[len(hunk)-1]
+		from := first.line - context
+		if from < 0 {
+			from = 0
+		}
+		to := last.line + len(last.old) + context
+		if to > nlines {
+			to = nlines
+		}
+		oldCount := to - from
+		newCount := oldCount
+		for _, c := range hunk {
+			newCount += len(c.new) - len(c.old)
+		}
+
+		var sb strings.Builder
+		if !header {
+			fmt.Fprintf(&sb, "--- %s\n+++ %s\n", oldName, newName)
+			header = true
+		}
+		fmt.Fprintf(&sb, "@@ -%s +%s @@", hunkRange(from, oldCount), hunkRange(from+delta, newCount))
+		if labels := b.labelsIn(starts[first.line], lineEnd(last.line+len(last.old)-1)); labels != "" {
+			sb.WriteString(" " + labels)
+		}
+		sb.WriteByte('\n')
+		line := from
+		for _, c := range hunk {
+			for ; line < c.line; line++ {
+				writeDiffLine(&sb, ' ', b.text(starts[line], lineEnd(line)))
+			}
+			for _, l := range c.old {
+				writeDiffLine(&sb, '-', l)
+			}
+			for _, l := range c.new {
+				writeDiffLine(&sb, '+', l)
+			}
+			line += len(c.old)
+		}
+		for ; line < to; line++ {
+			writeDiffLine(&sb, ' ', b.text(starts[line], lineEnd(line)))
+		}
+		delta += newCount - oldCount
+		hunk = hunk[:0]
+		_, err := io.WriteString(w, sb.String())
+		return err
+	}
+
+	specs := b.normalized()
+	for i := 0; i < len(specs); {
+		// Expand the edit to the original lines it touches, taking in
+		// following edits that touch the same lines, and render those lines.
+		la := lineOf(specs[i].Start)
+		start := starts[la]
+		cur, end := start, start
+		var out strings.Builder
+		for {
+			s := specs[i]
+			out.WriteString(b.text(cur, s.Start))
+			out.WriteString(s.New)
+			cur = s.End
+			i++
+			// The lines end at cur if it starts a line and the edited
+			// text so far is whole lines; otherwise at the end of cur's line.
+			j := lineOf(cur)
+			end = cur
+			if starts[j] != cur || out.Len() > 0 && !strings.HasSuffix(out.String(), "\n") {
+				end = lineEnd(j)
+			}
+			if i == len(specs) || starts[lineOf(specs[i].Start)] >= end {
+				break
+			}
+		}
+		out.WriteString(b.text(cur, end))
+
+		old, new := splitLines(b.text(start, end)), splitLines(out.String())
+		for len(old) > 0 && len(new) > 0 && old[0] == new[0] {
+			old, new = old[1:], new[1:]
+			la++
+		}
+		for len(old) > 0 && len(new) > 0 && old[len(old)-1] == new[len(new)-1] {
+			old, new = old[:len(old)-1], new[:len(new)-1]
+		}
+		if len(old) == 0 && len(new) == 0 {
+			continue
+		}
+		if k := len(hunk); k > 0 && la-(hunk[k-1].line+len(hunk[k-1].old)) > 2*context {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+		hunk = append(hunk, lineChange{line: la, old: old, new: new})
+	}
+	if len(hunk) > 0 {
+		return flush()
+	}
+	return nil
+}
+
+// hunkRange formats the range of count lines starting at the 0-based
+// line start for a unified diff hunk header.
+func hunkRange(start, count int) string {
+	switch count {
+	case 0:
+		return fmt.Sprintf("%d,0", start)
+	case 1:
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
+
+// writeDiffLine writes line to sb with the given prefix, noting if it lacks a newline.
+func writeDiffLine(sb *strings.Builder, prefix byte, line string) {
+	sb.WriteByte(prefix)
+	sb.WriteString(line)
+	if !strings.HasSuffix(line, "\n") {
+		sb.WriteString("\n\\ No newline at end of file\n")
+	}
+}
+
+// NewBufferFromPatch returns a new buffer for old holding the edits described
+// by patch, a unified diff of a single file such as UnifiedDiff produces.
+// Lines before the first hunk, such as the --- and +++ headers, are ignored.
+// Each run of removed and added lines in a hunk is queued as one edit.
+// NewBufferFromPatch returns an error if patch is malformed, or if the
+// context and removed lines of a hunk do not match old at the lines
+// its header gives; it does not search for a hunk's lines elsewhere.
+func NewBufferFromPatch(old, patch []byte) (*Buffer, error) {
+	b := NewBuffer(old)
+	starts := b.lineStarts()
+	lineStart := func(line int) int {
+		if line < len(starts) {
+			return starts[line]
+		}
+		return len(old)
+	}
+	lines := splitLines(string(patch))
+	i := 0
+	for i < len(lines) && !strings.HasPrefix(lines[i], "@@ ") {
+		i++
+	}
+	next := 0 // the first original line not yet consumed by a hunk
+	for i < len(lines) {
+		hdr := lines[i]
+		var oldLine, oldCount, newLine, newCount int
+		if !parseHunkHeader(hdr, &oldLine, &oldCount, &newLine, &newCount) {
+			return nil, fmt.Errorf("edit: malformed hunk header %q", strings.TrimSuffix(hdr, "\n"))
+		}
+		line := oldLine - 1 // 0-based index of the hunk's first original line
+		if oldCount == 0 {
+			line = oldLine // an empty range names the line before it
+		}
+		if line < next || line > len(starts) {
+			return nil, fmt.Errorf("edit: hunk %q out of order or outside original data", strings.TrimSuffix(hdr, "\n"))
+		}
+		i++
+		off := lineStart(line)
+		// The pending edit replaces [start, off) with repl.
+		start := -1
+		var repl strings.Builder
+		flush := func() {
+			if start >= 0 {
+				b.Replace(start, off, repl.String())
+				repl.Reset()
+				start = -1
+			}
+		}
+		for ; i < len(lines) && !strings.HasPrefix(lines[i], "@@ "); i++ {
+			l := lines[i]
+			if l == "\n" {
+				l = " \n" // an empty context line whose space was stripped
+			}
+			text := l[1:]
+			if i+1 < len(lines) && strings.HasPrefix(lines[i+1], `\`) {
+				text = strings.TrimSuffix(text, "\n")
+			}
+			switch l[0] {
+			case ' ', '-':
+				if oldCount == 0 || l[0] == ' ' && newCount == 0 {
+					return nil, fmt.Errorf("edit: hunk %q has too many lines", strings.TrimSuffix(hdr, "\n"))
+				}
+				if !b.hasText(off, text) || off+len(text) != lineStart(line+1) {
+					return nil, fmt.Errorf("edit: patch does not match original line %d", line+1)
+				}
+				oldCount--
+				if l[0] == ' ' {
+					newCount--
+					flush()
+				} else if start < 0 {
+					start = off
+				}
+				off += len(text)
+				line++
+			case '+':
+				if newCount == 0 {
+					return nil, fmt.Errorf("edit: hunk %q has too many lines", strings.TrimSuffix(hdr, "\n"))
+				}
+				newCount--
+				if start < 0 {
+					start = off
+				}
+				repl.WriteString(text)
+			case '\\':
+				// "\ No newline at end of file", handled with the line before it.
+			default:
+				return nil, fmt.Errorf("edit: malformed patch line %q", strings.TrimSuffix(l, "\n"))
+			}
+		}
+		flush()
+		if oldCount != 0 || newCount != 0 {
+			return nil, fmt.Errorf("edit: hunk %q is truncated", strings.TrimSuffix(hdr, "\n"))
+		}
+		next = line
+	}
+	return b, nil
+}
+
+// parseHunkHeader parses a hunk header "@@ -oldLine,oldCount +newLine,newCount @@",
+// in which a count of 1 may be omitted along with its comma.
+func parseHunkHeader(hdr string, oldLine, oldCount, newLine, newCount *int) bool {
+	f := strings.Fields(hdr)
+	if len(f) < 4 || f[0] != "@@" || f[3] != "@@" {
+		return false
+	}
+	return parseHunkRange(f[1], '-', oldLine, oldCount) && parseHunkRange(f[2], '+', newLine, newCount)
+}
+
+// parseHunkRange parses one range of a hunk header, such as "-3,2" or "+4".
+func parseHunkRange(s string, sign byte, line, count *int) bool {
+	if s == "" || s[0] != sign {
+		return false
+	}
+	l, c := s[1:], "1"
+	if i := strings.IndexByte(l, ','); i >= 0 {
+		l, c = l[:i], l[i+1:]
+	}
+	n, err1 := strconv.Atoi(l)
+	m, err2 := strconv.Atoi(c)
+	*line, *count = n, m
+	return err1 == nil && err2 == nil && n >= 0 && m >= 0
+}
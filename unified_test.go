@@ -0,0 +1,162 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package edit
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func TestStreamUnifiedDiff(t *testing.T) {
+	const in = "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n"
+	tests := []struct {
+		in      string
+		edit    func(b *Buffer)
+		context int
+		want    string
+	}{
+		{in, func(b *Buffer) {}, 3, ""},
+		{
+			in, func(b *Buffer) { b.Replace(4, 5, "three") }, 1,
+			"--- a\n+++ b\n@@ -2,3 +2,3 @@\n 2\n-3\n+three\n 4\n",
+		},
+		{
+			// Changes within twice the context of each other share a hunk.
+			in, func(b *Buffer) {
+				b.Replace(2, 3, "two")
+				b.Insert(8, "x\n")
+			}, 1,
+			"--- a\n+++ b\n@@ -1,5 +1,6 @@\n 1\n-2\n+two\n 3\n 4\n+x\n 5\n",
+		},
+		{
+			in, func(b *Buffer) {
+				b.Replace(2, 3, "two")
+				b.Delete(12, 14)
+			}, 1,
+			"--- a\n+++ b\n@@ -1,3 +1,3 @@\n 1\n-2\n+two\n 3\n@@ -6,3 +6,2 @@\n 6\n-7\n 8\n",
+		},
+		{
+			// Joining two lines changes both.
+			in, func(b *Buffer) { b.Replace(1, 2, " ") }, 0,
+			"--- a\n+++ b\n@@ -1,2 +1 @@\n-1\n-2\n+1 2\n",
+		},
+		{
+			// Inserting whole lines at the start adds lines only.
+			in, func(b *Buffer) { b.Insert(0, "0\n") }, 0,
+			"--- a\n+++ b\n@@ -0,0 +1 @@\n+0\n",
+		},
+		{
+			"a\nb", func(b *Buffer) { b.Insert(3, "c") }, 3,
+			"--- a\n+++ b\n@@ -1,2 +1,2 @@\n a\n-b\n\\ No newline at end of file\n+bc\n\\ No newline at end of file\n",
+		},
+		{
+			"a\nb", func(b *Buffer) { b.Insert(3, "\n") }, 0,
+			"--- a\n+++ b\n@@ -2 +2 @@\n-b\n\\ No newline at end of file\n+b\n",
+		},
+	}
+	for _, tt := range tests {
+		b := NewBufferString(tt.in)
+		tt.edit(b)
+		var sb strings.Builder
+		if err := b.StreamUnifiedDiff(&sb, "a", "b", tt.context); err != nil {
+			t.Fatal(err)
+		}
+		if got := sb.String(); got != tt.want {
+			t.Errorf("StreamUnifiedDiff of %q (context %d) = \n%s\nwant:\n%s", b.String(), tt.context, got, tt.want)
+		}
+	}
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	b := NewBufferString("func f() {\n\treturn  1\n}\n")
+	b.Replace(18, 20, " ") // formatting only
+	want := "--- f.go\n+++ f.go\n@@ -1,3 +1,3 @@\n func f() {\n-\treturn  1\n+\treturn 1\n }\n"
+	if got := b.UnifiedDiff("f.go", "f.go", 3); got != want {
+		t.Errorf("UnifiedDiff = \n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestDiffGofmtStyle(t *testing.T) {
+	b := NewBufferString("func f() {\n\treturn  1\n}\n")
+	if got := b.Diff("f.go"); got != nil {
+		t.Errorf("Diff with no edits = %q, want nil", got)
+	}
+	b.Replace(18, 20, " ")
+	want := "--- a/f.go\n+++ b/f.go\n@@ -1,3 +1,3 @@\n func f() {\n-\treturn  1\n+\treturn 1\n }\n"
+	if got := string(b.Diff("f.go")); got != want {
+		t.Errorf("Diff = \n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestNewBufferFromPatch(t *testing.T) {
+	old := "a\nb\nc\nd\ne\nf\ng\nh\ni\nj"
+	patch := `--- a/x
++++ b/x
+@@ -1,4 +1,4 @@
+ a
+-b
++B
++B2
+ c
+-d
+@@ -8,3 +8,3 @@
+ h
+ i
+-j
+\ No newline at end of file
++J
+`
+	b, err := NewBufferFromPatch([]byte(old), []byte(patch))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := b.String(), "a\nB\nB2\nc\ne\nf\ng\nh\ni\nJ\n"; got != want {
+		t.Errorf("NewBufferFromPatch produced %q, want %q", got, want)
+	}
+
+	for _, bad := range []string{
+		"@@ -1,1 +1,1 @@\n-x\n+y\n",     // does not match
+		"@@ -2,1 +2,1 @@\n-a\n+y\n",     // matches the wrong line
+		"@@ -1,3 +1,3 @@\n a\n-b\n+y\n", // truncated
+		"@@ -1 +1 @@\n?a\n",             // bad line
+		"@@ -x +1 @@\n",                 // bad header
+	} {
+		if _, err := NewBufferFromPatch([]byte(old), []byte(bad)); err == nil {
+			t.Errorf("NewBufferFromPatch accepted %q", bad)
+		}
+	}
+}
+
+func TestNewBufferFromPatchRoundTrip(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for iter := 0; iter < 500; iter++ {
+		var sb strings.Builder
+		for i := r.Intn(20); i >= 0; i-- {
+			sb.WriteString(strings.Repeat("x", r.Intn(3)))
+			if r.Intn(5) > 0 {
+				sb.WriteByte('\n')
+			}
+		}
+		old := sb.String()
+		b := NewBufferString(old)
+		for i := r.Intn(4); i > 0; i-- {
+			start := r.Intn(len(old) + 1)
+			end := start + r.Intn(len(old)-start+1)
+			new := strings.Repeat("y\n", r.Intn(3)) + strings.Repeat("z", r.Intn(2))
+			if b.TryReplace(start, end, new) != nil || b.Validate() != nil {
+				b.Undo()
+			}
+		}
+		patch := b.UnifiedDiff("a", "b", r.Intn(4))
+		pb, err := NewBufferFromPatch([]byte(old), []byte(patch))
+		if err != nil {
+			t.Fatalf("NewBufferFromPatch(%q, %q): %v", old, patch, err)
+		}
+		if got, want := pb.String(), b.String(); got != want {
+			t.Fatalf("NewBufferFromPatch(%q, %q) produced %q, want %q", old, patch, got, want)
+		}
+	}
+}